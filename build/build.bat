@@ -1,3 +1,5 @@
+rem Extra arguments go to go build, such as -tags mbtiles for -mbtiles
+rem support, which needs cgo and a C compiler.
 mkdir bin
-go build -o bin/web ./cmd/web/
-go build -o bin/admin ./cmd/admin/
\ No newline at end of file
+go build %* -o bin/web ./cmd/web/
+go build %* -o bin/admin ./cmd/admin/
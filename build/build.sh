@@ -1,4 +1,6 @@
 #!/bin/bash
+# Extra arguments go to go build, such as -tags mbtiles for -mbtiles
+# support, which needs cgo and a C compiler.
 mkdir -p bin
-go build -o bin/web ./cmd/web/
-go build -o bin/admin ./cmd/admin/
\ No newline at end of file
+go build "$@" -o bin/web ./cmd/web/
+go build "$@" -o bin/admin ./cmd/admin/
@@ -3,20 +3,64 @@ package main
 import (
 	"database/sql"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
+	"gitlab.com/code-mobi/board-checker/pkg/ingest"
+	"gitlab.com/code-mobi/board-checker/pkg/labels"
 	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/qr"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
 )
 
 func main() {
 	dsn := flag.String("dsn", os.Getenv("BC_DSN"), "Database DSN")
 	cmd := flag.String("cmd", "", `Command
-	adduser -name -password
-	changepwd -name -password`)
+	migrate
+	upgrade
+	geofence -store-dir -radius
+	importzones -file [-create] [-dry-run]
+	importworksheets -file [-create] [-dry-run]
+	ingest -dir -store-dir [-match] [-pattern] [-log] [-radius] [-qr-secret] [-qr-legacy-ids] [-dry-run]
+	labels -out -base-url -qr-secret [-boards] [-campaign] [-date] [-zone-id] [-team-id] [-layout] [-outline] [-font] [-dpi] [-label-size]
+	adduser -name -password [-role]
+	changepwd -name -password
+	setrole -name -role
+	setteam -name -team-id`)
 
 	name := flag.String("name", "", "User Name")
 	password := flag.String("password", "", "User Password")
+	role := flag.String("role", models.RoleInspector, "User Role: "+strings.Join(models.Roles, ", "))
+	storeDir := flag.String("store-dir", os.Getenv("BC_STORE"), "Path to store files")
+	radius := flag.Float64("radius", 100, "Largest distance in metres between a photo and its board")
+	file := flag.String("file", "", "GeoJSON or KML file of zone boundaries, or CSV file of worksheets")
+	create := flag.Bool("create", false, "Create zones and teams named in the file that don't exist")
+	dryRun := flag.Bool("dry-run", false, "Report what would change without saving")
+	dir := flag.String("dir", "", "Folder of photos to ingest, such as a camera's SD card")
+	match := flag.String("match", strings.Join(ingest.DefaultMatch, ","), "Ways to match ingested files to worksheets, tried in order: folder, filename and qr")
+	pattern := flag.String("pattern", ingest.DefaultPattern.String(), "Pattern whose last submatch is the worksheet number in ingested file names")
+	ingestLog := flag.String("log", "ingest.log", "Progress log of an ingest; files it holds are not ingested again")
+	out := flag.String("out", "labels.pdf", "Label file to write, a PDF of sheets or ZPL for thermal printers by its extension")
+	baseURL := flag.String("base-url", "", "URL of the web server that label QR codes open, such as https://checker.example.com")
+	qrSecret := flag.String("qr-secret", os.Getenv("BC_QR_SECRET"), "QR secret key of the web server, its -qr-secret or else its -secret, which signs label QR codes and checks ingested ones")
+	qrLegacyIDs := flag.Bool("qr-legacy-ids", false, "Match ingested files by unsigned QR codes too: bare worksheet IDs and worksheet page URLs")
+	boards := flag.Bool("boards", false, "Print labels for boards instead of worksheets")
+	campaign := flag.String("campaign", "", "Print labels for the worksheets of a campaign")
+	date := flag.String("date", "", "Print labels for the worksheets created on a date, YYYY-MM-DD")
+	zoneID := flag.Int("zone-id", 0, "Print labels for the worksheets of a zone")
+	teamID := flag.Int("team-id", 0, "Print labels for the worksheets of a team, or the team of a user, 0 for none")
+	layout := flag.String("layout", labels.DefaultLayout, "Label sheet: L7159, L7160, L7163, L7165 or COLSxROWS")
+	outline := flag.Bool("outline", false, "Draw the edge of every label, to check the layout on plain paper")
+	font := flag.String("font", "", "TrueType font file of labels, for text outside Latin-1 such as Thai")
+	dpi := flag.Int("dpi", labels.DefaultPrinter.DPI, "Resolution of the thermal printer")
+	labelSize := flag.String("label-size", "50x30", "Width and height in millimetres of thermal printer labels")
 
 	flag.Parse()
 
@@ -30,10 +74,207 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+	case "upgrade":
+		err := database.UpgradeTable()
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "geofence":
+		n, err := database.BackfillGeofence(*storeDir, *radius)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Read GPS of %d photos", n)
+	case "importzones":
+		b, err := ioutil.ReadFile(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		features, err := geo.Parse(b)
+		if err != nil {
+			log.Fatal(err)
+		}
+		results, err := database.ImportZoneBoundaries(features, *create, *dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, result := range results {
+			switch {
+			case result.Skipped:
+				log.Printf("%q: skipped, no zone has this name", result.Name)
+			case result.Created:
+				log.Printf("%q: new zone", result.Name)
+			default:
+				log.Printf("%q: boundary of zone %d", result.Name, result.ZoneID)
+			}
+		}
+	case "importworksheets":
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rows, err := models.ReadWorksheetCSV(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = database.ImportWorksheets(rows, *create, *dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, row := range rows {
+			switch {
+			case len(row.Errors) > 0:
+				log.Printf("line %d %q: %s", row.Line, row.Number, strings.Join(row.Errors, "; "))
+			case row.WorksheetID != 0:
+				log.Printf("line %d %q: worksheet %d", row.Line, row.Number, row.WorksheetID)
+			}
+		}
+		switch {
+		case rows.Failed() > 0:
+			log.Fatalf("%d of %d rows have errors, nothing was imported", rows.Failed(), len(rows))
+		case *dryRun:
+			log.Printf("%d rows can be imported", len(rows))
+		default:
+			log.Printf("Imported %d worksheets", len(rows))
+		}
+	case "ingest":
+		rx, err := regexp.Compile(*pattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		matches := strings.Split(*match, ",")
+		for _, m := range matches {
+			if m == ingest.ByQR && *qrSecret == "" {
+				log.Fatal("-qr-secret is required to match by qr")
+			}
+		}
+		in := &ingest.Ingest{
+			Root:    *dir,
+			Match:   matches,
+			Pattern: rx,
+			DB:      database,
+			Store: &store.Store{
+				Dir:            *storeDir,
+				Limits:         store.Limits{AllowVideo: true},
+				GeofenceRadius: *radius,
+				QR:             qr.Reader{Signer: qr.Signer{Key: []byte(*qrSecret)}, LegacyIDs: *qrLegacyIDs},
+			},
+			Log: *ingestLog,
+		}
+		files, err := in.Scan()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := in.Assign(files); err != nil {
+			log.Fatal(err)
+		}
+		unmatched := 0
+		for _, file := range files {
+			if file.Worksheet == nil {
+				unmatched++
+				log.Printf("%s: no worksheet", file.Path)
+			} else if *dryRun {
+				log.Printf("%s: worksheet %s by %s", file.Path, file.Worksheet.Number, file.MatchedBy)
+			}
+		}
+		if *dryRun {
+			log.Printf("%d of %d files match a worksheet", len(files)-unmatched, len(files))
+			break
+		}
+
+		var saved, duplicates, failed int
+		err = in.Save(files, func(file *ingest.File, result *store.BatchResult) {
+			switch {
+			case result.Err != nil:
+				failed++
+				log.Printf("%s: %s", file.Path, result.Err)
+			case result.Duplicate:
+				duplicates++
+				log.Printf("%s: already photo %d of worksheet %s", file.Path, result.Photo.ID, file.Worksheet.Number)
+			default:
+				saved++
+				log.Printf("%s: photo %d of worksheet %s", file.Path, result.Photo.ID, file.Worksheet.Number)
+			}
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Saved %d photos, %d duplicates, %d failed, %d without a worksheet", saved, duplicates, failed, unmatched)
+	case "labels":
+		if *baseURL == "" {
+			log.Fatal("-base-url is required")
+		}
+		if *qrSecret == "" {
+			log.Fatal("-qr-secret is required")
+		}
+		signer := qr.Signer{Key: []byte(*qrSecret)}
+		list := []*labels.Label{}
+		if *boards {
+			query := forms.NewQuery()
+			query.MaxResults = -1
+			all, _, err := database.ListBoards(query)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, board := range all {
+				list = append(list, &labels.Label{
+					URL:    strings.TrimSuffix(*baseURL, "/") + "/q/" + signer.Token(qr.KindBoard, board.ID),
+					Number: board.Code,
+					Name:   board.Name,
+				})
+			}
+		} else {
+			var worksheets models.Worksheets
+			var err error
+			if *campaign != "" {
+				worksheets, err = database.ListWorksheetsByCampaign(*campaign)
+			} else {
+				worksheets, err = database.ListWorksheetsByFilter(&forms.PhotoFilter{Date: *date, ZoneID: *zoneID, TeamID: *teamID})
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, worksheet := range worksheets {
+				list = append(list, &labels.Label{
+					URL:    strings.TrimSuffix(*baseURL, "/") + "/q/" + signer.Token(qr.KindWorksheet, worksheet.ID),
+					Number: worksheet.Number,
+					Name:   worksheet.Name,
+				})
+			}
+		}
+
+		zpl := strings.EqualFold(filepath.Ext(*out), ".zpl")
+		p := labels.Printer{DPI: *dpi}
+		if _, err := fmt.Sscanf(*labelSize, "%fx%f", &p.Width, &p.Height); zpl && err != nil {
+			log.Fatalf("-label-size %q: %s", *labelSize, err)
+		}
+		sheetLayout, err := labels.ParseLayout(*layout)
+		if !zpl && err != nil {
+			log.Fatal(err)
+		}
+
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if zpl {
+			err = labels.WriteZPL(f, p, list)
+		} else {
+			err = (&labels.Sheet{Layout: sheetLayout, Font: *font, Outline: *outline}).Write(f, "Labels", list)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Wrote %d labels to %s", len(list), *out)
 	case "adduser":
 		user := &models.User{
 			Name:     *name,
 			Password: *password,
+			Role:     *role,
 		}
 		log.Printf("Add User %v", user)
 		err := database.InsertUser(user)
@@ -45,6 +286,16 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+	case "setrole":
+		err := database.SetUserRole(*name, *role)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "setteam":
+		err := database.SetUserTeam(*name, *teamID)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 }
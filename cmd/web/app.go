@@ -1,7 +1,14 @@
 package main
 
 import (
+	"time"
+
 	"github.com/alexedwards/scs"
+	"gitlab.com/code-mobi/board-checker/pkg/deck"
+	"gitlab.com/code-mobi/board-checker/pkg/search"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
+	"gitlab.com/code-mobi/board-checker/pkg/tiles"
+	"gitlab.com/code-mobi/board-checker/pkg/tus"
 )
 
 type App struct {
@@ -11,4 +18,68 @@ type App struct {
 	StaticDir string
 	StoreDir  string
 	SecretKey string
+
+	// QRSecret signs the /q/{token} URLs of QR codes. Labels already
+	// printed stop opening when it changes.
+	QRSecret string
+
+	// BaseURL is the URL of the server in QR codes, labels, reports and
+	// API links, such as https://checker.example.com. Without it the Host
+	// of each request is used.
+	BaseURL string
+
+	// SearchIndex serves searches when the database has no FULLTEXT support.
+	SearchIndex *search.Index
+
+	// IdempotencyTTL is how long responses to requests with an
+	// Idempotency-Key header are kept for replay.
+	IdempotencyTTL time.Duration
+
+	// Uploads holds resumable uploads until they become photos.
+	Uploads       *tus.Store
+	UploadMaxSize int64
+
+	// UploadLimits decide which photos are accepted by every upload.
+	UploadLimits store.Limits
+
+	// UploadScanQR reads worksheet QR codes from every uploaded photo, to
+	// flag photos filed under the wrong worksheet. Photos uploaded to the
+	// inbox are always read.
+	UploadScanQR bool
+
+	// QRLegacyIDs reads the unsigned worksheet QR codes printed before
+	// signed ones from uploaded photos.
+	QRLegacyIDs bool
+
+	// QRPublicStatus shows a read-only status page to visitors who scan a
+	// worksheet or board QR code without logging in.
+	QRPublicStatus bool
+
+	// GeofenceRadius is how far in metres from its worksheet or board a
+	// photo may be taken.
+	GeofenceRadius float64
+
+	// Tiles serves /tiles from a local MBTiles file. It is nil when none
+	// is configured.
+	Tiles *tiles.MBTiles
+
+	// Map configures the Leaflet maps of the pages.
+	Map MapConfig
+
+	// ReportFont is a TrueType font for PDF reports, needed for text
+	// outside Latin-1 such as Thai.
+	ReportFont string
+
+	// DeckTemplates are the slide templates of PPTX decks. The first is the
+	// default. Without any deck.DefaultTemplate is used.
+	DeckTemplates []*deck.Template
+}
+
+// MapConfig is where maps load Leaflet and their tiles from.
+type MapConfig struct {
+	LeafletURL  string
+	TileURL     string
+	Attribution string
+	MinZoom     int
+	MaxZoom     int
 }
@@ -78,3 +78,17 @@ func (app *App) APIClientErrorWithMessage(w http.ResponseWriter, status int, mes
 	w.WriteHeader(status)
 	w.Write(j)
 }
+
+// APIValidationError reports the failures of a form by field.
+func (app *App) APIValidationError(w http.ResponseWriter, failures map[string]string) {
+	j, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":     http.StatusUnprocessableEntity,
+			"message":  http.StatusText(http.StatusUnprocessableEntity),
+			"failures": failures,
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(j)
+}
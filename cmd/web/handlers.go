@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -13,8 +14,8 @@ import (
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
 	"gitlab.com/code-mobi/board-checker/pkg/models"
-	qrcode "github.com/skip2/go-qrcode"
 )
 
 func (app *App) Home(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +35,10 @@ func (app *App) Home(w http.ResponseWriter, r *http.Request) {
 	if err == nil {
 		query.MaxResults = maxResults
 	}
+	if status := r.FormValue("status"); models.ValidStatus(status) {
+		query.Status = status
+	}
+	query.Incomplete = r.FormValue("incomplete") == "1"
 
 	worksheets, pageInfo, err := db.ListWorksheets(query)
 	if err != nil {
@@ -41,7 +46,20 @@ func (app *App) Home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pageInfo.ConfigPaginations("/?", query.Start)
+	pageURL := "/?"
+	if query.Status != "" {
+		pageURL += "status=" + query.Status + "&"
+	}
+	if query.Incomplete {
+		pageURL += "incomplete=1&"
+	}
+	pageInfo.ConfigPaginations(pageURL, query.Start)
+
+	campaigns, err := db.ListCampaigns()
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
 
 	session := app.Sessions.Load(r)
 	flash, err := session.PopString(w, "flash")
@@ -53,8 +71,12 @@ func (app *App) Home(w http.ResponseWriter, r *http.Request) {
 	app.RenderHTML(w, r, []string{"home.page.html", "pagination.partial.html"}, &HTMLData{
 		Flash:      flash,
 		Dates:      dates,
+		Campaigns:  campaigns,
 		Worksheets: worksheets,
 		PageInfo:   pageInfo,
+		Status:     query.Status,
+		Statuses:   models.Statuses,
+		Incomplete: query.Incomplete,
 	})
 }
 
@@ -109,7 +131,17 @@ func (app *App) VerifyUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	// A scanned QR code sends inspectors on after they log in.
+	next, err := session.PopString(w, "loginRedirect")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if next == "" {
+		next = "/"
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
 }
 
 func (app *App) LogoutUser(w http.ResponseWriter, r *http.Request) {
@@ -409,11 +441,461 @@ func (app *App) EditZone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	session := app.Sessions.Load(r)
+	flash, err := session.PopString(w, "flash")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
 	app.RenderHTML(w, r, []string{"zone.edit.page.html"}, &HTMLData{
-		Zone: zone,
+		Flash: flash,
+		Zone:  zone,
+	})
+}
+
+func (app *App) SaveZoneBoundary(w http.ResponseWriter, r *http.Request) {
+	zoneID, _ := strconv.Atoi(mux.Vars(r)["zone_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	zone, err := db.GetZone(zoneID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if zone == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var boundary geo.MultiPolygon
+	if r.FormValue("zone_boundary_remove") == "" {
+		file, _, err := r.FormFile("zone_boundary")
+		if err != nil {
+			app.RenderHTML(w, r, []string{"zone.edit.page.html"}, &HTMLData{
+				Error: "Please select a GeoJSON or KML file.",
+				Zone:  zone,
+			})
+			return
+		}
+		defer file.Close()
+
+		features, err := readBoundaries(file)
+		if err != nil {
+			app.RenderHTML(w, r, []string{"zone.edit.page.html"}, &HTMLData{
+				Error: "The file has no usable boundary: " + err.Error(),
+				Zone:  zone,
+			})
+			return
+		}
+		boundary = mergeBoundaries(features)
+	}
+
+	err = db.SetZoneBoundary(zoneID, boundary)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	err = session.PutString(w, "flash", "Zone boundary was saved successfully!")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/zone/"+strconv.Itoa(zoneID)+"/edit", http.StatusSeeOther)
+}
+
+func (app *App) ImportZones(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		app.RenderHTML(w, r, []string{"zone.import.page.html"}, &HTMLData{
+			Title: "Import Zones",
+		})
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	decoder := form.NewDecoder()
+
+	f := &forms.ZoneImport{}
+	err := decoder.Decode(f, r.PostForm)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("zone_import_file")
+	if err != nil {
+		app.RenderHTML(w, r, []string{"zone.import.page.html"}, &HTMLData{
+			Title: "Import Zones",
+			Error: "Please select a GeoJSON or KML file.",
+			Form:  f,
+		})
+		return
+	}
+	defer file.Close()
+
+	features, err := readBoundaries(file)
+	if err != nil {
+		app.RenderHTML(w, r, []string{"zone.import.page.html"}, &HTMLData{
+			Title: "Import Zones",
+			Error: "The file has no usable boundary: " + err.Error(),
+			Form:  f,
+		})
+		return
+	}
+
+	results, err := db.ImportZoneBoundaries(features, f.Create, f.DryRun)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	flash := "Zone boundaries were imported successfully!"
+	if f.DryRun {
+		flash = "Preview only, nothing was saved. Choose the file again and untick preview to import it."
+	}
+	app.RenderHTML(w, r, []string{"zone.import.page.html"}, &HTMLData{
+		Title:       "Import Zones",
+		Flash:       flash,
+		Form:        f,
+		ZoneImports: results,
+	})
+}
+
+func (app *App) ZoneOutliers(w http.ResponseWriter, r *http.Request) {
+	zoneID, _ := strconv.Atoi(r.FormValue("zone_id"))
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	zones, err := db.ListZones()
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	outliers, err := db.ListZoneOutliers(zoneID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	var zone *models.Zone
+	for _, z := range zones {
+		if z.ID == zoneID {
+			zone = z
+		}
+	}
+
+	app.RenderHTML(w, r, []string{"zone.outside.page.html"}, &HTMLData{
+		Title:        "Photos outside their zone",
+		Zone:         zone,
+		Zones:        zones,
+		ZoneOutliers: outliers,
+	})
+}
+
+func (app *App) IndexBoard(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	query := forms.NewQuery()
+	query.Q = r.FormValue("q")
+	query.Start, _ = strconv.Atoi(r.FormValue("start"))
+	maxResults, err := strconv.Atoi(r.FormValue("maxResults"))
+	if err == nil {
+		query.MaxResults = maxResults
+	}
+
+	boards, pageInfo, err := db.ListBoards(query)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	pageInfo.ConfigPaginations("/boards?q="+url.QueryEscape(query.Q)+"&", query.Start)
+
+	session := app.Sessions.Load(r)
+	flash, err := session.PopString(w, "flash")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"board.index.page.html", "pagination.partial.html"}, &HTMLData{
+		Title:    "Board",
+		Flash:    flash,
+		Query:    query.Q,
+		Boards:   boards,
+		PageInfo: pageInfo,
+	})
+}
+
+func (app *App) ShowBoard(w http.ResponseWriter, r *http.Request) {
+	boardID, _ := strconv.Atoi(mux.Vars(r)["board_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	board, err := db.GetBoard(boardID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if board == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	inspections, err := db.ListBoardInspections(board.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	flash, err := session.PopString(w, "flash")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"board.show.page.html"}, &HTMLData{
+		Flash:       flash,
+		Board:       board,
+		Inspections: inspections,
+	})
+}
+
+func (app *App) NewBoard(w http.ResponseWriter, r *http.Request) {
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	zones, _ := db.ListZones()
+
+	app.RenderHTML(w, r, []string{"board.new.page.html", "board.form.partial.html", "zone.suggest.partial.html"}, &HTMLData{
+		Board:      &models.Board{Type: models.BoardTypeStatic},
+		BoardTypes: models.BoardTypes,
+		Zones:      zones,
+	})
+}
+
+func (app *App) SaveBoard(w http.ResponseWriter, r *http.Request) {
+	boardID, _ := strconv.Atoi(mux.Vars(r)["board_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	decoder := form.NewDecoder()
+
+	var f forms.Board
+	err := decoder.Decode(&f, r.PostForm)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if boardID != 0 {
+		board, err := db.GetBoard(boardID)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		if board == nil {
+			app.NotFound(w, r)
+			return
+		}
+	}
+
+	board := &models.Board{
+		ID:     boardID,
+		Code:   f.Code,
+		Name:   f.Name,
+		Lat:    f.Lat,
+		Lng:    f.Lng,
+		Size:   f.Size,
+		Facing: f.Facing,
+		Type:   f.Type,
+		Owner:  f.Owner,
+		ZoneID: f.ZoneID,
+	}
+
+	if f.Valid(models.BoardTypes) {
+		if f.Lat != 0 || f.Lng != 0 {
+			board.ZoneID, err = autoZone(db, f.ZoneID, &models.Location{f.Lat, f.Lng}, 0)
+			if err != nil {
+				app.ServerError(w, err)
+				return
+			}
+		}
+		if boardID == 0 {
+			err = db.InsertBoard(board)
+		} else {
+			err = db.UpdateBoard(board)
+		}
+		if err == models.ErrDuplicateBoardCode {
+			f.Failures["Code"] = "Another board has this code"
+		} else if err != nil {
+			app.ServerError(w, err)
+			return
+		} else if boardID != 0 {
+			err = db.RecheckBoardGeofence(boardID, app.GeofenceRadius)
+			if err != nil {
+				app.ServerError(w, err)
+				return
+			}
+		}
+	}
+
+	if len(f.Failures) > 0 {
+		zones, _ := db.ListZones()
+		page := "board.new.page.html"
+		if boardID != 0 {
+			page = "board.edit.page.html"
+		}
+		app.RenderHTML(w, r, []string{page, "board.form.partial.html", "zone.suggest.partial.html"}, &HTMLData{
+			Form:       &f,
+			Board:      board,
+			BoardTypes: models.BoardTypes,
+			Zones:      zones,
+		})
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	err = session.PutString(w, "flash", "Board was saved successfully!")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/board/"+strconv.Itoa(board.ID), http.StatusSeeOther)
+}
+
+func (app *App) EditBoard(w http.ResponseWriter, r *http.Request) {
+	boardID, _ := strconv.Atoi(mux.Vars(r)["board_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	board, err := db.GetBoard(boardID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if board == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	zones, _ := db.ListZones()
+
+	app.RenderHTML(w, r, []string{"board.edit.page.html", "board.form.partial.html", "zone.suggest.partial.html"}, &HTMLData{
+		Board:      board,
+		BoardTypes: models.BoardTypes,
+		Zones:      zones,
 	})
 }
 
+func (app *App) DeleteBoard(w http.ResponseWriter, r *http.Request) {
+	boardID, _ := strconv.Atoi(mux.Vars(r)["board_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	if boardID == 0 {
+		app.NotFound(w, r)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	err := db.DeleteBoard(boardID)
+	if err == models.ErrBoardInUse {
+		err = session.PutString(w, "flash", "Board has worksheets and cannot be deleted.")
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/board/"+strconv.Itoa(boardID), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	err = session.PutString(w, "flash", "Board was deleted successfully!")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/boards", http.StatusSeeOther)
+}
+
 func (app *App) IndexWorksheetByDate(w http.ResponseWriter, r *http.Request) {
 	date := mux.Vars(r)["date"]
 
@@ -433,9 +915,11 @@ func (app *App) IndexWorksheetByDate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.RenderHTML(w, r, []string{"worksheet.index.page.html"}, &HTMLData{
+	app.RenderHTML(w, r, []string{"worksheet.index.page.html", "worksheet.route.partial.html"}, &HTMLData{
 		Flash:      flash,
 		Worksheets: worksheets,
+		ExportPath: r.URL.Path,
+		DeckLinks:  app.deckLinks(r.URL.Path+"/deck.pptx", nil),
 	})
 }
 
@@ -458,25 +942,73 @@ func (app *App) IndexWorksheetBySearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.RenderHTML(w, r, []string{"worksheet.index.page.html"}, &HTMLData{
+	app.RenderHTML(w, r, []string{"worksheet.index.page.html", "worksheet.route.partial.html"}, &HTMLData{
 		Title:      "Search - " + q,
 		Flash:      flash,
 		Worksheets: worksheets,
 	})
 }
 
+func (app *App) ShowSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.FormValue("q")
+	maxResults, err := strconv.Atoi(r.FormValue("maxResults"))
+	if err != nil || maxResults < 1 {
+		maxResults = forms.NewQuery().MaxResults
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	results, err := app.Search(db, q, maxResults)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"search.page.html"}, &HTMLData{
+		Title:   "Search - " + q,
+		Query:   q,
+		Results: results,
+	})
+}
+
 func (app *App) IndexWorksheetByTeam(w http.ResponseWriter, r *http.Request) {
 	teamID, _ := strconv.Atoi(mux.Vars(r)["team_id"])
 
+	f, err := routeForm(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
 	db := &models.Database{connect(app.DSN)}
 	defer db.Close()
 
+	team, err := db.GetTeam(teamID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if team == nil {
+		app.NotFound(w, r)
+		return
+	}
+
 	worksheets, err := db.ListWorksheetsByTeam(teamID)
 	if err != nil {
 		app.ServerError(w, err)
 		return
 	}
 
+	var route *models.Route
+	if f.Valid() {
+		route, err = planRoute(db, r, f)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+	}
+
 	session := app.Sessions.Load(r)
 	flash, err := session.PopString(w, "flash")
 	if err != nil {
@@ -484,10 +1016,14 @@ func (app *App) IndexWorksheetByTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.RenderHTML(w, r, []string{"worksheet.index.page.html"}, &HTMLData{
+	app.RenderHTML(w, r, []string{"worksheet.index.page.html", "worksheet.route.partial.html"}, &HTMLData{
 		Title:      "Worksheet",
 		Flash:      flash,
+		Form:       f,
+		Team:       team,
+		Route:      route,
 		Worksheets: worksheets,
+		ExportPath: r.URL.Path,
 	})
 }
 
@@ -510,10 +1046,11 @@ func (app *App) IndexWorksheetByZone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.RenderHTML(w, r, []string{"worksheet.index.page.html"}, &HTMLData{
+	app.RenderHTML(w, r, []string{"worksheet.index.page.html", "worksheet.route.partial.html"}, &HTMLData{
 		Title:      "Worksheet",
 		Flash:      flash,
 		Worksheets: worksheets,
+		ExportPath: r.URL.Path,
 	})
 }
 
@@ -547,16 +1084,50 @@ func (app *App) ShowWorksheet(w http.ResponseWriter, r *http.Request) {
 		query.MaxResults = maxResults
 	}
 
-	photos, err := db.ListPhotos(worksheet.ID, query)
+	photos, pageInfo, err := db.ListPhotos(worksheet.ID, query)
 	if err != nil {
 		app.ServerError(w, err)
 		return
 	}
 
-	app.RenderHTML(w, r, []string{"worksheet.show.page.html", "worksheet.navbar.html", "photo.index.partial.html", "pagination.partial.html"},
+	pageInfo.ConfigPaginations("/worksheet/"+strconv.Itoa(worksheet.ID)+"?", query.Start)
+
+	compliance, err := db.GetCompliance(worksheet.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	changes, err := db.ListStatusChanges(worksheet.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	completion, err := db.GetCompletion(worksheet.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	flash, err := session.PopString(w, "flash")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"worksheet.show.page.html", "worksheet.navbar.html", "worksheet.map.partial.html", "photo.index.partial.html", "pagination.partial.html"},
 		&HTMLData{
-			Worksheet: worksheet,
-			Photos:    photos,
+			Flash:         flash,
+			Worksheet:     worksheet,
+			Photos:        photos,
+			PageInfo:      pageInfo,
+			Compliance:    compliance,
+			Completion:    completion,
+			Statuses:      models.NextStatuses(worksheet.Status, user.Role),
+			StatusChanges: changes,
+			DeckLinks:     app.deckLinks("/worksheet/"+strconv.Itoa(worksheet.ID)+"/deck.pptx", nil),
 		})
 }
 
@@ -573,11 +1144,15 @@ func (app *App) NewWorksheet(w http.ResponseWriter, r *http.Request) {
 
 	zones, _ := db.ListZones()
 	teams, _ := db.ListTeams()
+	boards, _, _ := db.ListBoards(&forms.Query{MaxResults: -1})
+	campaigns, _ := db.ListCampaigns()
 
-	app.RenderHTML(w, r, []string{"worksheet.new.page.html", "worksheet.navbar.html"},
+	app.RenderHTML(w, r, []string{"worksheet.new.page.html", "worksheet.navbar.html", "zone.suggest.partial.html"},
 		&HTMLData{
-			Zones: zones,
-			Teams: teams,
+			Zones:     zones,
+			Teams:     teams,
+			Boards:    boards,
+			Campaigns: campaigns,
 		})
 }
 
@@ -610,11 +1185,15 @@ func (app *App) EditWorksheet(w http.ResponseWriter, r *http.Request) {
 
 	zones, _ := db.ListZones()
 	teams, _ := db.ListTeams()
+	boards, _, _ := db.ListBoards(&forms.Query{MaxResults: -1})
+	campaigns, _ := db.ListCampaigns()
 
-	app.RenderHTML(w, r, []string{"worksheet.edit.page.html", "worksheet.navbar.html"}, &HTMLData{
+	app.RenderHTML(w, r, []string{"worksheet.edit.page.html", "worksheet.navbar.html", "zone.suggest.partial.html"}, &HTMLData{
 		Worksheet: worksheet,
 		Zones:     zones,
 		Teams:     teams,
+		Boards:    boards,
+		Campaigns: campaigns,
 	})
 }
 
@@ -677,6 +1256,49 @@ func (app *App) SaveWorksheet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var location *models.Location
+	lat, lng, ok, err := f.Coordinates()
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	} else if ok {
+		location = &models.Location{lat, lng}
+	}
+
+	zoneID, err := autoZone(db, f.ZoneID, location, f.BoardID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if zoneID == 0 {
+		f.Failures = map[string]string{"ZoneID": "No zone boundary contains the worksheet location, please pick a zone"}
+		zones, _ := db.ListZones()
+		teams, _ := db.ListTeams()
+		boards, _, _ := db.ListBoards(&forms.Query{MaxResults: -1})
+		campaigns, _ := db.ListCampaigns()
+		page := "worksheet.new.page.html"
+		if worksheetID != 0 {
+			page = "worksheet.edit.page.html"
+		}
+		app.RenderHTML(w, r, []string{page, "worksheet.navbar.html", "zone.suggest.partial.html"}, &HTMLData{
+			Form: &f,
+			Worksheet: &models.Worksheet{
+				ID:       worksheetID,
+				Number:   f.Number,
+				Name:     f.Name,
+				Campaign: f.Campaign,
+				TeamID:   f.TeamID,
+				BoardID:  f.BoardID,
+				Location: location,
+			},
+			Zones:     zones,
+			Teams:     teams,
+			Boards:    boards,
+			Campaigns: campaigns,
+		})
+		return
+	}
+
 	worksheet, err := db.GetWorksheet(worksheetID)
 	if err != nil {
 		app.ServerError(w, err)
@@ -685,10 +1307,13 @@ func (app *App) SaveWorksheet(w http.ResponseWriter, r *http.Request) {
 
 	if worksheet == nil {
 		worksheet = &models.Worksheet{
-			Number: f.Number,
-			Name:   f.Name,
-			ZoneID: f.ZoneID,
-			TeamID: f.TeamID,
+			Number:   f.Number,
+			Name:     f.Name,
+			Campaign: f.Campaign,
+			ZoneID:   zoneID,
+			TeamID:   f.TeamID,
+			BoardID:  f.BoardID,
+			Location: location,
 		}
 		err = db.InsertWorksheet(worksheet)
 		if err != nil {
@@ -698,11 +1323,14 @@ func (app *App) SaveWorksheet(w http.ResponseWriter, r *http.Request) {
 
 	} else {
 		worksheet = &models.Worksheet{
-			ID:     worksheetID,
-			Number: f.Number,
-			Name:   f.Name,
-			ZoneID: f.ZoneID,
-			TeamID: f.TeamID,
+			ID:       worksheetID,
+			Number:   f.Number,
+			Name:     f.Name,
+			Campaign: f.Campaign,
+			ZoneID:   zoneID,
+			TeamID:   f.TeamID,
+			BoardID:  f.BoardID,
+			Location: location,
 		}
 		err = db.UpdateWorksheet(worksheet)
 		if err != nil {
@@ -711,6 +1339,12 @@ func (app *App) SaveWorksheet(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	err = db.RecheckGeofence(worksheet.ID, app.GeofenceRadius)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
 	session := app.Sessions.Load(r)
 	err = session.PutString(w, "flash", "Worksheet was saved successfully!")
 	if err != nil {
@@ -744,24 +1378,9 @@ func (app *App) ShowWorksheetMaps(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := forms.NewQuery()
-	query.Q = r.FormValue("q")
-	query.Start, _ = strconv.Atoi(r.FormValue("start"))
-	maxResults, err := strconv.Atoi(r.FormValue("maxResults"))
-	if err == nil {
-		query.MaxResults = maxResults
-	}
-
-	locations, err := db.ListPhotosMaps(worksheet.ID, app.StoreDir)
-	if err != nil {
-		app.ServerError(w, err)
-		return
-	}
-
-	app.RenderHTML(w, r, []string{"worksheet.maps.page.html", "worksheet.navbar.html"},
+	app.RenderHTML(w, r, []string{"worksheet.maps.page.html", "worksheet.navbar.html", "worksheet.map.partial.html"},
 		&HTMLData{
 			Worksheet: worksheet,
-			Locations: locations,
 		})
 }
 
@@ -787,9 +1406,17 @@ func (app *App) NewPhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.RenderHTML(w, r, []string{"photo.new.page.html", "worksheet.navbar.html"}, &HTMLData{
-		Worksheet: worksheet,
-	})
+	completion, err := db.GetCompletion(worksheet.ID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	data := &HTMLData{Worksheet: worksheet, Completion: completion}
+	if !worksheet.AcceptsPhotos() {
+		data.Error = errWorksheetApproved.Error()
+	}
+	app.RenderHTML(w, r, []string{"photo.new.page.html", "worksheet.navbar.html"}, data)
 }
 
 func (app *App) InsertPhoto(w http.ResponseWriter, r *http.Request) {
@@ -814,60 +1441,59 @@ func (app *App) InsertPhoto(w http.ResponseWriter, r *http.Request) {
 		app.NotFound(w, r)
 		return
 	}
+	if !worksheet.AcceptsPhotos() {
+		app.ClientError(w, errWorksheetApproved, http.StatusConflict)
+		return
+	}
 
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		app.ServerError(w, err)
 		return
 	}
 
-	runningNumber, _ := strconv.Atoi(r.FormValue("running_number"))
-
-	uploadFile, handler, err := r.FormFile("uploadFile")
+	results, err := app.SaveUploadedPhotos(db, r, worksheet.ID)
 	if err != nil {
-		app.ServerError(w, err)
+		app.ClientError(w, err, http.StatusBadRequest)
 		return
 	}
-	defer uploadFile.Close()
 
-	log.Printf("%v", handler.Header)
-	if handler.Filename != "" {
-		f, err := os.OpenFile(app.StoreDir+"/"+strconv.Itoa(worksheet.ID)+"/"+handler.Filename, os.O_WRONLY|os.O_CREATE, 0666)
-		if err != nil {
-			app.ServerError(w, err)
-			return
-		}
-		defer f.Close()
-		io.Copy(f, uploadFile)
-	} else {
+	if len(results) == 0 {
 
 		// form.Failures["Generic"] = "Please select file."
 		// app.RenderHTML(w, r, []string{"photo.new.page.html"}, &HTMLData{Form: form})
 
-		err = session.PutString(w, "flash", "Please choose file!")
-		if err != nil {
-			app.ServerError(w, err)
-			return
-		}
-
+		completion, _ := db.GetCompletion(worksheet.ID)
 		app.RenderHTML(w, r, []string{"photo.new.page.html", "worksheet.navbar.html"}, &HTMLData{
-			Worksheet: worksheet,
+			Worksheet:  worksheet,
+			Completion: completion,
+			Error:      "Please choose file!",
 		})
 		return
 	}
 
-	photo := &models.Photo{
-		WorksheetID:   worksheet.ID,
-		RunningNumber: runningNumber,
-		FileName:      handler.Filename,
+	saved, duplicates, failed := results.Counts()
+	if failed > 0 {
+		completion, _ := db.GetCompletion(worksheet.ID)
+		app.RenderHTML(w, r, []string{"photo.new.page.html", "worksheet.navbar.html"}, &HTMLData{
+			Worksheet:     worksheet,
+			Completion:    completion,
+			Error:         fmt.Sprintf("%d of %d files could not be saved.", failed, len(results)),
+			UploadResults: results,
+		})
+		return
 	}
 
-	err = db.InsertPhoto(photo)
-	if err != nil {
-		app.ServerError(w, err)
-		return
+	flash := "File was saved successfully!"
+	if len(results) == 1 && duplicates == 1 {
+		flash = "This file was already uploaded as No. " + strconv.Itoa(results[0].Photo.RunningNumber) + "."
+	} else if len(results) > 1 {
+		flash = fmt.Sprintf("%d files were saved successfully!", saved)
+		if duplicates > 0 {
+			flash += fmt.Sprintf(" %d were already uploaded.", duplicates)
+		}
 	}
 
-	err = session.PutString(w, "flash", "File was saved successfully!")
+	err = session.PutString(w, "flash", flash)
 	if err != nil {
 		app.ServerError(w, err)
 		return
@@ -877,11 +1503,7 @@ func (app *App) InsertPhoto(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *App) CreateQR(w http.ResponseWriter, r *http.Request) {
-	data := mux.Vars(r)["data"]
-	var png []byte
-	png, _ = qrcode.Encode(data, qrcode.Medium, 256)
-	w.Header().Set("Content-Type", "image/png")
-	w.Write(png)
+	app.writeQR(w, r, mux.Vars(r)["data"], r.URL.Query().Get("format"))
 }
 
 func (app *App) DownloadPhoto(w http.ResponseWriter, r *http.Request) {
@@ -3,17 +3,20 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
-	"io"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-playground/form"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
 	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/search"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
 )
 
 type UserClaims struct {
@@ -87,11 +90,17 @@ type JSONWorksheets struct {
 }
 
 func (j JSONWorksheets) MarshalJSON() ([]byte, error) {
+	type Completion struct {
+		Filled   int `json:"filled"`
+		Required int `json:"required"`
+	}
 	type Worksheet struct {
-		ID      int    `json:"id"`
-		Number  string `json:"number"`
-		Name    string `json:"name"`
-		Created string `json:"created"`
+		ID         int         `json:"id"`
+		Number     string      `json:"number"`
+		Name       string      `json:"name"`
+		Status     string      `json:"status"`
+		Completion *Completion `json:"completion,omitempty"`
+		Created    string      `json:"created"`
 	}
 	worksheets := make([]Worksheet, len(j.Worksheets))
 	for i, v := range j.Worksheets {
@@ -99,59 +108,344 @@ func (j JSONWorksheets) MarshalJSON() ([]byte, error) {
 			ID:      v.ID,
 			Number:  v.Number,
 			Name:    v.Name,
+			Status:  v.Status,
 			Created: v.Created.Format(time.RFC3339),
 		}
+		if v.SlotsRequired > 0 {
+			worksheets[i].Completion = &Completion{v.SlotsFilled, v.SlotsRequired}
+		}
 	}
 	return json.Marshal(worksheets)
 }
 
+type JSONPhoto struct {
+	*models.Photo
+	Host string
+}
+
+func (j JSONPhoto) MarshalJSON() ([]byte, error) {
+	review := j.Review
+	if review == models.ReviewPending {
+		review = "pending"
+	}
+	reviewed := ""
+	if !j.Reviewed.IsZero() {
+		reviewed = j.Reviewed.Format(time.RFC3339)
+	}
+	return json.Marshal(struct {
+		ID            int              `json:"id"`
+		RunningNumber int              `json:"runningNumber"`
+		WorksheetID   int              `json:"worksheetID"`
+		FileURL       string           `json:"fileURL"`
+		Location      string           `json:"location"`
+		Caption       string           `json:"caption"`
+		Slot          string           `json:"slot,omitempty"`
+		UUID          string           `json:"uuid,omitempty"`
+		GPS           *models.Location `json:"gps"`
+		Geofence      string           `json:"geofence"`
+		Distance      *float64         `json:"distance"`
+		QRWorksheetID int              `json:"qrWorksheetID,omitempty"`
+		Review        string           `json:"review"`
+		ReviewReason  string           `json:"reviewReason,omitempty"`
+		ReviewNote    string           `json:"reviewNote,omitempty"`
+		Reviewed      string           `json:"reviewed,omitempty"`
+		Created       string           `json:"created"`
+	}{
+		ID:            j.ID,
+		RunningNumber: j.RunningNumber,
+		WorksheetID:   j.WorksheetID,
+		FileURL:       j.Host + j.FilePath(),
+		Location:      j.Location,
+		Caption:       j.Caption,
+		Slot:          j.Slot,
+		UUID:          j.UUID,
+		GPS:           j.GPS,
+		Geofence:      j.Geofence,
+		Distance:      j.Distance,
+		QRWorksheetID: j.QRWorksheetID,
+		Review:        review,
+		ReviewReason:  j.ReviewReason,
+		ReviewNote:    j.ReviewNote,
+		Reviewed:      reviewed,
+		Created:       j.Created.Format(time.RFC3339),
+	})
+}
+
 type JSONPhotos struct {
 	models.Photos
 	Host string
 }
 
 func (j JSONPhotos) MarshalJSON() ([]byte, error) {
-	type Photo struct {
-		ID            int    `json:"id"`
-		RunningNumber int    `json:"runningNumber"`
-		FileURL       string `json:"fileURL"`
-		Created       string `json:"created"`
-	}
-	photos := make([]Photo, len(j.Photos))
+	photos := make([]JSONPhoto, len(j.Photos))
 	for i, v := range j.Photos {
-		photos[i] = Photo{
-			ID:            v.ID,
-			RunningNumber: v.RunningNumber,
-			FileURL:       j.Host + v.FilePath(),
-			Created:       v.Created.Format(time.RFC3339),
-		}
+		photos[i] = JSONPhoto{v, j.Host}
 	}
 	return json.Marshal(photos)
 }
 
+type JSONBatchResults struct {
+	store.BatchResults
+	Host string
+}
+
+func (j JSONBatchResults) MarshalJSON() ([]byte, error) {
+	type Result struct {
+		FileName string     `json:"fileName"`
+		Status   string     `json:"status"`
+		Error    string     `json:"error,omitempty"`
+		Photo    *JSONPhoto `json:"photo,omitempty"`
+	}
+	results := make([]Result, len(j.BatchResults))
+	for i, v := range j.BatchResults {
+		results[i] = Result{FileName: v.FileName, Status: "created"}
+		if v.Err != nil {
+			results[i].Status = "failed"
+			results[i].Error = v.Err.Error()
+			continue
+		}
+		if v.Duplicate {
+			results[i].Status = "duplicate"
+		}
+		results[i].Photo = &JSONPhoto{v.Photo, j.Host}
+	}
+	return json.Marshal(results)
+}
+
+type JSONSearchResults struct {
+	search.Results
+	Host string
+}
+
+func (j JSONSearchResults) MarshalJSON() ([]byte, error) {
+	type Result struct {
+		Type        string  `json:"type"`
+		ID          int     `json:"id"`
+		WorksheetID int     `json:"worksheetID"`
+		Title       string  `json:"title"`
+		Highlight   string  `json:"highlight"`
+		Score       float64 `json:"score"`
+		URL         string  `json:"url"`
+	}
+	results := make([]Result, len(j.Results))
+	for i, v := range j.Results {
+		results[i] = Result{
+			Type:        v.Type,
+			ID:          v.ID,
+			WorksheetID: v.WorksheetID,
+			Title:       v.Title,
+			Highlight:   v.Highlight,
+			Score:       v.Score,
+			URL:         j.Host + v.Path,
+		}
+	}
+	return json.Marshal(results)
+}
+
+// APIMaxResults caps the page size of API lists.
+const APIMaxResults = 200
+
+// APIQuery reads the page of a list request from its "cursor" parameter,
+// or from "start" and "maxResults" for the first request.
+func (app *App) APIQuery(r *http.Request) (*forms.Query, error) {
+	query := forms.NewQuery()
+	query.Q = r.FormValue("q")
+
+	if s := r.FormValue("cursor"); s != "" {
+		cursor, err := models.DecodeCursor(s)
+		if err != nil {
+			return nil, err
+		}
+		query.Key = cursor.Key
+		query.KeyID = cursor.ID
+		query.Before = cursor.Before
+		query.MaxResults = cursor.MaxResults
+	} else {
+		query.Start, _ = strconv.Atoi(r.FormValue("start"))
+		query.MaxResults = APIMaxResults
+		maxResults, err := strconv.Atoi(r.FormValue("maxResults"))
+		if err == nil {
+			query.MaxResults = maxResults
+		}
+	}
+
+	if query.Start < 0 {
+		query.Start = 0
+	}
+	if query.MaxResults < 1 || query.MaxResults > APIMaxResults {
+		query.MaxResults = APIMaxResults
+	}
+	return query, nil
+}
+
+type JSONChanges struct {
+	*models.Changes
+	Host string
+}
+
+func (j JSONChanges) MarshalJSON() ([]byte, error) {
+	type Worksheet struct {
+		ID        int    `json:"id"`
+		Number    string `json:"number"`
+		Name      string `json:"name"`
+		ZoneID    int    `json:"zoneID"`
+		ZoneName  string `json:"zoneName"`
+		TeamID    int    `json:"teamID"`
+		TeamName  string `json:"teamName"`
+		BoardID   int    `json:"boardID,omitempty"`
+		BoardCode string `json:"boardCode,omitempty"`
+		Status    string `json:"status"`
+		Created   string `json:"created"`
+		Updated   string `json:"updated"`
+	}
+	type Delta struct {
+		Created interface{} `json:"created"`
+		Updated interface{} `json:"updated"`
+		Deleted []int       `json:"deleted"`
+	}
+
+	created := func(t time.Time) bool {
+		return !t.Before(j.Since.Time)
+	}
+
+	worksheets := [2][]Worksheet{{}, {}}
+	for _, v := range j.Worksheets {
+		i := 1
+		if created(v.Created) {
+			i = 0
+		}
+		worksheets[i] = append(worksheets[i], Worksheet{
+			ID:        v.ID,
+			Number:    v.Number,
+			Name:      v.Name,
+			ZoneID:    v.ZoneID,
+			ZoneName:  v.ZoneName,
+			TeamID:    v.TeamID,
+			TeamName:  v.TeamName,
+			BoardID:   v.BoardID,
+			BoardCode: v.BoardCode,
+			Status:    v.Status,
+			Created:   v.Created.Format(time.RFC3339),
+			Updated:   v.Updated.Format(time.RFC3339Nano),
+		})
+	}
+
+	photos := [2]models.Photos{{}, {}}
+	for _, v := range j.Photos {
+		i := 1
+		if created(v.Created) {
+			i = 0
+		}
+		photos[i] = append(photos[i], v)
+	}
+
+	teams := [2]models.Teams{{}, {}}
+	for _, v := range j.Teams {
+		i := 1
+		if created(v.Created) {
+			i = 0
+		}
+		teams[i] = append(teams[i], v)
+	}
+
+	zones := [2]models.Zones{{}, {}}
+	for _, v := range j.Zones {
+		i := 1
+		if created(v.Created) {
+			i = 0
+		}
+		zones[i] = append(zones[i], v)
+	}
+
+	boards := [2]models.Boards{{}, {}}
+	for _, v := range j.Boards {
+		i := 1
+		if created(v.Created) {
+			i = 0
+		}
+		boards[i] = append(boards[i], v)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"token": models.EncodeSyncToken(j.Until),
+		"worksheets": Delta{
+			worksheets[0], worksheets[1], j.Deleted[models.EntityWorksheets],
+		},
+		"photos": Delta{
+			JSONPhotos{photos[0], j.Host}, JSONPhotos{photos[1], j.Host}, j.Deleted[models.EntityPhotos],
+		},
+		"teams": Delta{
+			teams[0], teams[1], j.Deleted[models.EntityTeams],
+		},
+		"zones": Delta{
+			zones[0], zones[1], j.Deleted[models.EntityZones],
+		},
+		"boards": Delta{
+			boards[0], boards[1], j.Deleted[models.EntityBoards],
+		},
+	})
+}
+
 func (app *App) APIListWorksheets(w http.ResponseWriter, r *http.Request) {
+	query, err := app.APIQuery(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if status := r.FormValue("status"); status != "" {
+		if !models.ValidStatus(status) {
+			app.APIClientErrorWithMessage(w, http.StatusBadRequest, "status must be one of "+strings.Join(models.Statuses, ", "))
+			return
+		}
+		query.Status = status
+	}
+	query.Incomplete = r.FormValue("incomplete") == "1"
+
 	db := &models.Database{connect(app.DSN)}
 	defer db.Close()
 
-	query := forms.NewQuery()
-	query.Q = r.FormValue("q")
-	query.MaxResults = 200
+	worksheets, pageInfo, err := db.ListWorksheets(query)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
 
-	worksheets, _, err := db.ListWorksheets(query)
-	if err == sql.ErrNoRows {
-		app.APINotFound(w, r)
+	b, err := json.Marshal(map[string]interface{}{
+		"worksheets": JSONWorksheets{worksheets, app.baseURL(r)},
+		"pageInfo":   pageInfo,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
 		return
-	} else if err != nil {
-		app.ServerError(w, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (app *App) APIListTeams(w http.ResponseWriter, r *http.Request) {
+	query, err := app.APIQuery(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	teams, pageInfo, err := db.ListTeamsPaged(query)
+	if err != nil {
+		app.APIServerError(w, err)
 		return
 	}
 
 	b, err := json.Marshal(map[string]interface{}{
-		"worksheets": JSONWorksheets{worksheets, "http://" + r.Host},
+		"teams":    teams,
+		"pageInfo": pageInfo,
 	})
 	if err != nil {
-		log.Fatal(err)
-		app.ServerError(w, err)
+		app.APIServerError(w, err)
 		return
 	}
 
@@ -159,26 +453,57 @@ func (app *App) APIListWorksheets(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
-func (app *App) APIListWorksheetsByTeam(w http.ResponseWriter, r *http.Request) {
-	teamID, _ := strconv.Atoi(mux.Vars(r)["team_id"])
+func (app *App) APIListZones(w http.ResponseWriter, r *http.Request) {
+	query, err := app.APIQuery(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	db := &models.Database{connect(app.DSN)}
 	defer db.Close()
-	worksheets, err := db.ListWorksheetsByTeam(teamID)
-	if err == sql.ErrNoRows {
-		app.APINotFound(w, r)
+
+	zones, pageInfo, err := db.ListZonesPaged(query)
+	if err != nil {
+		app.APIServerError(w, err)
 		return
-	} else if err != nil {
-		app.ServerError(w, err)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"zones":    zones,
+		"pageInfo": pageInfo,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// APIShowZone returns a zone with its boundary.
+func (app *App) APIShowZone(w http.ResponseWriter, r *http.Request) {
+	zoneID, _ := strconv.Atoi(mux.Vars(r)["zone_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	zone, err := db.GetZone(zoneID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if zone == nil {
+		app.APINotFound(w, r)
 		return
 	}
 
 	b, err := json.Marshal(map[string]interface{}{
-		"worksheets": JSONWorksheets{worksheets, "http://" + r.Host},
+		"zone": zone,
 	})
 	if err != nil {
-		log.Fatal(err)
-		app.ServerError(w, err)
+		app.APIServerError(w, err)
 		return
 	}
 
@@ -186,44 +511,71 @@ func (app *App) APIListWorksheetsByTeam(w http.ResponseWriter, r *http.Request)
 	w.Write(b)
 }
 
-func (app *App) APIShowWorksheet(w http.ResponseWriter, r *http.Request) {
-	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+// APISaveZoneBoundary replaces the boundary of a zone with the polygons of
+// the GeoJSON or KML request body. DELETE removes the boundary.
+func (app *App) APISaveZoneBoundary(w http.ResponseWriter, r *http.Request) {
+	zoneID, _ := strconv.Atoi(mux.Vars(r)["zone_id"])
 
 	db := &models.Database{connect(app.DSN)}
 	defer db.Close()
 
-	worksheet, err := db.GetWorksheet(worksheetID)
-	if err == sql.ErrNoRows {
+	zone, err := db.GetZone(zoneID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if zone == nil {
 		app.APINotFound(w, r)
 		return
-	} else if err != nil {
-		app.ServerError(w, err)
+	}
+
+	var boundary geo.MultiPolygon
+	if r.Method != http.MethodDelete {
+		features, err := readBoundaries(r.Body)
+		if err != nil {
+			app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		boundary = mergeBoundaries(features)
+	}
+
+	err = db.SetZoneBoundary(zoneID, boundary)
+	if err != nil {
+		app.APIServerError(w, err)
 		return
 	}
 
-	query := forms.NewQuery()
-	query.Q = r.FormValue("q")
-	query.Start, _ = strconv.Atoi(r.FormValue("start"))
-	maxResults, err := strconv.Atoi(r.FormValue("maxResults"))
-	if err == nil {
-		query.MaxResults = maxResults
+	app.APIShowZone(w, r)
+}
+
+// APIImportZones sets zone boundaries from the named features of the
+// GeoJSON or KML request body. With create=true unknown names become new
+// zones; with dryRun=true nothing is saved.
+func (app *App) APIImportZones(w http.ResponseWriter, r *http.Request) {
+	create, _ := strconv.ParseBool(r.URL.Query().Get("create"))
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+	features, err := readBoundaries(r.Body)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	photos, err := db.ListPhotos(worksheet.ID, query)
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	results, err := db.ImportZoneBoundaries(features, create, dryRun)
 	if err != nil {
-		app.ServerError(w, err)
+		app.APIServerError(w, err)
 		return
 	}
 
-	p := JSONPhotos{photos, "http://" + r.Host}
 	b, err := json.Marshal(map[string]interface{}{
-		"worksheet": worksheet,
-		"photos":    p,
+		"results": results,
+		"dryRun":  dryRun,
 	})
-
 	if err != nil {
-		log.Fatal(err)
-		app.ServerError(w, err)
+		app.APIServerError(w, err)
 		return
 	}
 
@@ -231,67 +583,867 @@ func (app *App) APIShowWorksheet(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
-func (app *App) APIInsertPhoto(w http.ResponseWriter, r *http.Request) {
-	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+// APILocateZone returns the zone whose boundary contains lat and lng, or
+// null.
+func (app *App) APILocateZone(w http.ResponseWriter, r *http.Request) {
+	lat, err := strconv.ParseFloat(r.FormValue("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "lat must be a number within ±90")
+		return
+	}
+	lng, err := strconv.ParseFloat(r.FormValue("lng"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "lng must be a number within ±180")
+		return
+	}
 
 	db := &models.Database{connect(app.DSN)}
 	defer db.Close()
 
-	worksheet, err := db.GetWorksheet(worksheetID)
+	zone, err := db.ZoneAt(lat, lng)
 	if err != nil {
-		app.ServerError(w, err)
+		app.APIServerError(w, err)
 		return
 	}
-	if worksheet == nil {
-		app.NotFound(w, r)
+
+	var j interface{}
+	if zone != nil {
+		j = map[string]interface{}{"id": zone.ID, "name": zone.Name}
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"zone": j,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
 		return
 	}
 
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		app.ServerError(w, err)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+type JSONZoneOutliers struct {
+	Outliers []*models.ZoneOutlier
+	Host     string
+}
+
+func (j JSONZoneOutliers) MarshalJSON() ([]byte, error) {
+	type zoneRef struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	type jsonOutlier struct {
+		Photo     JSONPhoto `json:"photo"`
+		Worksheet struct {
+			ID     int     `json:"id"`
+			Number string  `json:"number"`
+			Name   string  `json:"name"`
+			Zone   zoneRef `json:"zone"`
+		} `json:"worksheet"`
+		TakenIn *zoneRef `json:"takenIn"`
+	}
+
+	outliers := []jsonOutlier{}
+	for _, v := range j.Outliers {
+		o := jsonOutlier{Photo: JSONPhoto{v.Photo, j.Host}}
+		o.Worksheet.ID = v.Worksheet.ID
+		o.Worksheet.Number = v.Worksheet.Number
+		o.Worksheet.Name = v.Worksheet.Name
+		o.Worksheet.Zone = zoneRef{v.Worksheet.ZoneID, v.Worksheet.ZoneName}
+		if v.TakenIn != nil {
+			o.TakenIn = &zoneRef{v.TakenIn.ID, v.TakenIn.Name}
+		}
+		outliers = append(outliers, o)
 	}
+	return json.Marshal(outliers)
+}
 
-	runningNumber, _ := strconv.Atoi(r.FormValue("running_number"))
+// APIZoneOutliers reports photos taken outside the boundary of their
+// worksheet's zone, optionally for one zone_id.
+func (app *App) APIZoneOutliers(w http.ResponseWriter, r *http.Request) {
+	zoneID, _ := strconv.Atoi(r.FormValue("zone_id"))
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
 
-	uploadFile, handler, err := r.FormFile("uploadFile")
+	outliers, err := db.ListZoneOutliers(zoneID)
 	if err != nil {
-		app.ServerError(w, err)
+		app.APIServerError(w, err)
 		return
 	}
-	defer uploadFile.Close()
-
-	log.Printf("%v", handler.Header)
 
-	fileDir := app.StoreDir + "/" + strconv.Itoa(worksheet.ID)
-	os.MkdirAll(fileDir, os.ModePerm)
-	f, err := os.OpenFile(fileDir+"/"+handler.Filename, os.O_WRONLY|os.O_CREATE, 0666)
+	b, err := json.Marshal(map[string]interface{}{
+		"outliers": JSONZoneOutliers{outliers, app.baseURL(r)},
+	})
 	if err != nil {
-		log.Println(err)
+		app.APIServerError(w, err)
 		return
 	}
-	defer f.Close()
-	io.Copy(f, uploadFile)
 
-	photo := &models.Photo{
-		WorksheetID:   worksheet.ID,
-		RunningNumber: runningNumber,
-		FileName:      handler.Filename,
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (app *App) APISearch(w http.ResponseWriter, r *http.Request) {
+	q := r.FormValue("q")
+	maxResults, err := strconv.Atoi(r.FormValue("maxResults"))
+	if err != nil || maxResults < 1 {
+		maxResults = forms.NewQuery().MaxResults
 	}
 
-	err = db.InsertPhoto(photo)
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	results, err := app.Search(db, q, maxResults)
 	if err != nil {
-		app.ServerError(w, err)
+		app.APIServerError(w, err)
 		return
 	}
 
 	b, err := json.Marshal(map[string]interface{}{
-		"status": "Success",
+		"q":       q,
+		"results": JSONSearchResults{results, app.baseURL(r)},
 	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
 
+// APISync returns everything that changed since the "since" token, so an
+// offline client only downloads the delta. The response carries the token
+// for the next call. Inspectors get the worksheets and photos of their
+// team; supervisors and admins get every team's, or those of "team_id".
+func (app *App) APISync(w http.ResponseWriter, r *http.Request) {
+	since, err := models.DecodeSyncToken(r.FormValue("since"))
 	if err != nil {
-		log.Fatal(err)
-		app.ServerError(w, err)
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	// Tokens don't carry the role or team, which may have changed since
+	// login.
+	user, err := db.UserInfo(app.CurrentUser(r).ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if user == nil {
+		app.APIClientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	teamID := user.TeamID
+	if user.Role != models.RoleInspector {
+		teamID, _ = strconv.Atoi(r.FormValue("team_id"))
+	} else if teamID == 0 {
+		app.APIClientErrorWithMessage(w, http.StatusForbidden, "user is not in a team")
+		return
+	}
+
+	changes, err := db.ListChanges(since, teamID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(JSONChanges{changes, app.baseURL(r)})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (app *App) APIListWorksheetsByTeam(w http.ResponseWriter, r *http.Request) {
+	teamID, _ := strconv.Atoi(mux.Vars(r)["team_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+	worksheets, err := db.ListWorksheetsByTeam(teamID)
+	if err == sql.ErrNoRows {
+		app.APINotFound(w, r)
+		return
+	} else if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"worksheets": JSONWorksheets{worksheets, app.baseURL(r)},
+	})
+	if err != nil {
+		log.Fatal(err)
+		app.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (app *App) APIShowWorksheet(w http.ResponseWriter, r *http.Request) {
+	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+
+	query, err := app.APIQuery(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	worksheet, err := db.GetWorksheet(worksheetID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.APINotFound(w, r)
+		return
+	}
+
+	photos, pageInfo, err := db.ListPhotos(worksheet.ID, query)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	compliance, err := db.GetCompliance(worksheet.ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	changes, err := db.ListStatusChanges(worksheet.ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	completion, err := db.GetCompletion(worksheet.ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	p := JSONPhotos{photos, app.baseURL(r)}
+	b, err := json.Marshal(map[string]interface{}{
+		"worksheet":     worksheet,
+		"photos":        p,
+		"pageInfo":      pageInfo,
+		"compliance":    compliance,
+		"completion":    completion,
+		"statusChanges": changes,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (app *App) APIListPhotos(w http.ResponseWriter, r *http.Request) {
+	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+
+	query, err := app.APIQuery(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	worksheet, err := db.GetWorksheet(worksheetID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.APINotFound(w, r)
+		return
+	}
+
+	photos, pageInfo, err := db.ListPhotos(worksheet.ID, query)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"photos":   JSONPhotos{photos, app.baseURL(r)},
+		"pageInfo": pageInfo,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+type JSONMarkers struct {
+	models.Photos
+	Host string
+}
+
+// MarshalJSON writes the photos that have a GPS position as map markers.
+func (j JSONMarkers) MarshalJSON() ([]byte, error) {
+	type marker struct {
+		ID            int      `json:"id"`
+		RunningNumber int      `json:"runningNumber"`
+		Lat           float64  `json:"lat"`
+		Lng           float64  `json:"lng"`
+		FileURL       string   `json:"fileURL"`
+		Caption       string   `json:"caption"`
+		Geofence      string   `json:"geofence"`
+		Distance      *float64 `json:"distance"`
+		Created       string   `json:"created"`
+	}
+
+	markers := []marker{}
+	for _, v := range j.Photos {
+		if v.GPS == nil {
+			continue
+		}
+		markers = append(markers, marker{
+			ID:            v.ID,
+			RunningNumber: v.RunningNumber,
+			Lat:           v.GPS.Lat,
+			Lng:           v.GPS.Lng,
+			FileURL:       j.Host + v.FilePath(),
+			Caption:       v.Caption,
+			Geofence:      v.Geofence,
+			Distance:      v.Distance,
+			Created:       v.Created.Format(time.RFC3339),
+		})
+	}
+	return json.Marshal(markers)
+}
+
+// APIWorksheetMarkers returns the map markers of a worksheet: its photos
+// with a GPS position and where they were expected to be taken.
+func (app *App) APIWorksheetMarkers(w http.ResponseWriter, r *http.Request) {
+	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	worksheet, err := db.GetWorksheet(worksheetID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.APINotFound(w, r)
+		return
+	}
+
+	photos, _, err := db.ListPhotos(worksheet.ID, &forms.Query{MaxResults: -1})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	expected, err := db.ExpectedLocation(worksheet.ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"expected": expected,
+		"radius":   app.GeofenceRadius,
+		"markers":  JSONMarkers{photos, app.baseURL(r)},
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (app *App) APIInsertPhoto(w http.ResponseWriter, r *http.Request) {
+	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	worksheet, err := db.GetWorksheet(worksheetID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.APINotFound(w, r)
+		return
+	}
+	if !worksheet.AcceptsPhotos() {
+		app.APIClientErrorWithMessage(w, http.StatusConflict, errWorksheetApproved.Error())
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	uuid := r.FormValue("uuid")
+	if uuid != "" && !forms.ValidUUID(uuid) {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "uuid is not a valid UUID")
+		return
+	}
+
+	results, err := app.SaveUploadedPhotos(db, r, worksheet.ID)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	app.APIUploadResults(w, r, worksheet.ID, results)
+}
+
+// APIUploadResults writes the results of saving the files of an upload to
+// a worksheet, or to the inbox.
+func (app *App) APIUploadResults(w http.ResponseWriter, r *http.Request, worksheetID int, results store.BatchResults) {
+	if len(results) == 0 {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "uploadFile is required")
+		return
+	}
+
+	if len(results) == 1 {
+		if err, ok := results[0].Err.(*store.ValidationError); ok {
+			app.APIClientErrorWithMessage(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+
+	status := "Success"
+	saved, duplicates, failed := results.Counts()
+	if failed == len(results) {
+		status = "Failed"
+	} else if failed > 0 {
+		status = "Partial"
+	}
+
+	response := map[string]interface{}{
+		"status":     status,
+		"saved":      saved,
+		"duplicates": duplicates,
+		"failed":     failed,
+		"results":    JSONBatchResults{results, app.baseURL(r)},
+	}
+
+	// Single file uploads keep the fields clients used before batches.
+	if len(results) == 1 && results[0].Err == nil {
+		photo := results[0].Photo
+		if results[0].Duplicate && worksheetID != models.InboxWorksheetID && photo.WorksheetID != worksheetID {
+			app.APIClientErrorWithMessage(w, http.StatusConflict, "uuid belongs to a photo of another worksheet")
+			return
+		}
+		response["duplicate"] = results[0].Duplicate
+		response["photo"] = JSONPhoto{photo, app.baseURL(r)}
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (app *App) APIListBoards(w http.ResponseWriter, r *http.Request) {
+	query, err := app.APIQuery(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	boards, pageInfo, err := db.ListBoards(query)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"boards":   boards,
+		"pageInfo": pageInfo,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// APIShowBoard returns a board with its inspection history.
+func (app *App) APIShowBoard(w http.ResponseWriter, r *http.Request) {
+	boardID, _ := strconv.Atoi(mux.Vars(r)["board_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	board, err := db.GetBoard(boardID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if board == nil {
+		app.APINotFound(w, r)
+		return
+	}
+
+	inspections, err := db.ListBoardInspections(board.ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	type Inspection struct {
+		Worksheet *models.Worksheet `json:"worksheet"`
+		Photos    JSONPhotos        `json:"photos"`
+	}
+	history := make([]Inspection, len(inspections))
+	for i, v := range inspections {
+		history[i] = Inspection{v.Worksheet, JSONPhotos{v.Photos, app.baseURL(r)}}
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"board":       board,
+		"inspections": history,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// APISaveBoard creates a board, or updates the board in the path. It takes
+// the same form fields as the board pages.
+func (app *App) APISaveBoard(w http.ResponseWriter, r *http.Request) {
+	boardID, _ := strconv.Atoi(mux.Vars(r)["board_id"])
+
+	if err := r.ParseForm(); err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var f forms.Board
+	err := form.NewDecoder().Decode(&f, r.PostForm)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !f.Valid(models.BoardTypes) {
+		app.APIValidationError(w, f.Failures)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	if boardID != 0 {
+		board, err := db.GetBoard(boardID)
+		if err != nil {
+			app.APIServerError(w, err)
+			return
+		}
+		if board == nil {
+			app.APINotFound(w, r)
+			return
+		}
+	}
+
+	board := &models.Board{
+		ID:     boardID,
+		Code:   f.Code,
+		Name:   f.Name,
+		Lat:    f.Lat,
+		Lng:    f.Lng,
+		Size:   f.Size,
+		Facing: f.Facing,
+		Type:   f.Type,
+		Owner:  f.Owner,
+		ZoneID: f.ZoneID,
+	}
+	if f.Lat != 0 || f.Lng != 0 {
+		board.ZoneID, err = autoZone(db, f.ZoneID, &models.Location{f.Lat, f.Lng}, 0)
+		if err != nil {
+			app.APIServerError(w, err)
+			return
+		}
+	}
+	status := http.StatusOK
+	if boardID == 0 {
+		err = db.InsertBoard(board)
+		status = http.StatusCreated
+	} else {
+		err = db.UpdateBoard(board)
+	}
+	if err == models.ErrDuplicateBoardCode {
+		app.APIValidationError(w, map[string]string{"Code": "Another board has this code"})
+		return
+	} else if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if boardID != 0 {
+		err = db.RecheckBoardGeofence(boardID, app.GeofenceRadius)
+		if err != nil {
+			app.APIServerError(w, err)
+			return
+		}
+	}
+
+	board, err = db.GetBoard(board.ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"board": board,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (app *App) APIDeleteBoard(w http.ResponseWriter, r *http.Request) {
+	boardID, _ := strconv.Atoi(mux.Vars(r)["board_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	board, err := db.GetBoard(boardID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if board == nil {
+		app.APINotFound(w, r)
+		return
+	}
+
+	err = db.DeleteBoard(board.ID)
+	if err == models.ErrBoardInUse {
+		app.APIClientErrorWithMessage(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APINearbyArea reads the area of a nearby search and the most results to
+// return. The area is nil when the search is not valid, with the failures
+// in the returned form.
+func (app *App) APINearbyArea(r *http.Request) (*models.Area, int, *forms.Nearby, error) {
+	f := &forms.Nearby{}
+	if err := form.NewDecoder().Decode(f, r.URL.Query()); err != nil {
+		return nil, 0, nil, err
+	}
+	if !f.Valid() {
+		return nil, 0, f, nil
+	}
+
+	limit, err := strconv.Atoi(r.FormValue("maxResults"))
+	if err != nil || limit < 1 || limit > APIMaxResults {
+		limit = APIMaxResults
+	}
+
+	lat, lng, hasPoint := f.Point()
+	if minLat, minLng, maxLat, maxLng, ok := f.Bounds(); ok {
+		area := models.AreaWithin(minLat, minLng, maxLat, maxLng)
+		if hasPoint {
+			area.Center = models.Location{lat, lng}
+		}
+		return area, limit, f, nil
+	}
+	return models.AreaAround(models.Location{lat, lng}, f.Radius), limit, f, nil
+}
+
+// APINearbyWorksheets returns the worksheets around a point or in a
+// bounding box, nearest first.
+func (app *App) APINearbyWorksheets(w http.ResponseWriter, r *http.Request) {
+	area, limit, f, err := app.APINearbyArea(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if area == nil {
+		app.APIValidationError(w, f.Failures)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	nearby, err := db.NearbyWorksheets(area, limit)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	type Worksheet struct {
+		ID        int              `json:"id"`
+		Number    string           `json:"number"`
+		Name      string           `json:"name"`
+		ZoneID    int              `json:"zoneID"`
+		TeamID    int              `json:"teamID"`
+		BoardID   int              `json:"boardID"`
+		BoardCode string           `json:"boardCode"`
+		Location  *models.Location `json:"location"`
+		Created   string           `json:"created"`
+	}
+	type Result struct {
+		Worksheet Worksheet `json:"worksheet"`
+		Distance  float64   `json:"distance"`
+	}
+	results := []Result{}
+	for _, v := range nearby {
+		results = append(results, Result{
+			Worksheet: Worksheet{
+				ID:        v.Worksheet.ID,
+				Number:    v.Worksheet.Number,
+				Name:      v.Worksheet.Name,
+				ZoneID:    v.Worksheet.ZoneID,
+				TeamID:    v.Worksheet.TeamID,
+				BoardID:   v.Worksheet.BoardID,
+				BoardCode: v.Worksheet.BoardCode,
+				Location:  v.Location,
+				Created:   v.Worksheet.Created.Format(time.RFC3339),
+			},
+			Distance: v.Distance,
+		})
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"center":     area.Center,
+		"worksheets": results,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// APINearbyBoards returns the boards around a point or in a bounding box,
+// nearest first.
+func (app *App) APINearbyBoards(w http.ResponseWriter, r *http.Request) {
+	area, limit, f, err := app.APINearbyArea(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if area == nil {
+		app.APIValidationError(w, f.Failures)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	nearby, err := db.NearbyBoards(area, limit)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	type Result struct {
+		Board    *models.Board `json:"board"`
+		Distance float64       `json:"distance"`
+	}
+	results := []Result{}
+	for _, v := range nearby {
+		results = append(results, Result{v.Board, v.Distance})
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"center": area.Center,
+		"boards": results,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// APINearbyPhotos returns the photos taken around a point or in a bounding
+// box, nearest first.
+func (app *App) APINearbyPhotos(w http.ResponseWriter, r *http.Request) {
+	area, limit, f, err := app.APINearbyArea(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if area == nil {
+		app.APIValidationError(w, f.Failures)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	nearby, err := db.NearbyPhotos(area, limit)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	type Result struct {
+		Photo    JSONPhoto `json:"photo"`
+		Distance float64   `json:"distance"`
+	}
+	results := []Result{}
+	for _, v := range nearby {
+		results = append(results, Result{JSONPhoto{v.Photo, app.baseURL(r)}, v.Distance})
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"center": area.Center,
+		"photos": results,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
 		return
 	}
 
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/form"
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+var errUnknownSlot = errors.New("slot is not one of the checklist of the worksheet")
+
+// blankSlotRows is how many empty rows of slots the checklist form offers.
+const blankSlotRows = 3
+
+// withBlankSlots returns the checklist with room for more slots in its form.
+func withBlankSlots(c *models.Checklist) *models.Checklist {
+	rows := *c
+	rows.Slots = append([]*models.ChecklistSlot{}, c.Slots...)
+	for i := 0; i < blankSlotRows; i++ {
+		rows.Slots = append(rows.Slots, &models.ChecklistSlot{})
+	}
+	return &rows
+}
+
+func (app *App) IndexChecklist(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	checklists, err := db.ListChecklists()
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	flash, err := session.PopString(w, "flash")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"checklist.index.page.html"}, &HTMLData{
+		Title:      "Checklist",
+		Flash:      flash,
+		Checklists: checklists,
+	})
+}
+
+func (app *App) NewChecklist(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	zones, _ := db.ListZones()
+
+	app.RenderHTML(w, r, []string{"checklist.new.page.html", "checklist.form.partial.html"}, &HTMLData{
+		Checklist:  withBlankSlots(&models.Checklist{Slots: models.DefaultChecklistSlots}),
+		BoardTypes: models.BoardTypes,
+		Zones:      zones,
+	})
+}
+
+func (app *App) EditChecklist(w http.ResponseWriter, r *http.Request) {
+	checklistID, _ := strconv.Atoi(mux.Vars(r)["checklist_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	checklist, err := db.GetChecklist(checklistID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if checklist == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	zones, _ := db.ListZones()
+
+	app.RenderHTML(w, r, []string{"checklist.edit.page.html", "checklist.form.partial.html"}, &HTMLData{
+		Checklist:  withBlankSlots(checklist),
+		BoardTypes: models.BoardTypes,
+		Zones:      zones,
+	})
+}
+
+func (app *App) SaveChecklist(w http.ResponseWriter, r *http.Request) {
+	checklistID, _ := strconv.Atoi(mux.Vars(r)["checklist_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	decoder := form.NewDecoder()
+
+	var f forms.Checklist
+	err := decoder.Decode(&f, r.PostForm)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if checklistID != 0 {
+		checklist, err := db.GetChecklist(checklistID)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		if checklist == nil {
+			app.NotFound(w, r)
+			return
+		}
+	}
+
+	valid := f.Valid(models.BoardTypes)
+	checklist := &models.Checklist{
+		ID:        checklistID,
+		Name:      f.Name,
+		ZoneID:    f.ZoneID,
+		BoardType: f.BoardType,
+		Slots:     []*models.ChecklistSlot{},
+	}
+	for _, s := range f.Slots {
+		checklist.Slots = append(checklist.Slots, &models.ChecklistSlot{Code: s.Code, Name: s.Name, Lit: s.Lit})
+	}
+
+	if valid {
+		if checklistID == 0 {
+			err = db.InsertChecklist(checklist)
+		} else {
+			err = db.UpdateChecklist(checklist)
+		}
+		if err == models.ErrDuplicateChecklist {
+			f.Failures["ZoneID"] = "Another checklist is for this zone and board type"
+		} else if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+	}
+
+	if len(f.Failures) > 0 {
+		zones, _ := db.ListZones()
+		page := "checklist.new.page.html"
+		if checklistID != 0 {
+			page = "checklist.edit.page.html"
+		}
+		app.RenderHTML(w, r, []string{page, "checklist.form.partial.html"}, &HTMLData{
+			Form:       &f,
+			Checklist:  withBlankSlots(checklist),
+			BoardTypes: models.BoardTypes,
+			Zones:      zones,
+		})
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	err = session.PutString(w, "flash", "Checklist was saved successfully!")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/checklists", http.StatusSeeOther)
+}
+
+func (app *App) DeleteChecklist(w http.ResponseWriter, r *http.Request) {
+	checklistID, _ := strconv.Atoi(mux.Vars(r)["checklist_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	if checklistID == 0 {
+		app.NotFound(w, r)
+		return
+	}
+
+	err := db.DeleteChecklist(checklistID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	err = session.PutString(w, "flash", "Checklist was deleted successfully!")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/checklists", http.StatusSeeOther)
+}
+
+// SetPhotoSlot files a photo of a worksheet under the checklist slot
+// posted, or under none.
+func (app *App) SetPhotoSlot(w http.ResponseWriter, r *http.Request) {
+	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+	photoID, _ := strconv.Atoi(mux.Vars(r)["photo_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	photo, err := db.GetPhoto(photoID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if photo == nil || photo.WorksheetID != worksheetID {
+		app.NotFound(w, r)
+		return
+	}
+
+	slot := r.PostFormValue("slot")
+	err = db.CheckSlot(worksheetID, slot)
+	if err == nil {
+		err = db.SetPhotoSlot(photo.ID, slot)
+	}
+	var flash string
+	switch err {
+	case nil:
+		flash = "Photo No. " + strconv.Itoa(photo.RunningNumber) + " was saved successfully!"
+	case models.ErrWorksheetApproved:
+		flash = errWorksheetApproved.Error()
+	case models.ErrUnknownSlot:
+		app.ClientError(w, errUnknownSlot, http.StatusBadRequest)
+		return
+	default:
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	if err := session.PutString(w, "flash", flash); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/worksheet/"+strconv.Itoa(worksheetID), http.StatusSeeOther)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/deck"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// DeckLink links to a deck made with one of the slide templates.
+type DeckLink struct {
+	Name string
+	URL  string
+}
+
+// deckLinks links to the deck at path with each slide template, or with the
+// default one when there are not several.
+func (app *App) deckLinks(path string, query url.Values) []DeckLink {
+	if len(app.DeckTemplates) < 2 {
+		u := path
+		if len(query) > 0 {
+			u += "?" + query.Encode()
+		}
+		return []DeckLink{{"PPTX", u}}
+	}
+	links := []DeckLink{}
+	for _, t := range app.DeckTemplates {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("template", t.Name)
+		links = append(links, DeckLink{"PPTX " + t.Name, path + "?" + q.Encode()})
+	}
+	return links
+}
+
+// deckTemplate returns the slide template named by the template query
+// parameter, by default the first one configured.
+func (app *App) deckTemplate(r *http.Request) (*deck.Template, error) {
+	name := r.URL.Query().Get("template")
+	if len(app.DeckTemplates) == 0 {
+		if name == "" || name == deck.DefaultTemplate.Name {
+			return deck.DefaultTemplate, nil
+		}
+	}
+	for _, t := range app.DeckTemplates {
+		if name == "" || t.Name == name {
+			return t, nil
+		}
+	}
+	return nil, errors.New("unknown slide template " + strconv.Quote(name))
+}
+
+// slides loads a slide for each photo of the worksheets, in running number
+// order. Like inspections, each worksheet is loaded again with its zone,
+// team and board.
+func (app *App) slides(db *models.Database, worksheets models.Worksheets) ([]*deck.Slide, error) {
+	slides := []*deck.Slide{}
+	for _, listed := range worksheets {
+		worksheet, err := db.GetWorksheet(listed.ID)
+		if err != nil {
+			return nil, err
+		}
+		if worksheet == nil {
+			continue
+		}
+		expected, err := db.ExpectedLocation(worksheet.ID)
+		if err != nil {
+			return nil, err
+		}
+		photos, err := db.ListTakenPhotos(&forms.PhotoFilter{WorksheetID: worksheet.ID})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range photos {
+			slides = append(slides, &deck.Slide{Worksheet: worksheet, Expected: expected, Photo: p})
+		}
+	}
+	return slides, nil
+}
+
+// writeDeck writes the deck of worksheets made with t as an attachment
+// named name. Decks hold large photos, so they are built in a temporary
+// file rather than in memory.
+func (app *App) writeDeck(w http.ResponseWriter, db *models.Database, t *deck.Template, name, title string, worksheets models.Worksheets) error {
+	slides, err := app.slides(db, worksheets)
+	if err != nil {
+		return err
+	}
+
+	s := app.PhotoStore()
+	if err := os.MkdirAll(s.TempDir(), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.TempDir(), "deck-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	d := &deck.Deck{Store: s, Tiles: app.Tiles}
+	if err := d.Write(tmp, title, t, slides); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.presentationml.presentation")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.pptx"`)
+	_, err = io.Copy(w, tmp)
+	return err
+}
+
+// WorksheetDeck downloads the proof of posting deck of a worksheet.
+func (app *App) WorksheetDeck(w http.ResponseWriter, r *http.Request) {
+	t, err := app.deckTemplate(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	id, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+	worksheet, err := db.GetWorksheet(id)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	name := "deck-worksheet-" + strconv.Itoa(worksheet.ID)
+	title := worksheet.Number + " " + worksheet.Name
+	if err := app.writeDeck(w, db, t, name, title, models.Worksheets{worksheet}); err != nil {
+		app.ServerError(w, err)
+	}
+}
+
+// BatchDeck downloads one deck of every worksheet of a date, or of the
+// campaign named by the name query parameter.
+func (app *App) BatchDeck(w http.ResponseWriter, r *http.Request) {
+	t, err := app.deckTemplate(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	var name, title string
+	var worksheets models.Worksheets
+	if date, ok := mux.Vars(r)["date"]; ok {
+		name = "deck-" + date
+		title = "Proof of posting " + date
+		worksheets, err = db.ListWorksheetsByDate(date)
+	} else {
+		campaign := r.URL.Query().Get("name")
+		if campaign == "" {
+			app.ClientError(w, errors.New("choose a campaign name"), http.StatusBadRequest)
+			return
+		}
+		name = "deck-campaign"
+		title = campaign
+		worksheets, err = db.ListWorksheetsByCampaign(campaign)
+	}
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	if err := app.writeDeck(w, db, t, name, title, worksheets); err != nil {
+		app.ServerError(w, err)
+	}
+}
+
+// IndexWorksheetByCampaign lists the worksheets of the campaign named by the
+// name query parameter.
+func (app *App) IndexWorksheetByCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign := r.URL.Query().Get("name")
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	worksheets, err := db.ListWorksheetsByCampaign(campaign)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	flash, err := session.PopString(w, "flash")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"worksheet.index.page.html", "worksheet.route.partial.html"}, &HTMLData{
+		Title:      "Campaign - " + campaign,
+		Flash:      flash,
+		Worksheets: worksheets,
+		DeckLinks:  app.deckLinks("/worksheet/campaign/deck.pptx", url.Values{"name": {campaign}}),
+	})
+}
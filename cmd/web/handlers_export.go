@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/form"
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
+)
+
+var exportContentTypes = map[string]string{
+	"geojson": "application/geo+json",
+	"kml":     "application/vnd.google-earth.kml+xml",
+	"gpx":     "application/gpx+xml",
+}
+
+// exportFilter reads the photos to export from the path, for the page
+// routes, or from the query string. Something must be selected.
+func exportFilter(r *http.Request) (*forms.PhotoFilter, error) {
+	f, err := photoFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	if f.WorksheetID == 0 && f.Date == "" && f.ZoneID == 0 && f.TeamID == 0 {
+		return nil, errors.New("choose a worksheet_id, date, zone_id or team_id to export")
+	}
+	return f, nil
+}
+
+// photoFilter reads a filter from the query string and the path.
+func photoFilter(r *http.Request) (*forms.PhotoFilter, error) {
+	f := &forms.PhotoFilter{}
+	if err := form.NewDecoder().Decode(f, r.URL.Query()); err != nil {
+		return nil, err
+	}
+
+	vars := mux.Vars(r)
+	if s, ok := vars["worksheet_id"]; ok {
+		f.WorksheetID, _ = strconv.Atoi(s)
+	}
+	if s, ok := vars["date"]; ok {
+		f.Date = s
+	}
+	if s, ok := vars["zone_id"]; ok {
+		f.ZoneID, _ = strconv.Atoi(s)
+	}
+	if s, ok := vars["team_id"]; ok {
+		f.TeamID, _ = strconv.Atoi(s)
+	}
+	return f, nil
+}
+
+// exportName names an export after what it selects.
+func exportName(f *forms.PhotoFilter) string {
+	name := "photos"
+	if f.WorksheetID != 0 {
+		name += "-worksheet-" + strconv.Itoa(f.WorksheetID)
+	}
+	if f.Date != "" {
+		name += "-" + f.Date
+	}
+	if f.ZoneID != 0 {
+		name += "-zone-" + strconv.Itoa(f.ZoneID)
+	}
+	if f.TeamID != 0 {
+		name += "-team-" + strconv.Itoa(f.TeamID)
+	}
+	return name
+}
+
+func waypoints(photos []*models.TakenPhoto, host string) []geo.Waypoint {
+	waypoints := []geo.Waypoint{}
+	for _, v := range photos {
+		waypoints = append(waypoints, geo.Waypoint{
+			Name:      fmt.Sprintf("%s No. %d", v.Worksheet.Number, v.Photo.RunningNumber),
+			Lat:       v.Photo.GPS.Lat,
+			Lng:       v.Photo.GPS.Lng,
+			Time:      v.Taken,
+			Link:      host + v.Photo.FilePath(),
+			Thumbnail: host + "/thumb/" + strconv.Itoa(v.Photo.ID),
+			Properties: []geo.Property{
+				{"runningNumber", v.Photo.RunningNumber},
+				{"taken", v.Taken.In(models.LocalZone).Format("2006-01-02 15:04:05")},
+				{"worksheetID", v.Worksheet.ID},
+				{"worksheetNumber", v.Worksheet.Number},
+				{"worksheetName", v.Worksheet.Name},
+				{"zone", v.Worksheet.ZoneName},
+				{"team", v.Worksheet.TeamName},
+				{"caption", v.Photo.Caption},
+				{"geofence", v.Photo.Geofence},
+				{"photoURL", host + v.Photo.FilePath()},
+			},
+		})
+	}
+	return waypoints
+}
+
+// writeExport writes the located photos selected by f in format.
+func (app *App) writeExport(w http.ResponseWriter, r *http.Request, format string, f *forms.PhotoFilter) error {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	photos, err := db.ListLocatedPhotos(f)
+	if err != nil {
+		return err
+	}
+
+	name := exportName(f)
+	points := waypoints(photos, app.baseURL(r))
+	buf := new(bytes.Buffer)
+	switch format {
+	case "geojson":
+		err = geo.WriteGeoJSON(buf, points)
+	case "kml":
+		err = geo.WriteKML(buf, name, points)
+	case "gpx":
+		err = geo.WriteGPX(buf, name, points)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// ExportPhotos downloads the photo locations of a worksheet, date, zone or
+// team as GeoJSON, KML or GPX.
+func (app *App) ExportPhotos(w http.ResponseWriter, r *http.Request) {
+	format := mux.Vars(r)["format"]
+	if _, ok := exportContentTypes[format]; !ok {
+		app.NotFound(w, r)
+		return
+	}
+
+	f, err := exportFilter(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := app.writeExport(w, r, format, f); err != nil {
+		app.ServerError(w, err)
+	}
+}
+
+// APIExportPhotos is ExportPhotos for API clients, selecting photos by
+// worksheet in the path or by the worksheet_id, date, zone_id and team_id
+// query parameters.
+func (app *App) APIExportPhotos(w http.ResponseWriter, r *http.Request) {
+	format := mux.Vars(r)["format"]
+	if _, ok := exportContentTypes[format]; !ok {
+		app.APINotFound(w, r)
+		return
+	}
+
+	f, err := exportFilter(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := app.writeExport(w, r, format, f); err != nil {
+		app.APIServerError(w, err)
+	}
+}
+
+// Thumbnail serves a photo scaled down to one of store.ThumbnailSizes, 320
+// pixels unless the size query parameter picks another. Like /store/ it
+// needs no login, so map viewers can load the thumbnails of an export.
+func (app *App) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	photoID, _ := strconv.Atoi(mux.Vars(r)["photo_id"])
+	size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+	snapped := store.ThumbnailSizes[0]
+	for _, s := range store.ThumbnailSizes {
+		if s <= size || (size == 0 && s <= 320) {
+			snapped = s
+		}
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	photo, err := db.GetPhoto(photoID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if photo == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	path, err := app.PhotoStore().Thumbnail(photo, snapped)
+	if err != nil {
+		// Videos and missing files have no thumbnail.
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFile(w, r, path)
+}
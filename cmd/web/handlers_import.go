@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/form"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// ImportWorksheets creates worksheets from a CSV file. Like ImportZones it
+// previews by default; a real import saves every row or, when any row has
+// errors, none of them.
+func (app *App) ImportWorksheets(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	if r.Method == http.MethodGet {
+		app.RenderHTML(w, r, []string{"worksheet.import.page.html"}, &HTMLData{
+			Title: "Import Worksheets",
+		})
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	f := &forms.WorksheetImport{}
+	if err := form.NewDecoder().Decode(f, r.PostForm); err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("worksheet_import_file")
+	if err != nil {
+		app.RenderHTML(w, r, []string{"worksheet.import.page.html"}, &HTMLData{
+			Title: "Import Worksheets",
+			Error: "Please select a CSV file.",
+			Form:  f,
+		})
+		return
+	}
+	defer file.Close()
+
+	rows, err := models.ReadWorksheetCSV(file)
+	if err != nil {
+		app.RenderHTML(w, r, []string{"worksheet.import.page.html"}, &HTMLData{
+			Title: "Import Worksheets",
+			Error: "The file cannot be imported: " + err.Error(),
+			Form:  f,
+		})
+		return
+	}
+
+	if err := db.ImportWorksheets(rows, f.Create, f.DryRun); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	data := &HTMLData{
+		Title:            "Import Worksheets",
+		Form:             f,
+		WorksheetImports: rows,
+	}
+	switch {
+	case rows.Failed() > 0:
+		data.Error = strconv.Itoa(rows.Failed()) + " of " + strconv.Itoa(len(rows)) + " rows have errors, nothing was saved."
+	case f.DryRun:
+		data.Flash = "Preview only, nothing was saved. Choose the file again and untick preview to import it."
+	default:
+		data.Flash = strconv.Itoa(len(rows)) + " worksheets were imported successfully!"
+	}
+	app.RenderHTML(w, r, []string{"worksheet.import.page.html"}, data)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// InboxPhotos lists the photos uploaded without a worksheet that no QR
+// code could assign, and the photos whose QR code names another worksheet
+// than theirs.
+func (app *App) InboxPhotos(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	photos, err := db.ListInboxPhotos()
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	mismatches, err := db.ListQRMismatches(0)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	flash, err := session.PopString(w, "flash")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"photo.inbox.page.html"}, &HTMLData{
+		Title:        "Photo Inbox",
+		Flash:        flash,
+		Photos:       photos,
+		QRMismatches: mismatches,
+	})
+}
+
+// AssignPhoto moves a photo from the inbox, or from the wrong worksheet,
+// to the worksheet with the number posted.
+func (app *App) AssignPhoto(w http.ResponseWriter, r *http.Request) {
+	photoID, _ := strconv.Atoi(mux.Vars(r)["photo_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	photo, err := db.GetPhoto(photoID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if photo == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	number := strings.TrimSpace(r.PostFormValue("worksheet_number"))
+	worksheet, err := db.GetWorksheetByNumber(number)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	flash := "There is no worksheet " + number + "."
+	if worksheet != nil && worksheet.ID != photo.WorksheetID {
+		_, err := app.PhotoStore().MovePhoto(db, photo, worksheet.ID)
+		if err == models.ErrWorksheetApproved {
+			flash = "Worksheet " + worksheet.Number + " is approved and takes no more photos."
+		} else if err != nil {
+			app.ServerError(w, err)
+			return
+		} else {
+			flash = "Photo was moved to worksheet " + worksheet.Number + "."
+		}
+	} else if worksheet != nil {
+		flash = "Photo is already in worksheet " + worksheet.Number + "."
+	}
+
+	if err := session.PutString(w, "flash", flash); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/photos/inbox", http.StatusSeeOther)
+}
+
+// APIInboxPhotos saves photos whose worksheet is not known. Each goes to
+// the worksheet named by the QR code it shows, or else to the inbox.
+func (app *App) APIInboxPhotos(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	uuid := r.FormValue("uuid")
+	if uuid != "" && !forms.ValidUUID(uuid) {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "uuid is not a valid UUID")
+		return
+	}
+
+	results, err := app.SaveUploadedPhotos(db, r, models.InboxWorksheetID)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	app.APIUploadResults(w, r, models.InboxWorksheetID, results)
+}
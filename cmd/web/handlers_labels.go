@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/labels"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/qr"
+)
+
+var errLabelPrinter = errors.New("dpi, width and height must be positive numbers")
+
+// WorksheetLabels prints QR stickers for a worksheet, for the worksheets of
+// a date, zone, team or "campaign", or for all of them.
+func (app *App) WorksheetLabels(w http.ResponseWriter, r *http.Request) {
+	f, err := photoFilter(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	var worksheets models.Worksheets
+	campaign := r.URL.Query().Get("campaign")
+	if campaign != "" {
+		worksheets, err = db.ListWorksheetsByCampaign(campaign)
+	} else {
+		worksheets, err = db.ListWorksheetsByFilter(f)
+	}
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if f.WorksheetID != 0 && len(worksheets) == 0 {
+		app.NotFound(w, r)
+		return
+	}
+
+	list := []*labels.Label{}
+	for _, worksheet := range worksheets {
+		list = append(list, &labels.Label{
+			URL:    app.qrURL(app.baseURL(r), qr.KindWorksheet, worksheet.ID),
+			Number: worksheet.Number,
+			Name:   worksheet.Name,
+		})
+	}
+
+	name := "labels" + strings.TrimPrefix(exportName(f), "photos")
+	if campaign != "" {
+		name = "labels-campaign"
+	}
+	app.writeLabels(w, r, name, list)
+}
+
+// BoardLabels prints QR stickers for the boards whose code or name holds
+// "q", or for all of them.
+func (app *App) BoardLabels(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	query := forms.NewQuery()
+	query.Q = r.URL.Query().Get("q")
+	query.MaxResults = -1
+	boards, _, err := db.ListBoards(query)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	list := []*labels.Label{}
+	for _, board := range boards {
+		list = append(list, &labels.Label{
+			URL:    app.qrURL(app.baseURL(r), qr.KindBoard, board.ID),
+			Number: board.Code,
+			Name:   board.Name,
+		})
+	}
+	app.writeLabels(w, r, "labels-boards", list)
+}
+
+// writeLabels downloads labels in the format of the route. PDF sheets take
+// the "layout", a name of labels.Layouts or COLSxROWS, and "outline" from
+// the query; ZPL takes the "dpi" of the printer and the "width" and
+// "height" of its labels in millimetres.
+func (app *App) writeLabels(w http.ResponseWriter, r *http.Request, name string, list []*labels.Label) {
+	q := r.URL.Query()
+	buf := new(bytes.Buffer)
+
+	switch mux.Vars(r)["format"] {
+	case "zpl":
+		p := labels.DefaultPrinter
+		if s := q.Get("dpi"); s != "" {
+			p.DPI, _ = strconv.Atoi(s)
+		}
+		if s := q.Get("width"); s != "" {
+			p.Width, _ = strconv.ParseFloat(s, 64)
+		}
+		if s := q.Get("height"); s != "" {
+			p.Height, _ = strconv.ParseFloat(s, 64)
+		}
+		if p.DPI <= 0 || p.Width <= 0 || p.Height <= 0 {
+			app.ClientError(w, errLabelPrinter, http.StatusBadRequest)
+			return
+		}
+		if err := labels.WriteZPL(buf, p, list); err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-zpl")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.zpl"`)
+	default:
+		layoutName := q.Get("layout")
+		if layoutName == "" {
+			layoutName = labels.DefaultLayout
+		}
+		layout, err := labels.ParseLayout(layoutName)
+		if err != nil {
+			app.ClientError(w, err, http.StatusBadRequest)
+			return
+		}
+		sheet := &labels.Sheet{Layout: layout, Font: app.ReportFont, Outline: q.Get("outline") != ""}
+		if err := sheet.Write(buf, "Labels", list); err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `inline; filename="`+name+`.pdf"`)
+	}
+	buf.WriteTo(w)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/qr"
+)
+
+// Sizes in pixels a QR code can be drawn at.
+const (
+	qrDefaultSize = 256
+	qrMinSize     = 64
+	qrMaxSize     = 2048
+)
+
+var (
+	errQRSize   = fmt.Errorf("size must be between %d and %d", qrMinSize, qrMaxSize)
+	errQRLevel  = errors.New("level must be L, M, Q or H")
+	errQRFormat = errors.New("format must be png or svg")
+)
+
+// QRSigner signs the /q/{token} URLs of worksheet and board QR codes.
+func (app *App) QRSigner() qr.Signer {
+	return qr.Signer{Key: []byte(app.QRSecret)}
+}
+
+// qrURL is the URL on baseURL a worksheet or board QR code opens.
+func (app *App) qrURL(baseURL, kind string, id int) string {
+	return baseURL + "/q/" + app.QRSigner().Token(kind, id)
+}
+
+// writeQR draws text as a QR code in format, png or svg. The "size" in
+// pixels and the error correction "level", L, M, Q or H, come from the
+// query.
+func (app *App) writeQR(w http.ResponseWriter, r *http.Request, text, format string) {
+	size := qrDefaultSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < qrMinSize || n > qrMaxSize {
+			app.ClientError(w, errQRSize, http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+	level := qr.DefaultLevel
+	if s := r.URL.Query().Get("level"); s != "" {
+		var ok bool
+		if level, ok = qr.ParseLevel(s); !ok {
+			app.ClientError(w, errQRLevel, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	switch format {
+	case "svg":
+		b, err = qr.SVG(text, level, size)
+		w.Header().Set("Content-Type", "image/svg+xml")
+	case "", "png":
+		b, err = qr.PNG(text, level, size)
+		w.Header().Set("Content-Type", "image/png")
+	default:
+		app.ClientError(w, errQRFormat, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		// The text is too long for a QR code.
+		w.Header().Del("Content-Type")
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+	w.Write(b)
+}
+
+// WorksheetQR draws the signed QR code of a worksheet.
+func (app *App) WorksheetQR(w http.ResponseWriter, r *http.Request) {
+	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	worksheet, err := db.GetWorksheet(worksheetID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	app.writeQR(w, r, app.qrURL(app.baseURL(r), qr.KindWorksheet, worksheet.ID), mux.Vars(r)["format"])
+}
+
+// BoardQR draws the signed QR code of a board.
+func (app *App) BoardQR(w http.ResponseWriter, r *http.Request) {
+	boardID, _ := strconv.Atoi(mux.Vars(r)["board_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	board, err := db.GetBoard(boardID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if board == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	app.writeQR(w, r, app.qrURL(app.baseURL(r), qr.KindBoard, board.ID), mux.Vars(r)["format"])
+}
+
+// OpenQR is where a scanned worksheet or board QR code lands. Logged in
+// inspectors go on to upload photos of the worksheet, or to the board.
+// Anyone else sees a read-only status page when QRPublicStatus is set, or
+// logs in first; either way logging in leads on to the same place.
+func (app *App) OpenQR(w http.ResponseWriter, r *http.Request) {
+	kind, id, ok := app.QRSigner().Parse(mux.Vars(r)["token"])
+	if !ok {
+		app.NotFound(w, r)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	data := &HTMLData{}
+	next := ""
+	switch kind {
+	case qr.KindWorksheet:
+		worksheet, err := db.GetWorksheet(id)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		if worksheet == nil {
+			app.NotFound(w, r)
+			return
+		}
+		data.Title = "Worksheet " + worksheet.Number
+		data.Worksheet = worksheet
+		next = "/worksheet/" + strconv.Itoa(worksheet.ID) + "/photo/new"
+	case qr.KindBoard:
+		board, err := db.GetBoard(id)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		if board == nil {
+			app.NotFound(w, r)
+			return
+		}
+		data.Title = "Board " + board.Code
+		data.Board = board
+		next = "/board/" + strconv.Itoa(board.ID)
+	}
+
+	if app.CurrentUser(r) != nil {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	if err := session.PutString(w, "loginRedirect", next); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if !app.QRPublicStatus {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	if data.Worksheet != nil {
+		compliance, err := db.GetCompliance(data.Worksheet.ID)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		data.Compliance = compliance
+	} else {
+		inspections, err := db.ListBoardInspections(data.Board.ID)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		data.Inspections = inspections
+	}
+	data.HiddenNavBar = true
+	app.RenderHTML(w, r, []string{"qr.status.page.html"}, data)
+}
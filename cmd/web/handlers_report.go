@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/qr"
+	"gitlab.com/code-mobi/board-checker/pkg/report"
+)
+
+// inspections loads what the report of each worksheet shows. The lists by
+// date and zone hold only the number and name, so each worksheet is loaded
+// again with its zone, team and board. The QR code holds the signed URL of
+// the worksheet on baseURL, like the one on the worksheet page.
+func (app *App) inspections(db *models.Database, baseURL string, worksheets models.Worksheets) ([]*report.Inspection, error) {
+	inspections := []*report.Inspection{}
+	for _, listed := range worksheets {
+		worksheet, err := db.GetWorksheet(listed.ID)
+		if err != nil {
+			return nil, err
+		}
+		if worksheet == nil {
+			continue
+		}
+		expected, err := db.ExpectedLocation(worksheet.ID)
+		if err != nil {
+			return nil, err
+		}
+		photos, err := db.ListTakenPhotos(&forms.PhotoFilter{WorksheetID: worksheet.ID})
+		if err != nil {
+			return nil, err
+		}
+		code, err := qr.PNG(app.qrURL(baseURL, qr.KindWorksheet, worksheet.ID), qr.DefaultLevel, qrDefaultSize)
+		if err != nil {
+			return nil, err
+		}
+		inspections = append(inspections, &report.Inspection{
+			Worksheet: worksheet,
+			Expected:  expected,
+			Photos:    photos,
+			QR:        code,
+		})
+	}
+	return inspections, nil
+}
+
+// writeReport writes the PDF report of worksheets, shown inline as name.
+func (app *App) writeReport(w http.ResponseWriter, r *http.Request, db *models.Database, name, title string, worksheets models.Worksheets) error {
+	inspections, err := app.inspections(db, app.baseURL(r), worksheets)
+	if err != nil {
+		return err
+	}
+
+	rep := &report.Report{
+		Store:  app.PhotoStore(),
+		Tiles:  app.Tiles,
+		Radius: app.GeofenceRadius,
+		Font:   app.ReportFont,
+	}
+	buf := new(bytes.Buffer)
+	if err := rep.Write(buf, title, inspections); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+name+`.pdf"`)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// WorksheetReport renders the proof of inspection PDF of a worksheet.
+func (app *App) WorksheetReport(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	id, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+	worksheet, err := db.GetWorksheet(id)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	name := "report-worksheet-" + strconv.Itoa(worksheet.ID)
+	title := "Worksheet " + worksheet.Number
+	if err := app.writeReport(w, r, db, name, title, models.Worksheets{worksheet}); err != nil {
+		app.ServerError(w, err)
+	}
+}
+
+// BatchReport renders one PDF with the reports of every worksheet of a
+// date or zone.
+func (app *App) BatchReport(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	var name, title string
+	var worksheets models.Worksheets
+	var err error
+	vars := mux.Vars(r)
+	if date, ok := vars["date"]; ok {
+		name = "report-" + date
+		title = "Inspections " + date
+		worksheets, err = db.ListWorksheetsByDate(date)
+	} else {
+		zoneID, _ := strconv.Atoi(vars["zone_id"])
+		var zone *models.Zone
+		zone, err = db.GetZone(zoneID)
+		if err != nil {
+			app.ServerError(w, err)
+			return
+		}
+		if zone == nil {
+			app.NotFound(w, r)
+			return
+		}
+		name = fmt.Sprintf("report-zone-%d", zone.ID)
+		title = "Zone " + zone.Name
+		worksheets, err = db.ListWorksheetsByZone(zone.ID)
+	}
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	if err := app.writeReport(w, r, db, name, title, worksheets); err != nil {
+		app.ServerError(w, err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/form"
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// reviewPageSize is how many photos a page of the review queue shows.
+const reviewPageSize = 20
+
+var errReviewFilter = errors.New("review must be pending, approved or rejected")
+
+// reviewFilter reads the review queue filter of the query. Its Review is
+// "pending" in URLs for models.ReviewPending.
+func reviewFilter(r *http.Request) (*forms.ReviewFilter, error) {
+	f := &forms.ReviewFilter{}
+	if err := form.NewDecoder().Decode(f, r.URL.Query()); err != nil {
+		return nil, err
+	}
+	switch f.Review {
+	case "", "pending":
+		f.Review = models.ReviewPending
+	case models.ReviewApproved, models.ReviewRejected:
+	default:
+		return nil, errReviewFilter
+	}
+	return f, nil
+}
+
+// ReviewPhotos is the review queue: photos uploaded to any worksheet that
+// are waiting for a supervisor, or those already approved or rejected,
+// filtered by team, zone and upload date.
+func (app *App) ReviewPhotos(w http.ResponseWriter, r *http.Request) {
+	f, err := reviewFilter(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// The queue pages by photo ID rather than offset: reviewed photos drop
+	// out of it, and an offset would skip as many unseen ones.
+	query := forms.NewQuery()
+	query.MaxResults = reviewPageSize
+	if s := r.FormValue("cursor"); s != "" {
+		cursor, err := models.DecodeCursor(s)
+		if err != nil {
+			app.ClientError(w, err, http.StatusBadRequest)
+			return
+		}
+		query.KeyID = cursor.ID
+		query.Before = cursor.Before
+		query.MaxResults = cursor.MaxResults
+	}
+	if query.MaxResults > reviewPageSize {
+		query.MaxResults = reviewPageSize
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	items, pageInfo, err := db.ListReviewQueue(f, query)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	params := url.Values{}
+	if f.Review != models.ReviewPending {
+		params.Set("review", f.Review)
+	}
+	if f.Date != "" {
+		params.Set("date", f.Date)
+	}
+	if f.ZoneID != 0 {
+		params.Set("zone_id", strconv.Itoa(f.ZoneID))
+	}
+	if f.TeamID != 0 {
+		params.Set("team_id", strconv.Itoa(f.TeamID))
+	}
+	pageURL := "/photos/review?"
+	if len(params) > 0 {
+		pageURL += params.Encode() + "&"
+	}
+
+	zones, err := db.ListZones()
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	teams, err := db.ListTeams()
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	flash, err := session.PopString(w, "flash")
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"photo.review.page.html"}, &HTMLData{
+		Title:         "Photo Review",
+		Flash:         flash,
+		Zones:         zones,
+		Teams:         teams,
+		PageInfo:      pageInfo,
+		PageURL:       pageURL,
+		ReviewItems:   items,
+		ReviewFilter:  f,
+		ReviewReasons: models.ReviewReasons,
+	})
+}
+
+// ReviewPhoto approves or rejects a photo with the "review" posted, and a
+// "reason" code and "note" for rejections, then returns to the page of the
+// queue in "next".
+func (app *App) ReviewPhoto(w http.ResponseWriter, r *http.Request) {
+	photoID, _ := strconv.Atoi(mux.Vars(r)["photo_id"])
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	review := r.PostFormValue("review")
+	reason := r.PostFormValue("reason")
+	note := strings.TrimSpace(r.PostFormValue("note"))
+	err := db.ReviewPhoto(photoID, review, reason, note, user)
+	var flash string
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		app.NotFound(w, r)
+		return
+	case models.ErrInvalidReview:
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	case models.ErrReviewRole:
+		flash = "Only supervisors review photos."
+	case models.ErrReviewReason:
+		flash = "Choose why the photo is rejected."
+	case models.ErrWorksheetApproved:
+		flash = "The worksheet of this photo is already approved."
+	default:
+		app.ServerError(w, err)
+		return
+	}
+
+	if flash != "" {
+		session := app.Sessions.Load(r)
+		if err := session.PutString(w, "flash", flash); err != nil {
+			app.ServerError(w, err)
+			return
+		}
+	}
+
+	next := r.PostFormValue("next")
+	if !strings.HasPrefix(next, "/photos/review") {
+		next = "/photos/review"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// APIRejectedPhotos lists the rejected photos the signed in user uploaded,
+// with why, so that they can be taken again.
+func (app *App) APIRejectedPhotos(w http.ResponseWriter, r *http.Request) {
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.APIClientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	photos, err := db.ListRejectedPhotos(user.ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"photos":  JSONPhotos{photos, app.baseURL(r)},
+		"reasons": models.ReviewReasons,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
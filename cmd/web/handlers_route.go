@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/form"
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// routeForm reads the day and start of a team route from the query string.
+// The day defaults to today in models.LocalZone.
+func routeForm(r *http.Request) (*forms.Route, error) {
+	f := &forms.Route{}
+	if err := form.NewDecoder().Decode(f, r.URL.Query()); err != nil {
+		return nil, err
+	}
+	if f.Date == "" {
+		f.Date = time.Now().In(models.LocalZone).Format("2006-01-02")
+	}
+	return f, nil
+}
+
+// failureError joins the failures of a form into one error.
+func failureError(failures map[string]string) error {
+	messages := []string{}
+	for _, message := range failures {
+		messages = append(messages, message)
+	}
+	sort.Strings(messages)
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// planRoute plans the route of the team in the path for a valid form.
+func planRoute(db *models.Database, r *http.Request, f *forms.Route) (*models.Route, error) {
+	teamID, _ := strconv.Atoi(mux.Vars(r)["team_id"])
+	var start *models.Location
+	if lat, lng, ok, _ := f.Start(); ok {
+		start = &models.Location{lat, lng}
+	}
+	return db.TeamRoute(teamID, f.Date, start)
+}
+
+// writeRouteGPX writes a route as a GPX route from its start through each
+// worksheet, linked to its page on baseURL.
+func writeRouteGPX(w http.ResponseWriter, baseURL string, team *models.Team, route *models.Route) error {
+	points := []geo.Waypoint{}
+	if route.Start != nil {
+		points = append(points, geo.Waypoint{Name: "Start", Lat: route.Start.Lat, Lng: route.Start.Lng})
+	}
+	for _, stop := range route.Stops {
+		points = append(points, geo.Waypoint{
+			Name: fmt.Sprintf("%d. %s %s", stop.Sequence, stop.Worksheet.Number, stop.Worksheet.Name),
+			Lat:  stop.Location.Lat,
+			Lng:  stop.Location.Lng,
+			Link: baseURL + "/worksheet/" + strconv.Itoa(stop.Worksheet.ID),
+			Properties: []geo.Property{
+				{"worksheetNumber", stop.Worksheet.Number},
+				{"board", stop.Worksheet.BoardCode},
+				{"leg", fmt.Sprintf("%.1f km", stop.Leg/1000)},
+				{"distance", fmt.Sprintf("%.1f km", stop.Distance/1000)},
+			},
+		})
+	}
+
+	name := fmt.Sprintf("%s %s", team.Name, route.Date)
+	buf := new(bytes.Buffer)
+	if err := geo.WriteGPXRoute(buf, name, points); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", exportContentTypes["gpx"])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="route-team-%d-%s.gpx"`, team.ID, route.Date))
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// ShowTeamRoute renders the printable run sheet of a team's route.
+func (app *App) ShowTeamRoute(w http.ResponseWriter, r *http.Request) {
+	f, err := routeForm(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	teamID, _ := strconv.Atoi(mux.Vars(r)["team_id"])
+	team, err := db.GetTeam(teamID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if team == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	if !f.Valid() {
+		app.ClientError(w, failureError(f.Failures), http.StatusBadRequest)
+		return
+	}
+	route, err := planRoute(db, r, f)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	app.RenderHTML(w, r, []string{"worksheet.route.page.html"}, &HTMLData{
+		Title:        "Run sheet - " + team.Name + " - " + route.Date,
+		HiddenNavBar: true,
+		Team:         team,
+		Route:        route,
+	})
+}
+
+// ExportTeamRoute downloads a team's route as GPX.
+func (app *App) ExportTeamRoute(w http.ResponseWriter, r *http.Request) {
+	f, err := routeForm(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	teamID, _ := strconv.Atoi(mux.Vars(r)["team_id"])
+	team, err := db.GetTeam(teamID)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if team == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	if !f.Valid() {
+		app.ClientError(w, failureError(f.Failures), http.StatusBadRequest)
+		return
+	}
+	route, err := planRoute(db, r, f)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	if err := writeRouteGPX(w, app.baseURL(r), team, route); err != nil {
+		app.ServerError(w, err)
+	}
+}
+
+// APITeamRoute returns a team's route as JSON, or as GPX from the .gpx
+// path.
+func (app *App) APITeamRoute(w http.ResponseWriter, r *http.Request) {
+	f, err := routeForm(r)
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	teamID, _ := strconv.Atoi(mux.Vars(r)["team_id"])
+	team, err := db.GetTeam(teamID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if team == nil {
+		app.APINotFound(w, r)
+		return
+	}
+
+	if !f.Valid() {
+		app.APIValidationError(w, f.Failures)
+		return
+	}
+	route, err := planRoute(db, r, f)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	if mux.Vars(r)["format"] == "gpx" {
+		if err := writeRouteGPX(w, app.baseURL(r), team, route); err != nil {
+			app.APIServerError(w, err)
+		}
+		return
+	}
+
+	type Stop struct {
+		Sequence    int              `json:"sequence"`
+		WorksheetID int              `json:"worksheetID"`
+		Number      string           `json:"number"`
+		Name        string           `json:"name"`
+		BoardID     int              `json:"boardID"`
+		BoardCode   string           `json:"boardCode"`
+		Location    *models.Location `json:"location"`
+		Leg         float64          `json:"leg"`
+		Distance    float64          `json:"distance"`
+	}
+	stops := []Stop{}
+	for _, v := range route.Stops {
+		stops = append(stops, Stop{
+			Sequence:    v.Sequence,
+			WorksheetID: v.Worksheet.ID,
+			Number:      v.Worksheet.Number,
+			Name:        v.Worksheet.Name,
+			BoardID:     v.Worksheet.BoardID,
+			BoardCode:   v.Worksheet.BoardCode,
+			Location:    v.Location,
+			Leg:         v.Leg,
+			Distance:    v.Distance,
+		})
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"teamID":    team.ID,
+		"date":      route.Date,
+		"start":     route.Start,
+		"stops":     stops,
+		"unlocated": JSONWorksheets{route.Unlocated, app.baseURL(r)},
+		"distance":  route.Distance,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+var errWorksheetApproved = errors.New("Worksheet is approved and takes no more photos.")
+
+// ChangeWorksheetStatus moves a worksheet to the "status" posted, with an
+// optional "reason", when the role of the user allows it.
+func (app *App) ChangeWorksheetStatus(w http.ResponseWriter, r *http.Request) {
+	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.Unauthorized(w, r)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	status := r.PostFormValue("status")
+	reason := strings.TrimSpace(r.PostFormValue("reason"))
+	change, err := db.ChangeWorksheetStatus(worksheetID, status, user, reason)
+	var flash string
+	switch err {
+	case nil:
+		flash = "Worksheet is " + statusLabel(change.To) + "."
+	case sql.ErrNoRows:
+		app.NotFound(w, r)
+		return
+	case models.ErrInvalidStatus:
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	case models.ErrStatusTransition:
+		flash = "You can't move this worksheet to " + statusLabel(status) + "."
+	case models.ErrPhotosNotApproved:
+		flash = "Every photo must be approved before the worksheet is."
+	case models.ErrNoPhotos:
+		flash = "A worksheet needs photos before it is approved."
+	case models.ErrSlotsIncomplete:
+		flash = "Every checklist slot needs a photo before the worksheet is approved."
+	default:
+		app.ServerError(w, err)
+		return
+	}
+
+	session := app.Sessions.Load(r)
+	if err := session.PutString(w, "flash", flash); err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/worksheet/"+strconv.Itoa(worksheetID), http.StatusSeeOther)
+}
+
+// APIChangeWorksheetStatus is ChangeWorksheetStatus for clients signed in
+// with a token from /api/user/login.
+func (app *App) APIChangeWorksheetStatus(w http.ResponseWriter, r *http.Request) {
+	worksheetID, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+
+	user := app.CurrentUser(r)
+	if user == nil {
+		app.APIClientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	// Tokens don't carry the role, which may have changed since login.
+	user, err := db.UserInfo(user.ID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if user == nil {
+		app.APIClientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	status := r.PostFormValue("status")
+	reason := strings.TrimSpace(r.PostFormValue("reason"))
+	change, err := db.ChangeWorksheetStatus(worksheetID, status, user, reason)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		app.APINotFound(w, r)
+		return
+	case models.ErrInvalidStatus:
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "status must be one of "+strings.Join(models.Statuses, ", "))
+		return
+	case models.ErrStatusTransition:
+		app.APIClientErrorWithMessage(w, http.StatusForbidden, "a "+user.Role+" can't move this worksheet to "+status)
+		return
+	case models.ErrPhotosNotApproved:
+		app.APIClientErrorWithMessage(w, http.StatusConflict, "every photo must be approved before the worksheet is")
+		return
+	case models.ErrNoPhotos:
+		app.APIClientErrorWithMessage(w, http.StatusConflict, "a worksheet needs photos before it is approved")
+		return
+	case models.ErrSlotsIncomplete:
+		app.APIClientErrorWithMessage(w, http.StatusConflict, "every checklist slot needs a photo before the worksheet is approved")
+		return
+	default:
+		app.APIServerError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"status":       change.To,
+		"statusChange": change,
+	})
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Tile serves a map tile from the MBTiles file.
+func (app *App) Tile(w http.ResponseWriter, r *http.Request) {
+	if app.Tiles == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	z, _ := strconv.Atoi(vars["z"])
+	x, _ := strconv.Atoi(vars["x"])
+	y, _ := strconv.Atoi(vars["y"])
+
+	data, err := app.Tiles.Tile(z, x, y)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", app.Tiles.ContentType())
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, "", app.Tiles.ModTime, bytes.NewReader(data))
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
+	"gitlab.com/code-mobi/board-checker/pkg/tus"
+)
+
+// Resumable uploads follow the tus 1.0 protocol. Create an upload with
+// POST /api/uploads and the Upload-Metadata keys filename, worksheet_id and
+// optionally running_number, location, caption, slot and uuid. Send the file
+// with PATCH requests and resume after HEAD. The completed upload becomes
+// a photo of the worksheet; its ID is returned in the X-Photo-ID header.
+// Every request needs the token of the user who created the upload.
+
+func tusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tus.Version)
+	w.Header().Set("Access-Control-Expose-Headers",
+		"Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, X-Photo-ID")
+}
+
+func (app *App) TusOptions(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	w.Header().Set("Tus-Version", tus.Version)
+	w.Header().Set("Tus-Extension", tus.Extensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(app.UploadMaxSize, 10))
+	w.Header().Set("Access-Control-Allow-Methods", "POST, HEAD, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers",
+		"Authorization, Content-Type, Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) TusCreate(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "Upload-Length is required")
+		return
+	}
+	if length > app.UploadMaxSize || (app.UploadLimits.MaxBytes > 0 && length > app.UploadLimits.MaxBytes) {
+		app.APIClientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := tus.ParseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if store.CleanName(metadata["filename"]) == "" {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "Upload-Metadata filename is required")
+		return
+	}
+	if uuid := metadata["uuid"]; uuid != "" && !forms.ValidUUID(uuid) {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "Upload-Metadata uuid is not a valid UUID")
+		return
+	}
+
+	worksheetID, _ := strconv.Atoi(metadata["worksheet_id"])
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	worksheet, err := db.GetWorksheet(worksheetID)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "Upload-Metadata worksheet_id is not a worksheet")
+		return
+	}
+	if !worksheet.AcceptsPhotos() {
+		app.APIClientErrorWithMessage(w, http.StatusConflict, errWorksheetApproved.Error())
+		return
+	}
+	err = db.CheckSlot(worksheet.ID, metadata["slot"])
+	if err == models.ErrUnknownSlot {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "Upload-Metadata "+errUnknownSlot.Error())
+		return
+	} else if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	// The uploader is known when the upload starts, not when it finishes.
+	upload, err := app.Uploads.Create(app.CurrentUser(r).ID, length, metadata)
+	if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.Expires.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (app *App) TusHead(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	w.Header().Set("Cache-Control", "no-store")
+
+	upload, err := app.userUpload(r, mux.Vars(r)["upload_id"])
+	if err == tus.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.Expires.Format(http.TimeFormat))
+	if upload.PhotoID != 0 {
+		w.Header().Set("X-Photo-ID", strconv.Itoa(upload.PhotoID))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *App) TusPatch(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	id := mux.Vars(r)["upload_id"]
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		app.APIClientError(w, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		app.APIClientErrorWithMessage(w, http.StatusBadRequest, "Upload-Offset is required")
+		return
+	}
+
+	unlock := app.Uploads.Lock(id)
+	defer unlock()
+
+	upload, err := app.userUpload(r, id)
+	if err == tus.ErrNotFound {
+		app.APINotFound(w, r)
+		return
+	} else if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+
+	// A complete upload that failed to become a photo is finished again by
+	// an empty PATCH at its full offset.
+	if !(upload.Complete() && offset == upload.Length) {
+		upload, err = app.Uploads.Append(id, offset, r.Body)
+		if err == tus.ErrOffsetMismatch {
+			app.APIClientErrorWithMessage(w, http.StatusConflict, err.Error())
+			return
+		} else if err == tus.ErrTooLarge {
+			app.APIClientErrorWithMessage(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		} else if err != nil {
+			log.Printf("TusPatch %s: %s", id, err)
+			if upload != nil {
+				w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+			}
+			app.APIServerError(w, err)
+			return
+		}
+	}
+
+	if upload.Complete() && upload.PhotoID == 0 {
+		photo, err := app.FinishUpload(upload)
+		if verr, ok := err.(*store.ValidationError); ok {
+			// Resending the same content cannot succeed, so the upload is
+			// dropped.
+			app.Uploads.Delete(id)
+			app.APIClientErrorWithMessage(w, http.StatusUnprocessableEntity, verr.Error())
+			return
+		} else if err == models.ErrWorksheetApproved {
+			// The worksheet was approved while the photo was uploading.
+			app.Uploads.Delete(id)
+			app.APIClientErrorWithMessage(w, http.StatusConflict, errWorksheetApproved.Error())
+			return
+		} else if err == models.ErrNoWorksheet {
+			// Or deleted.
+			app.Uploads.Delete(id)
+			app.APIClientErrorWithMessage(w, http.StatusNotFound, "worksheet no longer exists")
+			return
+		} else if err != nil {
+			app.APIServerError(w, err)
+			return
+		}
+		upload.PhotoID = photo.ID
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.Expires.Format(http.TimeFormat))
+	if upload.PhotoID != 0 {
+		w.Header().Set("X-Photo-ID", strconv.Itoa(upload.PhotoID))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) TusDelete(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	id := mux.Vars(r)["upload_id"]
+
+	unlock := app.Uploads.Lock(id)
+	defer unlock()
+
+	_, err := app.userUpload(r, id)
+	if err == nil {
+		err = app.Uploads.Delete(id)
+	}
+	if err == tus.ErrNotFound {
+		app.APINotFound(w, r)
+		return
+	} else if err != nil {
+		app.APIServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userUpload returns the upload id of the user of the request. Uploads of
+// other users are not found.
+func (app *App) userUpload(r *http.Request, id string) (*tus.Upload, error) {
+	upload, err := app.Uploads.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if user := app.CurrentUser(r); user == nil || user.ID != upload.UserID {
+		return nil, tus.ErrNotFound
+	}
+	return upload, nil
+}
+
+// FinishUpload turns a complete upload into a photo of the worksheet named
+// in its metadata.
+func (app *App) FinishUpload(upload *tus.Upload) (*models.Photo, error) {
+	f, err := app.Uploads.Open(upload.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	worksheetID, _ := strconv.Atoi(upload.Metadata["worksheet_id"])
+	runningNumber, _ := strconv.Atoi(upload.Metadata["running_number"])
+
+	photo := &models.Photo{
+		WorksheetID:   worksheetID,
+		RunningNumber: runningNumber,
+		FileName:      store.CleanName(upload.Metadata["filename"]),
+		Location:      upload.Metadata["location"],
+		Caption:       upload.Metadata["caption"],
+		Slot:          upload.Metadata["slot"],
+		UUID:          strings.ToLower(upload.Metadata["uuid"]),
+		UserID:        upload.UserID,
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	photo, _, err = app.PhotoStore().SavePhoto(db, photo, f)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Close()
+	if err := app.Uploads.Finish(upload.ID, photo.ID); err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// ExpireUploads removes abandoned uploads every interval.
+func (app *App) ExpireUploads(interval time.Duration) {
+	for range time.Tick(interval) {
+		n, err := app.Uploads.Expire()
+		if err != nil {
+			log.Printf("ExpireUploads: %s", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("ExpireUploads: removed %d uploads", n)
+		}
+	}
+}
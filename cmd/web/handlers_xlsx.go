@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/xlsx"
+)
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// xlsxThumbnailSize is the store thumbnail embedded in spreadsheets.
+const xlsxThumbnailSize = 160
+
+var worksheetXLSXColumns = []xlsx.Column{
+	{"Number", 14},
+	{"Name", 32},
+	{"Campaign", 20},
+	{"Zone", 16},
+	{"Team", 16},
+	{"Board", 16},
+	{"Created", 17},
+	{"Photos", 8},
+	{"Within", 8},
+	{"Outside", 8},
+	{"No GPS", 8},
+	{"GPS compliance", 14},
+}
+
+var photoXLSXColumns = []xlsx.Column{
+	{"No.", 6},
+	{"Caption", 32},
+	{"Taken", 17},
+	{"Latitude", 12},
+	{"Longitude", 12},
+	{"Geofence", 10},
+	{"Distance (m)", 12},
+}
+
+// localTime shows UTC times, such as those of the database and the taken
+// times of photos, in the zone of the pages.
+func localTime(t time.Time) time.Time {
+	return t.In(models.LocalZone)
+}
+
+// thumbnail returns the thumbnail of a photo to embed in a spreadsheet.
+func (app *App) thumbnail(photo *models.Photo) xlsx.Thumbnail {
+	if photo == nil {
+		return nil
+	}
+	s := app.PhotoStore()
+	return func() (string, error) {
+		return s.Thumbnail(photo, xlsxThumbnailSize)
+	}
+}
+
+// ExportWorksheets downloads the worksheets of a date, zone or team, or all
+// of them, as a spreadsheet with their GPS compliance and a thumbnail of
+// their first photo. Rows are streamed, so once the download has started
+// errors can only be logged.
+func (app *App) ExportWorksheets(w http.ResponseWriter, r *http.Request) {
+	f, err := photoFilter(r)
+	if err != nil {
+		app.ClientError(w, err, http.StatusBadRequest)
+		return
+	}
+	name := "worksheets"
+	if f.Date != "" {
+		name += "-" + f.Date
+	}
+	if f.ZoneID != 0 {
+		name += "-zone-" + strconv.Itoa(f.ZoneID)
+	}
+	if f.TeamID != 0 {
+		name += "-team-" + strconv.Itoa(f.TeamID)
+	}
+
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.xlsx"`)
+	x, err := xlsx.NewWriter(w, "Worksheets", worksheetXLSXColumns, true)
+	if err != nil {
+		log.Printf("ExportWorksheets: %s", err)
+		return
+	}
+
+	err = db.EachWorksheetSummary(f, func(s *models.WorksheetSummary) error {
+		ws, c := s.Worksheet, s.Compliance
+		var compliance interface{}
+		if c.Within+c.Outside > 0 {
+			compliance = xlsx.Percent(float64(c.Within) / float64(c.Within+c.Outside))
+		}
+		return x.Row(app.thumbnail(s.Photo),
+			ws.Number, ws.Name, ws.Campaign, ws.ZoneName, ws.TeamName, ws.BoardCode,
+			localTime(ws.Created), c.Total, c.Within, c.Outside, c.Missing, compliance)
+	})
+	if err == nil {
+		err = x.Close()
+	}
+	if err != nil {
+		log.Printf("ExportWorksheets: %s", err)
+	}
+}
+
+// ExportWorksheetPhotos downloads the photos of a worksheet as a
+// spreadsheet, one row with a thumbnail per photo.
+func (app *App) ExportWorksheetPhotos(w http.ResponseWriter, r *http.Request) {
+	db := &models.Database{connect(app.DSN)}
+	defer db.Close()
+
+	id, _ := strconv.Atoi(mux.Vars(r)["worksheet_id"])
+	worksheet, err := db.GetWorksheet(id)
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+	if worksheet == nil {
+		app.NotFound(w, r)
+		return
+	}
+	photos, err := db.ListTakenPhotos(&forms.PhotoFilter{WorksheetID: worksheet.ID})
+	if err != nil {
+		app.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="worksheet-`+strconv.Itoa(worksheet.ID)+`.xlsx"`)
+	x, err := xlsx.NewWriter(w, worksheet.Number, photoXLSXColumns, true)
+	if err != nil {
+		log.Printf("ExportWorksheetPhotos: %s", err)
+		return
+	}
+
+	for _, v := range photos {
+		p := v.Photo
+		var lat, lng, distance interface{}
+		if p.GPS != nil {
+			lat, lng = p.GPS.Lat, p.GPS.Lng
+		}
+		if p.Distance != nil {
+			distance = *p.Distance
+		}
+		if err = x.Row(app.thumbnail(p), p.RunningNumber, p.Caption, localTime(v.Taken), lat, lng, p.Geofence, distance); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = x.Close()
+	}
+	if err != nil {
+		log.Printf("ExportWorksheetPhotos: %s", err)
+	}
+}
@@ -1,9 +1,20 @@
 package main
 
 import (
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
 	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/qr"
+	"gitlab.com/code-mobi/board-checker/pkg/search"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
 )
 
 func (app *App) LoggedIn(r *http.Request) (bool, *models.User, error) {
@@ -29,3 +40,125 @@ func (app *App) CurrentUser(r *http.Request) *models.User {
 	}
 	return nil
 }
+
+// Search uses the database FULLTEXT indexes and falls back to the
+// in-process index, rebuilding it when it is older than five minutes.
+func (app *App) Search(db *models.Database, q string, limit int) (search.Results, error) {
+	results, err := db.Search(q, limit)
+	if err != models.ErrFullTextUnsupported {
+		return results, err
+	}
+
+	if app.SearchIndex.Stale(5 * time.Minute) {
+		docs, err := db.SearchDocuments()
+		if err != nil {
+			return nil, err
+		}
+		app.SearchIndex.Rebuild(docs)
+	}
+	return app.SearchIndex.Search(q, limit), nil
+}
+
+// baseURL is the URL of the server in links and QR codes, that of the
+// request when none is configured.
+func (app *App) baseURL(r *http.Request) string {
+	if app.BaseURL != "" {
+		return app.BaseURL
+	}
+	return "http://" + r.Host
+}
+
+func (app *App) PhotoStore() *store.Store {
+	return &store.Store{
+		Dir:            app.StoreDir,
+		Limits:         app.UploadLimits,
+		GeofenceRadius: app.GeofenceRadius,
+		ScanQR:         app.UploadScanQR,
+		QR:             qr.Reader{Signer: app.QRSigner(), LegacyIDs: app.QRLegacyIDs},
+	}
+}
+
+// SaveUploadedPhotos saves every "uploadFile" of a multipart request, and
+// the files inside uploaded ZIP archives, as photos of a worksheet, or of
+// the inbox for models.InboxWorksheetID. The
+// "numbering" and "pattern" values choose how running numbers are given;
+// see store.SaveBatch. A "slot" must be one of the checklist of the
+// worksheet; photos for the inbox keep theirs until they find one.
+func (app *App) SaveUploadedPhotos(db *models.Database, r *http.Request, worksheetID int) (store.BatchResults, error) {
+	var pattern *regexp.Regexp
+	if s := r.FormValue("pattern"); s != "" {
+		var err error
+		pattern, err = regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	runningNumber, _ := strconv.Atoi(r.FormValue("running_number"))
+	template := &models.Photo{
+		WorksheetID:   worksheetID,
+		RunningNumber: runningNumber,
+		Location:      r.FormValue("location"),
+		Caption:       r.FormValue("caption"),
+		Slot:          r.FormValue("slot"),
+		UUID:          strings.ToLower(r.FormValue("uuid")),
+	}
+	if worksheetID != models.InboxWorksheetID {
+		err := db.CheckSlot(worksheetID, template.Slot)
+		if err == models.ErrUnknownSlot {
+			return nil, errUnknownSlot
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if user := app.CurrentUser(r); user != nil {
+		template.UserID = user.ID
+	}
+
+	files, results, closeFiles := store.MultipartFiles(r.MultipartForm.File["uploadFile"])
+	defer closeFiles()
+	if len(files) > 0 {
+		results = append(results, app.PhotoStore().SaveBatch(db, template, files, r.FormValue("numbering"), pattern)...)
+	}
+	return results, nil
+}
+
+// maxBoundarySize caps the size of an uploaded GeoJSON or KML file.
+const maxBoundarySize = 10 << 20
+
+var errBoundaryTooLarge = errors.New("boundary file is larger than 10 MB")
+
+// readBoundaries parses the zone boundaries of a GeoJSON or KML file.
+func readBoundaries(r io.Reader) ([]geo.Feature, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxBoundarySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxBoundarySize {
+		return nil, errBoundaryTooLarge
+	}
+	return geo.Parse(b)
+}
+
+// mergeBoundaries joins the polygons of every feature into one boundary.
+func mergeBoundaries(features []geo.Feature) geo.MultiPolygon {
+	boundary := geo.MultiPolygon{}
+	for _, feature := range features {
+		boundary = append(boundary, feature.Boundary...)
+	}
+	return boundary
+}
+
+// autoZone returns the zone to use for a record with the chosen zoneID:
+// zoneID itself unless it is 0, else the zone containing the location or,
+// failing that, the board. It returns 0 when no zone is found.
+func autoZone(db *models.Database, zoneID int, location *models.Location, boardID int) (int, error) {
+	if zoneID != 0 {
+		return zoneID, nil
+	}
+	zone, err := db.LocateZone(location, boardID)
+	if err != nil || zone == nil {
+		return 0, err
+	}
+	return zone.ID, nil
+}
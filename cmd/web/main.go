@@ -4,12 +4,20 @@ import (
 	"database/sql"
 	"flag"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs"
 	_ "github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
+	"gitlab.com/code-mobi/board-checker/pkg/deck"
+	"gitlab.com/code-mobi/board-checker/pkg/search"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
+	"gitlab.com/code-mobi/board-checker/pkg/tiles"
+	"gitlab.com/code-mobi/board-checker/pkg/tus"
 )
 
 func init() {
@@ -24,13 +32,36 @@ func init() {
 	// log.SetLevel(log.WarnLevel)
 }
 
+// defaultSecret is the -secret of development servers. Being public, it
+// protects nothing.
+const defaultSecret = "y8eETRxBcYUyvv9x6c6Pk7JsWf7bpC37"
+
 func main() {
 	addr := flag.String("addr", ":4000", "HTTP Network Address")
 	dsn := flag.String("dsn", os.Getenv("BC_DSN"), "Database DSN")
+	baseURL := flag.String("base-url", "", "URL of the server in QR codes, labels, reports and API links, such as https://checker.example.com")
 	htmlDir := flag.String("html-dir", os.Getenv("GOPATH")+"/src/gitlab.com/code-mobi/board-checker/ui/html", "Path to static assets")
-	secret := flag.String("secret", "y8eETRxBcYUyvv9x6c6Pk7JsWf7bpC37", "Secret key")
+	secret := flag.String("secret", defaultSecret, "Secret key")
+	qrSecret := flag.String("qr-secret", os.Getenv("BC_QR_SECRET"), "Secret key that signs worksheet and board QR codes, by default -secret")
 	staticDir := flag.String("static-dir", os.Getenv("GOPATH")+"/src/gitlab.com/code-mobi/board-checker/ui/static", "Path to static assets")
 	storeDir := flag.String("store-dir", os.Getenv("BC_STORE"), "Path to store files")
+	uploadMaxSize := flag.Int64("upload-max-size", 1<<30, "Largest resumable upload in bytes")
+	uploadTTL := flag.Duration("upload-ttl", 24*time.Hour, "How long an unfinished resumable upload is kept")
+	uploadMaxFileSize := flag.Int64("upload-max-file-size", 100<<20, "Largest photo in bytes")
+	uploadMaxPixels := flag.Int("upload-max-pixels", 50000000, "Largest photo in pixels")
+	uploadAllowVideo := flag.Bool("upload-allow-video", false, "Accept MP4 videos besides JPEG and PNG photos")
+	uploadSanitize := flag.Bool("upload-sanitize", false, "Re-encode uploaded photos, keeping their EXIF data in the database")
+	uploadScanQR := flag.Bool("upload-scan-qr", true, "Read worksheet QR codes from uploaded photos to flag those filed under another worksheet")
+	qrLegacyIDs := flag.Bool("qr-legacy-ids", false, "Read unsigned QR codes in uploaded photos too: bare worksheet IDs and worksheet page URLs")
+	qrPublicStatus := flag.Bool("qr-public-status", false, "Show the status of a worksheet or board to anyone who scans its QR code")
+	geofenceRadius := flag.Float64("geofence-radius", 100, "Largest distance in metres between a photo and its board")
+	mbtiles := flag.String("mbtiles", "", "MBTiles file served at /tiles for maps on networks without internet access, in builds with -tags mbtiles")
+	tileURL := flag.String("tile-url", "", "Tile URL template of maps, by default /tiles/{z}/{x}/{y} with -mbtiles and OpenStreetMap without")
+	tileAttribution := flag.String("tile-attribution", "", "Attribution shown on maps, by default that of the MBTiles file or OpenStreetMap")
+	leafletURL := flag.String("leaflet-url", "/static/node_modules/leaflet/dist", "URL of the directory holding leaflet.js and leaflet.css")
+	reportFont := flag.String("report-font", "", "TrueType font file of PDF reports, for text outside Latin-1 such as Thai")
+	deckTemplates := flag.String("deck-templates", "", "JSON file of the slide templates of PPTX decks")
+	idempotencyTTL := flag.Duration("idempotency-ttl", 24*time.Hour, "How long to replay responses for a repeated Idempotency-Key")
 
 	flag.Parse()
 
@@ -45,8 +76,78 @@ func main() {
 		StaticDir: *staticDir,
 		StoreDir:  *storeDir,
 		SecretKey: *secret,
+		QRSecret:  *qrSecret,
+		BaseURL:   strings.TrimSuffix(*baseURL, "/"),
+
+		SearchIndex:    search.NewIndex(),
+		GeofenceRadius: *geofenceRadius,
+		QRPublicStatus: *qrPublicStatus,
+		QRLegacyIDs:    *qrLegacyIDs,
+		ReportFont:     *reportFont,
+		IdempotencyTTL: *idempotencyTTL,
+		Uploads:        tus.NewStore(filepath.Join(*storeDir, store.WorkDir, "uploads"), *uploadTTL),
+		UploadMaxSize:  *uploadMaxSize,
+		UploadScanQR:   *uploadScanQR,
+		UploadLimits: store.Limits{
+			MaxBytes:   *uploadMaxFileSize,
+			MaxPixels:  *uploadMaxPixels,
+			AllowVideo: *uploadAllowVideo,
+			Sanitize:   *uploadSanitize,
+		},
+	}
+
+	if app.QRSecret == "" {
+		app.QRSecret = *secret
+	}
+	if *secret == defaultSecret {
+		log.Warn("-secret is the public default: anyone can forge sessions and API tokens. Set a secret of your own")
+	}
+	if app.QRSecret == defaultSecret {
+		log.Warn("-qr-secret is the public default: anyone can make QR codes for any worksheet or board. Set -qr-secret")
+	}
+
+	if app.BaseURL == "" {
+		log.Warn("No -base-url: QR codes, labels and reports link to the Host of each request")
+	} else if u, err := url.Parse(app.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Fatal("-base-url must be an http or https URL such as https://checker.example.com")
 	}
 
+	app.Map = MapConfig{
+		LeafletURL:  strings.TrimSuffix(*leafletURL, "/"),
+		TileURL:     "https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png",
+		Attribution: `&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors`,
+		MinZoom:     0,
+		MaxZoom:     19,
+	}
+	if *mbtiles != "" {
+		t, err := tiles.Open(*mbtiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer t.Close()
+		app.Tiles = t
+		app.Map.TileURL = "/tiles/{z}/{x}/{y}"
+		app.Map.Attribution = t.Metadata["attribution"]
+		app.Map.MinZoom = t.MinZoom()
+		app.Map.MaxZoom = t.MaxZoom()
+	}
+	if *tileURL != "" {
+		app.Map.TileURL = *tileURL
+	}
+	if *tileAttribution != "" {
+		app.Map.Attribution = *tileAttribution
+	}
+
+	if *deckTemplates != "" {
+		templates, err := deck.LoadTemplates(*deckTemplates)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.DeckTemplates = templates
+	}
+
+	go app.ExpireUploads(time.Hour)
+
 	log.Println("Starting server on " + *addr)
 	err := http.ListenAndServe(*addr, app.Routes())
 	log.Fatal(err)
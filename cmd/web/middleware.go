@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"path"
+	"strings"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	log "github.com/sirupsen/logrus"
@@ -72,19 +77,8 @@ func (app *App) JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("Authorization")
 		if tokenString != "" {
-			fmt.Sscanf(tokenString, "Bearer %s", &tokenString)
-			token, _ := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(app.SecretKey), nil
-			})
-
-			if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-
-				fmt.Printf("%v %v\n", claims.Name, claims.StandardClaims.ExpiresAt)
-
-				ctx := context.WithValue(r.Context(), ctxUser, models.User{
-					ID:   claims.UserID,
-					Name: claims.Name,
-				})
+			if user := app.tokenUser(tokenString); user != nil {
+				ctx := context.WithValue(r.Context(), ctxUser, user)
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
@@ -96,3 +90,140 @@ func (app *App) JWTMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireTokenUser refuses API requests without a valid token.
+func (app *App) RequireTokenUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.tokenUser(r.Header.Get("Authorization"))
+		if user == nil {
+			app.APIClientErrorWithMessage(w, http.StatusUnauthorized, "Authorization Required!")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxUser, user)))
+	})
+}
+
+// TokenUser is JWTMiddleware for requests that don't need a user, such as
+// uploads queued offline: an invalid or expired token is ignored instead of
+// refused.
+func (app *App) TokenUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := app.tokenUser(r.Header.Get("Authorization")); user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), ctxUser, user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenUser returns the user of a "Bearer" Authorization header, or nil
+// when it holds no valid token.
+func (app *App) tokenUser(header string) *models.User {
+	if header == "" {
+		return nil
+	}
+	tokenString := header
+	fmt.Sscanf(header, "Bearer %s", &tokenString)
+	token, _ := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(app.SecretKey), nil
+	})
+	if token == nil {
+		return nil
+	}
+
+	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
+		return &models.User{
+			ID:   claims.UserID,
+			Name: claims.Name,
+		}
+	}
+	return nil
+}
+
+// storeFiles serves the photos of the store and nothing else: not its
+// directory listings, its work directory or the uploads directory earlier
+// versions kept in it.
+func storeFiles(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := path.Clean("/" + r.URL.Path)
+		if p == "/" || strings.HasSuffix(r.URL.Path, "/") || strings.HasPrefix(p, "/uploads/") ||
+			strings.Contains(p, "/.") {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Idempotent replays the stored response when a client repeats a request
+// with the same Idempotency-Key header, so retries after a timeout don't
+// repeat the work. Requests without the header pass through. Keys are
+// scoped to the token user and path, so one client can't replay another's
+// response by reusing its key.
+func (app *App) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Idempotency-Key")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID := 0
+		if user := app.CurrentUser(r); user != nil {
+			userID = user.ID
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%d %s %s", userID, r.URL.Path, header)))
+		key := hex.EncodeToString(sum[:])
+
+		db := &models.Database{connect(app.DSN)}
+		defer db.Close()
+
+		stored, err := db.ReserveIdempotencyKey(key, r.URL.Path, app.IdempotencyTTL)
+		if err == models.ErrIdempotencyKeyInUse {
+			app.APIClientErrorWithMessage(w, http.StatusConflict, err.Error())
+			return
+		} else if err == models.ErrIdempotencyKeyMismatch {
+			app.APIClientErrorWithMessage(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		} else if err != nil {
+			app.APIServerError(w, err)
+			return
+		}
+
+		if stored != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Response)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= 500 {
+			err = db.ReleaseIdempotencyKey(key)
+		} else {
+			err = db.SaveIdempotentResponse(key, rec.status, rec.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("Idempotent %s: %s", key, err)
+		}
+	})
+}
+
+// responseRecorder passes a response through while keeping a copy.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -14,7 +14,12 @@ func (app *App) Routes() http.Handler {
 	router.HandleFunc("/user/login", app.VerifyUser).Methods("POST")
 	router.Handle("/user/logout", app.RequireLogin(http.HandlerFunc(app.LogoutUser))).Methods("POST")
 
-	router.Handle("/createqr/{data}", http.HandlerFunc(app.CreateQR)).Methods("GET")
+	router.Handle("/search",
+		app.RequireLogin(http.HandlerFunc(app.ShowSearch))).Methods("GET")
+
+	router.Handle("/createqr/{data}",
+		app.RequireLogin(http.HandlerFunc(app.CreateQR))).Methods("GET")
+	router.Handle("/q/{token}", http.HandlerFunc(app.OpenQR)).Methods("GET")
 
 	// Team
 	router.Handle("/teams",
@@ -41,18 +46,104 @@ func (app *App) Routes() http.Handler {
 		app.RequireLogin(http.HandlerFunc(app.EditZone))).Methods("GET")
 	router.Handle("/zone/{zone_id:[0-9]+}/edit",
 		app.RequireLogin(http.HandlerFunc(app.SaveZone))).Methods("POST")
+	router.Handle("/zone/{zone_id:[0-9]+}/boundary",
+		app.RequireLogin(http.HandlerFunc(app.SaveZoneBoundary))).Methods("POST")
+	router.Handle("/zones/import",
+		app.RequireLogin(http.HandlerFunc(app.ImportZones))).Methods("GET", "POST")
+	router.Handle("/zones/outside",
+		app.RequireLogin(http.HandlerFunc(app.ZoneOutliers))).Methods("GET")
+
+	// Board
+	router.Handle("/boards/labels.{format:pdf|zpl}",
+		app.RequireLogin(http.HandlerFunc(app.BoardLabels))).Methods("GET")
+	router.Handle("/boards",
+		app.RequireLogin(http.HandlerFunc(app.IndexBoard))).Methods("GET")
+	router.Handle("/board/new",
+		app.RequireLogin(http.HandlerFunc(app.NewBoard))).Methods("GET")
+	router.Handle("/board/new",
+		app.RequireLogin(http.HandlerFunc(app.SaveBoard))).Methods("POST")
+	router.Handle("/board/{board_id:[0-9]+}/qr.{format:png|svg}",
+		app.RequireLogin(http.HandlerFunc(app.BoardQR))).Methods("GET")
+	router.Handle("/board/{board_id:[0-9]+}",
+		app.RequireLogin(http.HandlerFunc(app.ShowBoard))).Methods("GET")
+	router.Handle("/board/{board_id:[0-9]+}/edit",
+		app.RequireLogin(http.HandlerFunc(app.EditBoard))).Methods("GET")
+	router.Handle("/board/{board_id:[0-9]+}/edit",
+		app.RequireLogin(http.HandlerFunc(app.SaveBoard))).Methods("POST")
+	router.Handle("/board/{board_id:[0-9]+}/delete",
+		app.RequireLogin(http.HandlerFunc(app.DeleteBoard))).Methods("POST")
+
+	// Checklist
+	router.Handle("/checklists",
+		app.RequireLogin(http.HandlerFunc(app.IndexChecklist))).Methods("GET")
+	router.Handle("/checklist/new",
+		app.RequireLogin(http.HandlerFunc(app.NewChecklist))).Methods("GET")
+	router.Handle("/checklist/new",
+		app.RequireLogin(http.HandlerFunc(app.SaveChecklist))).Methods("POST")
+	router.Handle("/checklist/{checklist_id:[0-9]+}/edit",
+		app.RequireLogin(http.HandlerFunc(app.EditChecklist))).Methods("GET")
+	router.Handle("/checklist/{checklist_id:[0-9]+}/edit",
+		app.RequireLogin(http.HandlerFunc(app.SaveChecklist))).Methods("POST")
+	router.Handle("/checklist/{checklist_id:[0-9]+}/delete",
+		app.RequireLogin(http.HandlerFunc(app.DeleteChecklist))).Methods("POST")
 
 	// Worksheet
 	router.Handle("/worksheet/new",
 		app.RequireLogin(http.HandlerFunc(app.NewWorksheet))).Methods("GET")
 	router.Handle("/worksheet/new",
 		app.RequireLogin(http.HandlerFunc(app.SaveWorksheet))).Methods("POST")
+	router.Handle("/worksheet/import",
+		app.RequireLogin(http.HandlerFunc(app.ImportWorksheets))).Methods("GET", "POST")
+	router.Handle("/photos/inbox",
+		app.RequireLogin(http.HandlerFunc(app.InboxPhotos))).Methods("GET")
+	router.Handle("/photos/inbox/{photo_id:[0-9]+}",
+		app.RequireLogin(http.HandlerFunc(app.AssignPhoto))).Methods("POST")
+	router.Handle("/photos/review",
+		app.RequireLogin(http.HandlerFunc(app.ReviewPhotos))).Methods("GET")
+	router.Handle("/photos/review/{photo_id:[0-9]+}",
+		app.RequireLogin(http.HandlerFunc(app.ReviewPhoto))).Methods("POST")
 	router.Handle("/worksheet/date/{date}",
 		app.RequireLogin(http.HandlerFunc(app.IndexWorksheetByDate))).Methods("GET")
 	router.Handle("/worksheet/team/{team_id:[0-9]+}",
 		app.RequireLogin(http.HandlerFunc(app.IndexWorksheetByTeam))).Methods("GET")
+	router.Handle("/worksheet/team/{team_id:[0-9]+}/route",
+		app.RequireLogin(http.HandlerFunc(app.ShowTeamRoute))).Methods("GET")
+	router.Handle("/worksheet/team/{team_id:[0-9]+}/route.gpx",
+		app.RequireLogin(http.HandlerFunc(app.ExportTeamRoute))).Methods("GET")
 	router.Handle("/worksheet/zone/{zone_id:[0-9]+}",
 		app.RequireLogin(http.HandlerFunc(app.IndexWorksheetByZone))).Methods("GET")
+	router.Handle("/worksheet/date/{date}/export.{format:geojson|kml|gpx}",
+		app.RequireLogin(http.HandlerFunc(app.ExportPhotos))).Methods("GET")
+	router.Handle("/worksheet/team/{team_id:[0-9]+}/export.{format:geojson|kml|gpx}",
+		app.RequireLogin(http.HandlerFunc(app.ExportPhotos))).Methods("GET")
+	router.Handle("/worksheet/zone/{zone_id:[0-9]+}/export.{format:geojson|kml|gpx}",
+		app.RequireLogin(http.HandlerFunc(app.ExportPhotos))).Methods("GET")
+	router.Handle("/worksheet/labels.{format:pdf|zpl}",
+		app.RequireLogin(http.HandlerFunc(app.WorksheetLabels))).Methods("GET")
+	router.Handle("/worksheet/date/{date}/labels.{format:pdf|zpl}",
+		app.RequireLogin(http.HandlerFunc(app.WorksheetLabels))).Methods("GET")
+	router.Handle("/worksheet/team/{team_id:[0-9]+}/labels.{format:pdf|zpl}",
+		app.RequireLogin(http.HandlerFunc(app.WorksheetLabels))).Methods("GET")
+	router.Handle("/worksheet/zone/{zone_id:[0-9]+}/labels.{format:pdf|zpl}",
+		app.RequireLogin(http.HandlerFunc(app.WorksheetLabels))).Methods("GET")
+	router.Handle("/worksheet/export.xlsx",
+		app.RequireLogin(http.HandlerFunc(app.ExportWorksheets))).Methods("GET")
+	router.Handle("/worksheet/date/{date}/export.xlsx",
+		app.RequireLogin(http.HandlerFunc(app.ExportWorksheets))).Methods("GET")
+	router.Handle("/worksheet/team/{team_id:[0-9]+}/export.xlsx",
+		app.RequireLogin(http.HandlerFunc(app.ExportWorksheets))).Methods("GET")
+	router.Handle("/worksheet/zone/{zone_id:[0-9]+}/export.xlsx",
+		app.RequireLogin(http.HandlerFunc(app.ExportWorksheets))).Methods("GET")
+	router.Handle("/worksheet/date/{date}/report.pdf",
+		app.RequireLogin(http.HandlerFunc(app.BatchReport))).Methods("GET")
+	router.Handle("/worksheet/zone/{zone_id:[0-9]+}/report.pdf",
+		app.RequireLogin(http.HandlerFunc(app.BatchReport))).Methods("GET")
+	router.Handle("/worksheet/date/{date}/deck.pptx",
+		app.RequireLogin(http.HandlerFunc(app.BatchDeck))).Methods("GET")
+	router.Handle("/worksheet/campaign",
+		app.RequireLogin(http.HandlerFunc(app.IndexWorksheetByCampaign))).Queries("name", "{name}").Methods("GET")
+	router.Handle("/worksheet/campaign/deck.pptx",
+		app.RequireLogin(http.HandlerFunc(app.BatchDeck))).Queries("name", "{name}").Methods("GET")
 	router.Handle("/worksheet/search",
 		app.RequireLogin(http.HandlerFunc(app.IndexWorksheetBySearch))).Queries("q", "{q}").Methods("GET")
 
@@ -65,22 +156,76 @@ func (app *App) Routes() http.Handler {
 		app.RequireLogin(http.HandlerFunc(app.EditWorksheet))).Methods("GET")
 	worksheetRouter.Handle("/edit",
 		app.RequireLogin(http.HandlerFunc(app.SaveWorksheet))).Methods("POST")
+	worksheetRouter.Handle("/status",
+		app.RequireLogin(http.HandlerFunc(app.ChangeWorksheetStatus))).Methods("POST")
 	worksheetRouter.Handle("/delete",
 		app.RequireLogin(http.HandlerFunc(app.DeleteWorksheet))).Methods("POST")
 	worksheetRouter.Handle("/maps",
 		app.RequireLogin(http.HandlerFunc(app.ShowWorksheetMaps))).Methods("GET")
+	worksheetRouter.Handle("/export.{format:geojson|kml|gpx}",
+		app.RequireLogin(http.HandlerFunc(app.ExportPhotos))).Methods("GET")
+	worksheetRouter.Handle("/export.xlsx",
+		app.RequireLogin(http.HandlerFunc(app.ExportWorksheetPhotos))).Methods("GET")
+	worksheetRouter.Handle("/labels.{format:pdf|zpl}",
+		app.RequireLogin(http.HandlerFunc(app.WorksheetLabels))).Methods("GET")
+	worksheetRouter.Handle("/qr.{format:png|svg}",
+		app.RequireLogin(http.HandlerFunc(app.WorksheetQR))).Methods("GET")
+	worksheetRouter.Handle("/report.pdf",
+		app.RequireLogin(http.HandlerFunc(app.WorksheetReport))).Methods("GET")
+	worksheetRouter.Handle("/deck.pptx",
+		app.RequireLogin(http.HandlerFunc(app.WorksheetDeck))).Methods("GET")
 	worksheetRouter.Handle("/photo/new",
 		app.RequireLogin(http.HandlerFunc(app.NewPhoto))).Methods("GET")
 	worksheetRouter.Handle("/photo/new",
 		app.RequireLogin(http.HandlerFunc(app.InsertPhoto))).Methods("POST")
+	worksheetRouter.Handle("/photo/{photo_id:[0-9]+}/slot",
+		app.RequireLogin(http.HandlerFunc(app.SetPhotoSlot))).Methods("POST")
 
 	// API
 	apiRouter := router.PathPrefix("/api").Subrouter()
 	apiRouter.HandleFunc("/user/login", app.APIUserLogin).Methods("POST")
+	apiRouter.Handle("/search", http.HandlerFunc(app.APISearch)).Methods("GET")
+	apiRouter.Handle("/sync", app.RequireTokenUser(http.HandlerFunc(app.APISync))).Methods("GET")
 	apiRouter.Handle("/worksheets", http.HandlerFunc(app.APIListWorksheets)).Methods("GET")
+	apiRouter.Handle("/worksheets/nearby", http.HandlerFunc(app.APINearbyWorksheets)).Methods("GET")
 	apiRouter.Handle("/worksheet/{worksheet_id:[0-9]+}", http.HandlerFunc(app.APIShowWorksheet)).Methods("GET")
-	apiRouter.Handle("/worksheet/{worksheet_id:[0-9]+}/photo/new", http.HandlerFunc(app.APIInsertPhoto)).Methods("POST")
+	apiRouter.Handle("/worksheet/{worksheet_id:[0-9]+}/status", app.JWTMiddleware(http.HandlerFunc(app.APIChangeWorksheetStatus))).Methods("POST")
+	apiRouter.Handle("/worksheet/{worksheet_id:[0-9]+}/photos", http.HandlerFunc(app.APIListPhotos)).Methods("GET")
+	apiRouter.Handle("/worksheet/{worksheet_id:[0-9]+}/markers", http.HandlerFunc(app.APIWorksheetMarkers)).Methods("GET")
+	apiRouter.Handle("/worksheet/{worksheet_id:[0-9]+}/export.{format:geojson|kml|gpx}", http.HandlerFunc(app.APIExportPhotos)).Methods("GET")
+	apiRouter.Handle("/photos/nearby", http.HandlerFunc(app.APINearbyPhotos)).Methods("GET")
+	apiRouter.Handle("/photos/inbox", app.RequireTokenUser(app.Idempotent(http.HandlerFunc(app.APIInboxPhotos)))).Methods("POST")
+	apiRouter.Handle("/photos/rejected", app.JWTMiddleware(http.HandlerFunc(app.APIRejectedPhotos))).Methods("GET")
+	apiRouter.Handle("/photos/export.{format:geojson|kml|gpx}", http.HandlerFunc(app.APIExportPhotos)).Methods("GET")
+	apiRouter.Handle("/worksheet/{worksheet_id:[0-9]+}/photo/new", app.TokenUser(app.Idempotent(http.HandlerFunc(app.APIInsertPhoto)))).Methods("POST")
+	apiRouter.Handle("/uploads", http.HandlerFunc(app.TusOptions)).Methods("OPTIONS")
+	apiRouter.Handle("/uploads", app.RequireTokenUser(http.HandlerFunc(app.TusCreate))).Methods("POST")
+	apiRouter.Handle("/uploads/{upload_id}", http.HandlerFunc(app.TusOptions)).Methods("OPTIONS")
+	apiRouter.Handle("/uploads/{upload_id}", app.RequireTokenUser(http.HandlerFunc(app.TusHead))).Methods("HEAD")
+	apiRouter.Handle("/uploads/{upload_id}", app.RequireTokenUser(http.HandlerFunc(app.TusPatch))).Methods("PATCH")
+	apiRouter.Handle("/uploads/{upload_id}", app.RequireTokenUser(http.HandlerFunc(app.TusDelete))).Methods("DELETE")
+	apiRouter.Handle("/teams", http.HandlerFunc(app.APIListTeams)).Methods("GET")
+	apiRouter.Handle("/zones", http.HandlerFunc(app.APIListZones)).Methods("GET")
+	apiRouter.Handle("/zones/import", app.RequireTokenUser(http.HandlerFunc(app.APIImportZones))).Methods("POST")
+	apiRouter.Handle("/zones/locate", http.HandlerFunc(app.APILocateZone)).Methods("GET")
+	apiRouter.Handle("/zones/outside", http.HandlerFunc(app.APIZoneOutliers)).Methods("GET")
+	apiRouter.Handle("/zone/{zone_id:[0-9]+}", http.HandlerFunc(app.APIShowZone)).Methods("GET")
+	apiRouter.Handle("/zone/{zone_id:[0-9]+}/boundary", app.RequireTokenUser(http.HandlerFunc(app.APISaveZoneBoundary))).Methods("PUT", "DELETE")
+	apiRouter.Handle("/boards", http.HandlerFunc(app.APIListBoards)).Methods("GET")
+	apiRouter.Handle("/boards/nearby", http.HandlerFunc(app.APINearbyBoards)).Methods("GET")
+	apiRouter.Handle("/boards", app.RequireTokenUser(http.HandlerFunc(app.APISaveBoard))).Methods("POST")
+	apiRouter.Handle("/board/{board_id:[0-9]+}", http.HandlerFunc(app.APIShowBoard)).Methods("GET")
+	apiRouter.Handle("/board/{board_id:[0-9]+}", app.RequireTokenUser(http.HandlerFunc(app.APISaveBoard))).Methods("PUT")
+	apiRouter.Handle("/board/{board_id:[0-9]+}", app.RequireTokenUser(http.HandlerFunc(app.APIDeleteBoard))).Methods("DELETE")
 	apiRouter.Handle("/team/{team_id:[0-9]+}/worksheets", http.HandlerFunc(app.APIListWorksheetsByTeam)).Methods("GET")
+	apiRouter.Handle("/team/{team_id:[0-9]+}/route", http.HandlerFunc(app.APITeamRoute)).Methods("GET")
+	apiRouter.Handle("/team/{team_id:[0-9]+}/route.{format:gpx}", http.HandlerFunc(app.APITeamRoute)).Methods("GET")
+
+	// Thumbnails
+	router.Handle("/thumb/{photo_id:[0-9]+}", http.HandlerFunc(app.Thumbnail)).Methods("GET")
+
+	// Map tiles
+	router.Handle("/tiles/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}", http.HandlerFunc(app.Tile)).Methods("GET")
 
 	// File Static
 	fileServer := http.FileServer(http.Dir(app.StaticDir))
@@ -88,7 +233,7 @@ func (app *App) Routes() http.Handler {
 
 	// file Store
 	fileServer = http.FileServer(http.Dir(app.StoreDir))
-	router.PathPrefix("/store/").Handler(http.StripPrefix("/store/", fileServer))
+	router.PathPrefix("/store/").Handler(http.StripPrefix("/store/", storeFiles(fileServer)))
 
 	router.NotFoundHandler = http.HandlerFunc(app.NotFound)
 
@@ -6,32 +6,67 @@ import (
 	"html/template"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
 	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/search"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
 )
 
 type HTMLData struct {
-	Title        string
-	User         *models.User
-	LoggedIn     bool
-	HiddenNavBar bool
-	Flash        string
-	Error        string
-	Path         string
-	Form         interface{}
-	Dates        []string
-	Team         *models.Team
-	Teams        models.Teams
-	Zone         *models.Zone
-	Zones        models.Zones
-	Worksheet    *models.Worksheet
-	Worksheets   models.Worksheets
-	Photos       models.Photos
-	Locations    models.Locations
-	FormFields   models.FormFields
-	PageInfo     *models.PageInfo
+	Title            string
+	User             *models.User
+	LoggedIn         bool
+	HiddenNavBar     bool
+	Flash            string
+	Error            string
+	Path             string
+	RequestURI       string
+	ExportPath       string
+	DeckLinks        []DeckLink
+	Campaigns        []string
+	Form             interface{}
+	Dates            []string
+	Team             *models.Team
+	Teams            models.Teams
+	Zone             *models.Zone
+	Zones            models.Zones
+	ZoneImports      []*models.ZoneImport
+	ZoneOutliers     []*models.ZoneOutlier
+	Board            *models.Board
+	Boards           models.Boards
+	BoardTypes       []string
+	Inspections      []*models.Inspection
+	Worksheet        *models.Worksheet
+	Worksheets       models.Worksheets
+	WorksheetImports models.WorksheetImports
+	Status           string
+	Statuses         []string
+	Incomplete       bool
+	StatusChanges    []*models.StatusChange
+	ReviewItems      []*models.ReviewItem
+	ReviewFilter     *forms.ReviewFilter
+	ReviewReasons    []models.ReviewReason
+	Route            *models.Route
+	Photos           models.Photos
+	QRMismatches     []*models.QRMismatch
+	FormFields       models.FormFields
+	PageInfo         *models.PageInfo
+	PageURL          string
+	Compliance       *models.Compliance
+	Completion       *models.Completion
+	Checklist        *models.Checklist
+	Checklists       []*models.Checklist
+	Query            string
+	Results          search.Results
+
+	UploadResults store.BatchResults
+
+	Map *MapConfig
 }
 
 func (app *App) RenderHTML(w http.ResponseWriter, r *http.Request, pages []string, data *HTMLData) {
@@ -40,6 +75,8 @@ func (app *App) RenderHTML(w http.ResponseWriter, r *http.Request, pages []strin
 	}
 
 	data.Path = r.URL.Path
+	data.RequestURI = r.URL.RequestURI()
+	data.Map = &app.Map
 
 	if user := app.CurrentUser(r); user != nil {
 		data.LoggedIn = true
@@ -57,6 +94,10 @@ func (app *App) RenderHTML(w http.ResponseWriter, r *http.Request, pages []strin
 		"humanDate":   humanDate,
 		"timeString":  timeString,
 		"humanNumber": humanNumber,
+		"km":          km,
+		"safeHTML":    safeHTML,
+		"statusLabel": statusLabel,
+		"reasonName":  models.ReviewReasonName,
 		"marshal": func(v interface{}) template.JS {
 			a, _ := json.Marshal(v)
 			return template.JS(a)
@@ -97,7 +138,28 @@ func humanNumber(amount float64) string {
 	return humanize.Commaf(amount)
 }
 
+// km formats a distance in metres as kilometres.
+func km(metres float64) string {
+	return strconv.FormatFloat(metres/1000, 'f', 1, 64) + " km"
+}
+
 func marshal(v interface{}) template.JS {
 	a, _ := json.Marshal(v)
 	return template.JS(a)
 }
+
+// safeHTML marks markup that was escaped when it was built, such as search
+// highlights, as trusted.
+func safeHTML(s string) template.HTML {
+	return template.HTML(s)
+}
+
+// statusLabel names a worksheet status for people, such as "In progress"
+// for in_progress.
+func statusLabel(status string) string {
+	s := strings.Replace(status, "_", " ", -1)
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
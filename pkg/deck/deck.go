@@ -0,0 +1,350 @@
+// Package deck writes proof of posting decks: PowerPoint presentations
+// with a slide for each photo of a board, its details and a map of where
+// it was taken.
+package deck
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/staticmap"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
+	"gitlab.com/code-mobi/board-checker/pkg/tiles"
+)
+
+// Slide is a photo of a worksheet and where it should have been taken.
+type Slide struct {
+	Worksheet *models.Worksheet
+	Expected  *models.Location
+	Photo     *models.TakenPhoto
+}
+
+// Deck writes slides as a PPTX file.
+type Deck struct {
+	Store *store.Store
+
+	// Tiles, if set, are drawn under the slide maps. Without them slides
+	// link to OpenStreetMap instead.
+	Tiles *tiles.MBTiles
+}
+
+// Slide layout of 16:9 in EMU, 914400 an inch.
+const (
+	slideWidth  = 12192000
+	slideHeight = 6858000
+	margin      = 457200
+	titleHeight = 685800
+	gap         = 228600
+	columnWidth = 4114800
+	mapHeight   = columnWidth * 3 / 4
+	mapWidthPx  = 480
+	mapHeightPx = 360
+	photoSize   = 1280
+)
+
+type box struct {
+	X, Y, W, H int64
+}
+
+type run struct {
+	Text string
+	Bold bool
+	Link string
+}
+
+type paragraph struct {
+	Align string
+	Runs  []run
+}
+
+type text struct {
+	ID         int
+	Name       string
+	Anchor     string
+	Size       int
+	Paragraphs []paragraph
+	box
+}
+
+type picture struct {
+	ID   int
+	Name string
+	Rel  string
+	box
+}
+
+type slidePart struct {
+	Texts    []text
+	Pictures []picture
+}
+
+type relationship struct {
+	ID       string
+	Type     string
+	Target   string
+	External bool
+}
+
+// Write writes a deck titled title of the slides made with template t. It
+// opens with a title slide. Photos without an image, such as videos, are
+// left out.
+func (d *Deck) Write(w io.Writer, title string, t *Template, slides []*Slide) error {
+	if t == nil {
+		t = DefaultTemplate
+	}
+	z := zip.NewWriter(w)
+
+	logo, logoExt, err := readLogo(t.Logo)
+	if err != nil {
+		return err
+	}
+	if logo != nil {
+		if err := writePart(z, "ppt/media/logo"+logoExt, logo); err != nil {
+			return err
+		}
+	}
+	logoPicture := func(rels *[]relationship, at box) []picture {
+		if logo == nil {
+			return nil
+		}
+		*rels = append(*rels, relationship{ID: "rIdLogo", Type: "image", Target: "../media/logo" + logoExt})
+		return []picture{{ID: 10, Name: "Logo", Rel: "rIdLogo", box: fitImage(logo, at)}}
+	}
+
+	// Only photos with a thumbnail get a slide, which leaves out videos.
+	photos := make([]string, len(slides))
+	count := 0
+	for i, s := range slides {
+		if path, err := d.Store.Thumbnail(s.Photo.Photo, photoSize); err == nil {
+			photos[i] = path
+			count++
+		}
+	}
+
+	numbers := []int{}
+	add := func(part *slidePart, rels []relationship) error {
+		n := len(numbers) + 1
+		name := "ppt/slides/slide" + strconv.Itoa(n) + ".xml"
+		if err := executePart(z, name, "slide", part); err != nil {
+			return err
+		}
+		if err := executePart(z, "ppt/slides/_rels/slide"+strconv.Itoa(n)+".xml.rels", "slide-rels", rels); err != nil {
+			return err
+		}
+		numbers = append(numbers, n)
+		return nil
+	}
+
+	// Title slide.
+	rels := []relationship{}
+	first := &slidePart{
+		Texts: []text{{
+			ID: 2, Name: "Title", Anchor: "b", Size: 4000,
+			Paragraphs: []paragraph{{Align: "ctr", Runs: []run{{Text: title, Bold: true}}}},
+			box:        box{margin, slideHeight/2 - 2*titleHeight, slideWidth - 2*margin, 2 * titleHeight},
+		}, {
+			ID: 3, Name: "Subtitle", Anchor: "t", Size: 2000,
+			Paragraphs: []paragraph{{Align: "ctr", Runs: []run{{Text: fmt.Sprintf("%s, %s", photoCount(count), time.Now().Format("2 January 2006"))}}}},
+			box:        box{margin, slideHeight/2 + gap, slideWidth - 2*margin, titleHeight},
+		}},
+	}
+	first.Pictures = logoPicture(&rels, box{slideWidth/2 - columnWidth/2, margin, columnWidth, slideHeight/2 - 2*titleHeight - margin - gap})
+	if err := add(first, rels); err != nil {
+		return err
+	}
+
+	for i, s := range slides {
+		if photos[i] == "" {
+			continue
+		}
+		photo, err := ioutil.ReadFile(photos[i])
+		if err != nil {
+			return err
+		}
+		photoName := fmt.Sprintf("photo%d.jpeg", i+1)
+		if err := writePart(z, "ppt/media/"+photoName, photo); err != nil {
+			return err
+		}
+
+		slideTitle, err := t.slideTitle(s)
+		if err != nil {
+			return err
+		}
+
+		rels := []relationship{{ID: "rIdPhoto", Type: "image", Target: "../media/" + photoName}}
+		part := &slidePart{}
+		part.Texts = append(part.Texts, text{
+			ID: 2, Name: "Title", Anchor: "ctr", Size: 2800,
+			Paragraphs: []paragraph{{Align: "l", Runs: []run{{Text: slideTitle, Bold: true}}}},
+			box:        box{margin, margin, slideWidth - 3*margin - columnWidth/2, titleHeight},
+		})
+		bodyTop := int64(margin + titleHeight + gap)
+		bodyHeight := int64(slideHeight - margin - bodyTop)
+		rightX := int64(slideWidth - margin - columnWidth)
+		part.Pictures = append(part.Pictures, picture{
+			ID: 3, Name: "Photo", Rel: "rIdPhoto",
+			box: fitImage(photo, box{margin, bodyTop, rightX - gap - margin, bodyHeight}),
+		})
+
+		captionTop := bodyTop
+		if m := d.slideMap(s); m != nil {
+			mapName := fmt.Sprintf("map%d.png", i+1)
+			if err := writePart(z, "ppt/media/"+mapName, m); err != nil {
+				return err
+			}
+			rels = append(rels, relationship{ID: "rIdMap", Type: "image", Target: "../media/" + mapName})
+			part.Pictures = append(part.Pictures, picture{
+				ID: 4, Name: "Map", Rel: "rIdMap",
+				box: box{rightX, bodyTop, columnWidth, mapHeight},
+			})
+			captionTop += mapHeight + gap
+		}
+
+		caption := []paragraph{}
+		for _, line := range t.caption(s) {
+			caption = append(caption, paragraph{Align: "l", Runs: []run{{Text: line[0] + ": ", Bold: true}, {Text: line[1]}}})
+		}
+		if gps := s.Photo.Photo.GPS; gps != nil {
+			rels = append(rels, relationship{
+				ID:       "rIdLink",
+				Type:     "hyperlink",
+				Target:   fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.6f&mlon=%.6f#map=18/%.6f/%.6f", gps.Lat, gps.Lng, gps.Lat, gps.Lng),
+				External: true,
+			})
+			caption = append(caption, paragraph{Align: "l", Runs: []run{{Text: "Open map", Link: "rIdLink"}}})
+		}
+		part.Texts = append(part.Texts, text{
+			ID: 5, Name: "Caption", Anchor: "t", Size: 1400,
+			Paragraphs: caption,
+			box:        box{rightX, captionTop, columnWidth, bodyTop + bodyHeight - captionTop},
+		})
+		part.Pictures = append(part.Pictures, logoPicture(&rels, box{slideWidth - margin - columnWidth/2, margin, columnWidth / 2, titleHeight})...)
+
+		if err := add(part, rels); err != nil {
+			return err
+		}
+	}
+
+	if err := executePart(z, "[Content_Types].xml", "content-types", numbers); err != nil {
+		return err
+	}
+	if err := executePart(z, "ppt/presentation.xml", "presentation", numbers); err != nil {
+		return err
+	}
+	if err := executePart(z, "ppt/_rels/presentation.xml.rels", "presentation-rels", numbers); err != nil {
+		return err
+	}
+	core := struct{ Title, Created string }{title, time.Now().UTC().Format(time.RFC3339)}
+	if err := executePart(z, "docProps/core.xml", "core", core); err != nil {
+		return err
+	}
+	if err := executePart(z, "docProps/app.xml", "app", len(numbers)); err != nil {
+		return err
+	}
+	for name, content := range staticParts {
+		if err := writePart(z, name, []byte(content)); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// slideMap draws the photo location, and the expected location when known,
+// on the tiles as a PNG. It returns nil without tiles or GPS.
+func (d *Deck) slideMap(s *Slide) []byte {
+	if d.Tiles == nil || s.Photo.Photo.GPS == nil {
+		return nil
+	}
+	locations := []*models.Location{s.Photo.Photo.GPS}
+	if s.Expected != nil {
+		locations = append(locations, s.Expected)
+	}
+	view := staticmap.Fit(locations, mapWidthPx, mapHeightPx, d.Tiles.MaxZoom())
+	img := view.Render(d.Tiles)
+	if img == nil {
+		return nil
+	}
+	if s.Expected != nil {
+		x, y := view.Pixel(s.Expected)
+		staticmap.Dot(img, x, y, 7, color.RGBA{200, 40, 40, 255})
+	}
+	fill := color.RGBA{40, 90, 200, 255}
+	if s.Photo.Photo.Geofence == models.GeofenceOutside {
+		fill = color.RGBA{220, 120, 20, 255}
+	}
+	x, y := view.Pixel(s.Photo.Photo.GPS)
+	staticmap.Dot(img, x, y, 9, fill)
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// readLogo reads a PNG or JPEG logo, returning the extension of its part.
+func readLogo(path string) ([]byte, string, error) {
+	if path == "" {
+		return nil, "", nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("logo %s: %v", filepath.Base(path), err)
+	}
+	if format == "jpeg" {
+		return b, ".jpeg", nil
+	}
+	return b, ".png", nil
+}
+
+// fitImage returns the largest box of the image's aspect ratio centred in
+// at.
+func fitImage(b []byte, at box) box {
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return at
+	}
+	scale := math.Min(float64(at.W)/float64(config.Width), float64(at.H)/float64(config.Height))
+	w, h := int64(float64(config.Width)*scale), int64(float64(config.Height)*scale)
+	return box{at.X + (at.W-w)/2, at.Y + (at.H-h)/2, w, h}
+}
+
+func photoCount(n int) string {
+	if n == 1 {
+		return "1 photo"
+	}
+	return strconv.Itoa(n) + " photos"
+}
+
+func writePart(z *zip.Writer, name string, content []byte) error {
+	f, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
+
+func executePart(z *zip.Writer, name, tmpl string, data interface{}) error {
+	f, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	return parts.ExecuteTemplate(f, tmpl, data)
+}
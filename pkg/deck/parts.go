@@ -0,0 +1,144 @@
+package deck
+
+import (
+	"bytes"
+	"encoding/xml"
+	"text/template"
+)
+
+// The parts of a presentation with a single blank layout. Slides place
+// every shape themselves, so the master and layout hold nothing.
+
+const namespaces = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+
+const emptyTree = `<p:nvGrpSpPr><p:cNvPr id="1" name=""/><p:cNvGrpSpPr/><p:nvPr/></p:nvGrpSpPr><p:grpSpPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="0" cy="0"/><a:chOff x="0" y="0"/><a:chExt cx="0" cy="0"/></a:xfrm></p:grpSpPr>`
+
+const header = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+var staticParts = map[string]string{
+	"_rels/.rels": header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="ppt/presentation.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+		`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/extended-properties" Target="docProps/app.xml"/>` +
+		`</Relationships>`,
+
+	"ppt/presProps.xml": header + `<p:presentationPr ` + namespaces + `/>`,
+
+	"ppt/viewProps.xml": header + `<p:viewPr ` + namespaces + `><p:gridSpacing cx="76200" cy="76200"/></p:viewPr>`,
+
+	"ppt/tableStyles.xml": header + `<a:tblStyleLst xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" def="{5C22544A-7EE6-4342-B048-85BDC9FD1C3A}"/>`,
+
+	"ppt/slideMasters/slideMaster1.xml": header + `<p:sldMaster ` + namespaces + `>` +
+		`<p:cSld><p:bg><p:bgRef idx="1001"><a:schemeClr val="bg1"/></p:bgRef></p:bg><p:spTree>` + emptyTree + `</p:spTree></p:cSld>` +
+		`<p:clrMap bg1="lt1" tx1="dk1" bg2="lt2" tx2="dk2" accent1="accent1" accent2="accent2" accent3="accent3" accent4="accent4" accent5="accent5" accent6="accent6" hlink="hlink" folHlink="folHlink"/>` +
+		`<p:sldLayoutIdLst><p:sldLayoutId id="2147483649" r:id="rId1"/></p:sldLayoutIdLst>` +
+		`</p:sldMaster>`,
+
+	"ppt/slideMasters/_rels/slideMaster1.xml.rels": header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slideLayout" Target="../slideLayouts/slideLayout1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/theme" Target="../theme/theme1.xml"/>` +
+		`</Relationships>`,
+
+	"ppt/slideLayouts/slideLayout1.xml": header + `<p:sldLayout ` + namespaces + ` type="blank" preserve="1">` +
+		`<p:cSld name="Blank"><p:spTree>` + emptyTree + `</p:spTree></p:cSld>` +
+		`<p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr></p:sldLayout>`,
+
+	"ppt/slideLayouts/_rels/slideLayout1.xml.rels": header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slideMaster" Target="../slideMasters/slideMaster1.xml"/>` +
+		`</Relationships>`,
+
+	"ppt/theme/theme1.xml": header + `<a:theme xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" name="Board Checker"><a:themeElements>` +
+		`<a:clrScheme name="Board Checker">` +
+		`<a:dk1><a:sysClr val="windowText" lastClr="000000"/></a:dk1><a:lt1><a:sysClr val="window" lastClr="FFFFFF"/></a:lt1>` +
+		`<a:dk2><a:srgbClr val="44546A"/></a:dk2><a:lt2><a:srgbClr val="E7E6E6"/></a:lt2>` +
+		`<a:accent1><a:srgbClr val="285AC8"/></a:accent1><a:accent2><a:srgbClr val="DC7814"/></a:accent2>` +
+		`<a:accent3><a:srgbClr val="C82828"/></a:accent3><a:accent4><a:srgbClr val="5CB85C"/></a:accent4>` +
+		`<a:accent5><a:srgbClr val="5BC0DE"/></a:accent5><a:accent6><a:srgbClr val="777777"/></a:accent6>` +
+		`<a:hlink><a:srgbClr val="0563C1"/></a:hlink><a:folHlink><a:srgbClr val="954F72"/></a:folHlink>` +
+		`</a:clrScheme>` +
+		`<a:fontScheme name="Board Checker">` +
+		`<a:majorFont><a:latin typeface="Calibri"/><a:ea typeface=""/><a:cs typeface=""/><a:font script="Thai" typeface="Tahoma"/></a:majorFont>` +
+		`<a:minorFont><a:latin typeface="Calibri"/><a:ea typeface=""/><a:cs typeface=""/><a:font script="Thai" typeface="Tahoma"/></a:minorFont>` +
+		`</a:fontScheme>` +
+		`<a:fmtScheme name="Board Checker">` +
+		`<a:fillStyleLst>` + phFill + phFill + phFill + `</a:fillStyleLst>` +
+		`<a:lnStyleLst><a:ln w="6350">` + phFill + `</a:ln><a:ln w="12700">` + phFill + `</a:ln><a:ln w="19050">` + phFill + `</a:ln></a:lnStyleLst>` +
+		`<a:effectStyleLst><a:effectStyle><a:effectLst/></a:effectStyle><a:effectStyle><a:effectLst/></a:effectStyle><a:effectStyle><a:effectLst/></a:effectStyle></a:effectStyleLst>` +
+		`<a:bgFillStyleLst>` + phFill + phFill + phFill + `</a:bgFillStyleLst>` +
+		`</a:fmtScheme>` +
+		`</a:themeElements></a:theme>`,
+}
+
+const phFill = `<a:solidFill><a:schemeClr val="phClr"/></a:solidFill>`
+
+var parts = template.Must(template.New("").Funcs(template.FuncMap{
+	"xml": func(s string) string {
+		buf := new(bytes.Buffer)
+		xml.EscapeText(buf, []byte(s))
+		return buf.String()
+	},
+	"add": func(a, b int) int { return a + b },
+}).Parse(`
+{{define "content-types"}}` + header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="png" ContentType="image/png"/>
+<Default Extension="jpeg" ContentType="image/jpeg"/>
+<Override PartName="/ppt/presentation.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml"/>
+<Override PartName="/ppt/slideMasters/slideMaster1.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.slideMaster+xml"/>
+<Override PartName="/ppt/slideLayouts/slideLayout1.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.slideLayout+xml"/>
+<Override PartName="/ppt/theme/theme1.xml" ContentType="application/vnd.openxmlformats-officedocument.theme+xml"/>
+<Override PartName="/ppt/presProps.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.presProps+xml"/>
+<Override PartName="/ppt/viewProps.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.viewProps+xml"/>
+<Override PartName="/ppt/tableStyles.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.tableStyles+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+<Override PartName="/docProps/app.xml" ContentType="application/vnd.openxmlformats-officedocument.extended-properties+xml"/>
+{{range .}}<Override PartName="/ppt/slides/slide{{.}}.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.slide+xml"/>
+{{end}}</Types>{{end}}
+
+{{define "presentation"}}` + header + `<p:presentation ` + namespaces + ` saveSubsetFonts="1">
+<p:sldMasterIdLst><p:sldMasterId id="2147483648" r:id="rId1"/></p:sldMasterIdLst>
+<p:sldIdLst>{{range .}}<p:sldId id="{{add . 255}}" r:id="rId{{add . 5}}"/>{{end}}</p:sldIdLst>
+<p:sldSz cx="12192000" cy="6858000"/>
+<p:notesSz cx="6858000" cy="9144000"/>
+</p:presentation>{{end}}
+
+{{define "presentation-rels"}}` + header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slideMaster" Target="slideMasters/slideMaster1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/theme" Target="theme/theme1.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/presProps" Target="presProps.xml"/>
+<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/viewProps" Target="viewProps.xml"/>
+<Relationship Id="rId5" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/tableStyles" Target="tableStyles.xml"/>
+{{range .}}<Relationship Id="rId{{add . 5}}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide{{.}}.xml"/>
+{{end}}</Relationships>{{end}}
+
+{{define "core"}}` + header + `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>{{xml .Title}}</dc:title>
+<dc:creator>Board Checker</dc:creator>
+<dcterms:created xsi:type="dcterms:W3CDTF">{{.Created}}</dcterms:created>
+</cp:coreProperties>{{end}}
+
+{{define "app"}}` + header + `<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties">
+<Application>Board Checker</Application>
+<Slides>{{.}}</Slides>
+</Properties>{{end}}
+
+{{define "slide"}}` + header + `<p:sld ` + namespaces + `>
+<p:cSld><p:spTree>` + emptyTree + `
+{{range .Texts}}<p:sp><p:nvSpPr><p:cNvPr id="{{.ID}}" name="{{.Name}}"/><p:cNvSpPr txBox="1"/><p:nvPr/></p:nvSpPr>
+<p:spPr><a:xfrm><a:off x="{{.X}}" y="{{.Y}}"/><a:ext cx="{{.W}}" cy="{{.H}}"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom><a:noFill/></p:spPr>
+<p:txBody><a:bodyPr wrap="square" lIns="0" rIns="0" anchor="{{.Anchor}}"><a:normAutofit/></a:bodyPr><a:lstStyle/>
+{{- $size := .Size}}{{if not .Paragraphs}}<a:p/>{{end}}{{range .Paragraphs}}<a:p><a:pPr algn="{{.Align}}"/>{{range .Runs}}<a:r><a:rPr lang="en-US" sz="{{$size}}"{{if .Bold}} b="1"{{end}} dirty="0">{{if .Link}}<a:hlinkClick r:id="{{.Link}}"/>{{end}}</a:rPr><a:t>{{xml .Text}}</a:t></a:r>{{end}}</a:p>{{end}}
+</p:txBody></p:sp>
+{{end}}{{range .Pictures}}<p:pic><p:nvPicPr><p:cNvPr id="{{.ID}}" name="{{.Name}}"/><p:cNvPicPr><a:picLocks noChangeAspect="1"/></p:cNvPicPr><p:nvPr/></p:nvPicPr>
+<p:blipFill><a:blip r:embed="{{.Rel}}"/><a:stretch><a:fillRect/></a:stretch></p:blipFill>
+<p:spPr><a:xfrm><a:off x="{{.X}}" y="{{.Y}}"/><a:ext cx="{{.W}}" cy="{{.H}}"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr></p:pic>
+{{end}}</p:spTree></p:cSld>
+<p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr>
+</p:sld>{{end}}
+
+{{define "slide-rels"}}` + header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slideLayout" Target="../slideLayouts/slideLayout1.xml"/>
+{{range .}}<Relationship Id="{{.ID}}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/{{.Type}}" Target="{{xml .Target}}"{{if .External}} TargetMode="External"{{end}}/>
+{{end}}</Relationships>{{end}}
+`))
@@ -0,0 +1,144 @@
+package deck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// Template is how the slides of a deck look. Title is a text/template run
+// with the Slide, Logo a PNG or JPEG file shown top right of every slide
+// and Caption the fields listed beside the photo, in order.
+type Template struct {
+	Name    string   `json:"name"`
+	Title   string   `json:"title"`
+	Logo    string   `json:"logo"`
+	Caption []string `json:"caption"`
+
+	title *template.Template
+}
+
+// DefaultTemplate is used when no templates are configured.
+var DefaultTemplate = &Template{
+	Name:    "default",
+	Title:   "{{.Worksheet.Number}} {{.Worksheet.Name}}",
+	Caption: []string{"campaign", "board", "zone", "photo", "taken", "gps", "caption"},
+}
+
+// Caption fields and how they read from a slide.
+var fields = map[string]struct {
+	label string
+	value func(s *Slide) string
+}{
+	"number":   {"Worksheet", func(s *Slide) string { return s.Worksheet.Number }},
+	"name":     {"Name", func(s *Slide) string { return s.Worksheet.Name }},
+	"campaign": {"Campaign", func(s *Slide) string { return s.Worksheet.Campaign }},
+	"board": {"Board", func(s *Slide) string {
+		if s.Worksheet.BoardID == 0 {
+			return ""
+		}
+		return s.Worksheet.BoardCode + " " + s.Worksheet.BoardName
+	}},
+	"zone":  {"Zone", func(s *Slide) string { return s.Worksheet.ZoneName }},
+	"team":  {"Team", func(s *Slide) string { return s.Worksheet.TeamName }},
+	"photo": {"Photo", func(s *Slide) string { return fmt.Sprintf("No. %d", s.Photo.Photo.RunningNumber) }},
+	"taken": {"Taken", func(s *Slide) string { return s.Photo.Taken.In(models.LocalZone).Format("2006-01-02 15:04") }},
+	"gps": {"GPS", func(s *Slide) string {
+		if s.Photo.Photo.GPS == nil {
+			return "No GPS"
+		}
+		return fmt.Sprintf("%.6f, %.6f", s.Photo.Photo.GPS.Lat, s.Photo.Photo.GPS.Lng)
+	}},
+	"geofence": {"Geofence", func(s *Slide) string {
+		p := s.Photo.Photo
+		if p.Geofence == "" || p.Geofence == models.GeofenceMissing {
+			return ""
+		}
+		if d := p.DistanceText(); d != "" {
+			return p.Geofence + " " + d
+		}
+		return p.Geofence
+	}},
+	"caption": {"Caption", func(s *Slide) string { return s.Photo.Photo.Caption }},
+}
+
+// LoadTemplates reads a JSON array of templates, checking their titles
+// parse and their caption fields exist.
+func LoadTemplates(path string) ([]*Template, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	templates := []*Template{}
+	if err := json.Unmarshal(b, &templates); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("%s: no templates", path)
+	}
+	for _, t := range templates {
+		if err := t.check(); err != nil {
+			return nil, fmt.Errorf("%s: template %q: %v", path, t.Name, err)
+		}
+	}
+	return templates, nil
+}
+
+func (t *Template) check() error {
+	if t.Name == "" {
+		return fmt.Errorf("no name")
+	}
+	if _, err := t.parse(); err != nil {
+		return err
+	}
+	for _, field := range t.Caption {
+		if _, ok := fields[field]; !ok {
+			return fmt.Errorf("unknown caption field %q", field)
+		}
+	}
+	return nil
+}
+
+func (t *Template) parse() (*template.Template, error) {
+	if t.title == nil {
+		title, err := template.New(t.Name).Option("missingkey=zero").Parse(t.Title)
+		if err != nil {
+			return nil, err
+		}
+		t.title = title
+	}
+	return t.title, nil
+}
+
+// slideTitle returns the title of a slide.
+func (t *Template) slideTitle(s *Slide) (string, error) {
+	title, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := title.Execute(buf, s); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// caption returns the label and value of each caption field of a slide
+// that has a value.
+func (t *Template) caption(s *Slide) [][2]string {
+	lines := [][2]string{}
+	for _, name := range t.Caption {
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if value := field.value(s); value != "" {
+			lines = append(lines, [2]string{field.label, value})
+		}
+	}
+	return lines
+}
@@ -1,6 +1,18 @@
 package forms
 
-import "strings"
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var rxUUID = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+// ValidUUID reports whether s is a UUID in its canonical text form.
+func ValidUUID(s string) bool {
+	return rxUUID.MatchString(s)
+}
 
 type LoginUser struct {
 	Username string
@@ -23,14 +35,125 @@ type Query struct {
 	Q            string
 	Date         string
 	TicketTypeID int
+	Status       string
+	Incomplete   bool
 	Start        int
 	MaxResults   int
+	// Key and KeyID are the sort key and ID of the row a page goes on
+	// after, or ends before when Before is set, instead of Start.
+	Key    string
+	KeyID  int
+	Before bool
 }
 
 func NewQuery() *Query {
 	return &Query{MaxResults: 100}
 }
 
+// PhotoFilter selects the photos of a worksheet, of the worksheets of a
+// date, a zone or a team, or of any combination of them.
+type PhotoFilter struct {
+	WorksheetID int    `form:"worksheet_id"`
+	Date        string `form:"date"`
+	ZoneID      int    `form:"zone_id"`
+	TeamID      int    `form:"team_id"`
+}
+
+// ReviewFilter selects the photos of the review queue by their review, the
+// day they were uploaded and the zone and team of their worksheet.
+type ReviewFilter struct {
+	Review string `form:"review"`
+	Date   string `form:"date"`
+	ZoneID int    `form:"zone_id"`
+	TeamID int    `form:"team_id"`
+}
+
+// Limits of a nearby search.
+const (
+	DefaultNearbyRadius = 1000
+	MaxNearbyRadius     = 50000
+	MaxNearbySpan       = 1.0
+)
+
+// Nearby selects the circle of Radius metres around Lat, Lng, or the
+// bounding box BBox given as minLng,minLat,maxLng,maxLat. A bounding box
+// sorts by distance from Lat, Lng when they are given, else from its
+// middle.
+type Nearby struct {
+	Lat      string            `form:"lat"`
+	Lng      string            `form:"lng"`
+	Radius   float64           `form:"radius"`
+	BBox     string            `form:"bbox"`
+	Failures map[string]string `form:"-"`
+}
+
+// Point parses the centre of the search. ok is false when it is not given.
+func (f *Nearby) Point() (lat, lng float64, ok bool) {
+	if strings.TrimSpace(f.Lat) == "" && strings.TrimSpace(f.Lng) == "" {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(f.Lat), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+	lng, err = strconv.ParseFloat(strings.TrimSpace(f.Lng), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// Bounds parses the bounding box. ok is false when it is not given or not
+// valid.
+func (f *Nearby) Bounds() (minLat, minLng, maxLat, maxLng float64, ok bool) {
+	parts := strings.Split(f.BBox, ",")
+	if len(parts) != 4 {
+		return 0, 0, 0, 0, false
+	}
+	v := make([]float64, 4)
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0, 0, 0, 0, false
+		}
+		v[i] = n
+	}
+	minLng, minLat, maxLng, maxLat = v[0], v[1], v[2], v[3]
+	if minLat < -90 || maxLat > 90 || minLng < -180 || maxLng > 180 || minLat > maxLat || minLng > maxLng {
+		return 0, 0, 0, 0, false
+	}
+	return minLat, minLng, maxLat, maxLng, true
+}
+
+func (f *Nearby) Valid() bool {
+	f.Failures = make(map[string]string)
+	_, _, hasPoint := f.Point()
+	if (strings.TrimSpace(f.Lat) != "" || strings.TrimSpace(f.Lng) != "") && !hasPoint {
+		f.Failures["Location"] = "Latitude must be a number within ±90 and longitude within ±180"
+	}
+
+	if strings.TrimSpace(f.BBox) != "" {
+		minLat, minLng, maxLat, maxLng, ok := f.Bounds()
+		if !ok {
+			f.Failures["BBox"] = "Bounding box must be minLng,minLat,maxLng,maxLat"
+		} else if maxLat-minLat > MaxNearbySpan || maxLng-minLng > MaxNearbySpan {
+			f.Failures["BBox"] = "Bounding box must span at most " + strconv.FormatFloat(MaxNearbySpan, 'f', -1, 64) + " degrees"
+		}
+		return len(f.Failures) == 0
+	}
+
+	if !hasPoint && len(f.Failures) == 0 {
+		f.Failures["Location"] = "Latitude and longitude or a bounding box are required"
+	}
+	if f.Radius == 0 {
+		f.Radius = DefaultNearbyRadius
+	}
+	if f.Radius < 0 || f.Radius > MaxNearbyRadius {
+		f.Failures["Radius"] = "Radius must be between 0 and " + strconv.Itoa(MaxNearbyRadius) + " metres"
+	}
+	return len(f.Failures) == 0
+}
+
 type Team struct {
 	Name string `form:"team_name"`
 }
@@ -39,11 +162,181 @@ type Zone struct {
 	Name string `form:"zone_name"`
 }
 
+// ZoneImport holds the options of a zone boundary import.
+type ZoneImport struct {
+	Create bool `form:"zone_import_create"`
+	DryRun bool `form:"zone_import_dry_run"`
+}
+
+// WorksheetImport holds the options of a worksheet CSV import.
+type WorksheetImport struct {
+	Create bool `form:"worksheet_import_create"`
+	DryRun bool `form:"worksheet_import_dry_run"`
+}
+
 type Worksheet struct {
-	Number string `form:"worksheet_number"`
-	Name   string `form:"worksheet_name"`
-	ZoneID int    `form:"worksheet_zone_id"`
-	TeamID int    `form:"worksheet_team_id"`
+	Number   string `form:"worksheet_number"`
+	Name     string `form:"worksheet_name"`
+	Campaign string `form:"worksheet_campaign"`
+	ZoneID   int    `form:"worksheet_zone_id"`
+	TeamID   int    `form:"worksheet_team_id"`
+	BoardID  int    `form:"worksheet_board_id"`
+	Lat      string `form:"worksheet_lat"`
+	Lng      string `form:"worksheet_lng"`
+
+	Failures map[string]string `form:"-"`
+}
+
+// Coordinates parses the optional expected location of the worksheet. ok is
+// false when both fields are empty.
+func (f *Worksheet) Coordinates() (lat, lng float64, ok bool, err error) {
+	return parseCoordinates(f.Lat, f.Lng)
+}
+
+// parseCoordinates parses an optional latitude and longitude. ok is false
+// when both are empty.
+func parseCoordinates(latText, lngText string) (lat, lng float64, ok bool, err error) {
+	if strings.TrimSpace(latText) == "" && strings.TrimSpace(lngText) == "" {
+		return 0, 0, false, nil
+	}
+	lat, err = strconv.ParseFloat(strings.TrimSpace(latText), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false, errors.New("latitude must be a number within ±90")
+	}
+	lng, err = strconv.ParseFloat(strings.TrimSpace(lngText), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, false, errors.New("longitude must be a number within ±180")
+	}
+	return lat, lng, true, nil
+}
+
+// Route selects the worksheets of a day to plan a team's route through and
+// the optional location it starts from.
+type Route struct {
+	Date     string            `form:"date"`
+	Lat      string            `form:"lat"`
+	Lng      string            `form:"lng"`
+	Failures map[string]string `form:"-"`
+}
+
+var rxDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+func (f *Route) Valid() bool {
+	f.Failures = make(map[string]string)
+	if !rxDate.MatchString(f.Date) {
+		f.Failures["Date"] = "Date must be YYYY-MM-DD"
+	}
+	if _, _, _, err := f.Start(); err != nil {
+		f.Failures["Start"] = "Start " + err.Error()
+	}
+	return len(f.Failures) == 0
+}
+
+// Start parses the start location. ok is false when it is not given.
+func (f *Route) Start() (lat, lng float64, ok bool, err error) {
+	return parseCoordinates(f.Lat, f.Lng)
+}
+
+type Board struct {
+	Code     string            `form:"board_code"`
+	Name     string            `form:"board_name"`
+	Lat      float64           `form:"board_lat"`
+	Lng      float64           `form:"board_lng"`
+	Size     string            `form:"board_size"`
+	Facing   string            `form:"board_facing"`
+	Type     string            `form:"board_type"`
+	Owner    string            `form:"board_owner"`
+	ZoneID   int               `form:"board_zone_id"`
+	Failures map[string]string `form:"-"`
+}
+
+// Valid checks the board against the given board types.
+func (f *Board) Valid(types []string) bool {
+	f.Failures = make(map[string]string)
+	f.Code = strings.TrimSpace(f.Code)
+	if f.Code == "" {
+		f.Failures["Code"] = "Code is required"
+	}
+	if strings.TrimSpace(f.Name) == "" {
+		f.Failures["Name"] = "Name is required"
+	}
+	if f.Lat < -90 || f.Lat > 90 || f.Lng < -180 || f.Lng > 180 {
+		f.Failures["Location"] = "Latitude must be within ±90 and longitude within ±180"
+	}
+	validType := false
+	for _, t := range types {
+		if f.Type == t {
+			validType = true
+		}
+	}
+	if !validType {
+		f.Failures["Type"] = "Type must be one of " + strings.Join(types, ", ")
+	}
+	return len(f.Failures) == 0
+}
+
+// Checklist is a checklist template with rows of photo slots. ZoneID 0 and
+// an empty BoardType apply it to any zone and board type.
+type Checklist struct {
+	Name      string            `form:"checklist_name"`
+	ZoneID    int               `form:"checklist_zone_id"`
+	BoardType string            `form:"checklist_board_type"`
+	Slots     []ChecklistSlot   `form:"checklist_slots"`
+	Failures  map[string]string `form:"-"`
+}
+
+type ChecklistSlot struct {
+	Code string `form:"code"`
+	Name string `form:"name"`
+	Lit  bool   `form:"lit"`
+}
+
+var rxSlotCode = regexp.MustCompile(`^[a-z0-9_]{1,30}$`)
+
+// Valid checks the checklist against the given board types and leaves out
+// the empty rows of slots.
+func (f *Checklist) Valid(types []string) bool {
+	f.Failures = make(map[string]string)
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		f.Failures["Name"] = "Name is required"
+	}
+	if f.BoardType != "" {
+		validType := false
+		for _, t := range types {
+			if f.BoardType == t {
+				validType = true
+			}
+		}
+		if !validType {
+			f.Failures["BoardType"] = "Board type must be one of " + strings.Join(types, ", ")
+		}
+	}
+
+	slots := []ChecklistSlot{}
+	codes := map[string]bool{}
+	for _, s := range f.Slots {
+		s.Code = strings.TrimSpace(s.Code)
+		s.Name = strings.TrimSpace(s.Name)
+		if s.Code == "" && s.Name == "" {
+			continue
+		}
+		if !rxSlotCode.MatchString(s.Code) {
+			f.Failures["Code"] = "Slot codes are up to 30 lower case letters, digits and _"
+		} else if codes[s.Code] {
+			f.Failures["DuplicateCode"] = "Slot code " + s.Code + " is used twice"
+		}
+		if s.Name == "" {
+			f.Failures["SlotName"] = "Every slot needs a name"
+		}
+		codes[s.Code] = true
+		slots = append(slots, s)
+	}
+	f.Slots = slots
+	if len(slots) == 0 {
+		f.Failures["Slots"] = "A checklist needs at least one slot"
+	}
+	return len(f.Failures) == 0
 }
 
 type File struct {
@@ -0,0 +1,199 @@
+package geo
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"time"
+)
+
+// Property is a named value of an exported waypoint.
+type Property struct {
+	Name  string
+	Value interface{}
+}
+
+// Waypoint is a located photo to export.
+type Waypoint struct {
+	Name       string
+	Lat, Lng   float64
+	Time       time.Time
+	Link       string
+	Thumbnail  string
+	Properties []Property
+}
+
+// WriteGeoJSON writes the waypoints as a FeatureCollection of points.
+func WriteGeoJSON(w io.Writer, waypoints []Waypoint) error {
+	type feature struct {
+		Type       string                 `json:"type"`
+		Geometry   map[string]interface{} `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+
+	features := []feature{}
+	for _, p := range waypoints {
+		properties := map[string]interface{}{
+			"name": p.Name,
+			"time": p.Time.Format(time.RFC3339),
+		}
+		if p.Link != "" {
+			properties["url"] = p.Link
+		}
+		if p.Thumbnail != "" {
+			properties["thumbnail"] = p.Thumbnail
+		}
+		for _, property := range p.Properties {
+			properties[property.Name] = property.Value
+		}
+		features = append(features, feature{
+			Type: "Feature",
+			Geometry: map[string]interface{}{
+				"type":        "Point",
+				"coordinates": Point{p.Lng, p.Lat},
+			},
+			Properties: properties,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlWaypoint struct {
+	Name         string    `xml:"name"`
+	TimeStamp    string    `xml:"TimeStamp>when"`
+	Description  string    `xml:"description"`
+	ExtendedData []kmlData `xml:"ExtendedData>Data"`
+	Coordinates  string    `xml:"Point>coordinates"`
+}
+
+// WriteKML writes the waypoints as KML placemarks whose balloons show the
+// thumbnail, linked to the photo, and the properties.
+func WriteKML(w io.Writer, name string, waypoints []Waypoint) error {
+	placemarks := []kmlWaypoint{}
+	for _, p := range waypoints {
+		description := ""
+		if p.Thumbnail != "" {
+			description += fmt.Sprintf(`<a href="%s"><img src="%s"/></a><br/>`, html.EscapeString(p.Link), html.EscapeString(p.Thumbnail))
+		}
+		data := []kmlData{}
+		for _, property := range p.Properties {
+			value := fmt.Sprint(property.Value)
+			description += html.EscapeString(property.Name) + ": " + html.EscapeString(value) + "<br/>"
+			data = append(data, kmlData{property.Name, value})
+		}
+		placemarks = append(placemarks, kmlWaypoint{
+			Name:         p.Name,
+			TimeStamp:    p.Time.Format(time.RFC3339),
+			Description:  description,
+			ExtendedData: data,
+			Coordinates:  fmt.Sprintf("%f,%f", p.Lng, p.Lat),
+		})
+	}
+
+	doc := struct {
+		XMLName    xml.Name      `xml:"kml"`
+		Namespace  string        `xml:"xmlns,attr"`
+		Name       string        `xml:"Document>name"`
+		Placemarks []kmlWaypoint `xml:"Document>Placemark"`
+	}{Namespace: "http://www.opengis.net/kml/2.2", Name: name, Placemarks: placemarks}
+	return writeXML(w, doc)
+}
+
+type gpxWaypoint struct {
+	Lat         float64 `xml:"lat,attr"`
+	Lng         float64 `xml:"lon,attr"`
+	Time        string  `xml:"time,omitempty"`
+	Name        string  `xml:"name"`
+	Description string  `xml:"desc,omitempty"`
+	Link        *gpxLink
+}
+
+type gpxLink struct {
+	XMLName xml.Name `xml:"link"`
+	Href    string   `xml:"href,attr"`
+}
+
+// WriteGPX writes the waypoints as GPX 1.1 waypoints.
+func WriteGPX(w io.Writer, name string, waypoints []Waypoint) error {
+	doc := gpxDocument(name)
+	doc.Waypoints = gpxPoints(waypoints)
+	return writeXML(w, doc)
+}
+
+// WriteGPXRoute writes the waypoints as a GPX 1.1 route visiting them in
+// order.
+func WriteGPXRoute(w io.Writer, name string, waypoints []Waypoint) error {
+	doc := gpxDocument(name)
+	doc.Route = &gpxRoute{Name: name, Points: gpxPoints(waypoints)}
+	return writeXML(w, doc)
+}
+
+type gpx struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Namespace string        `xml:"xmlns,attr"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Name      string        `xml:"metadata>name"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Route     *gpxRoute     `xml:"rte"`
+}
+
+type gpxRoute struct {
+	Name   string        `xml:"name"`
+	Points []gpxWaypoint `xml:"rtept"`
+}
+
+func gpxDocument(name string) *gpx {
+	return &gpx{Namespace: "http://www.topografix.com/GPX/1/1", Version: "1.1", Creator: "Board Checker", Name: name}
+}
+
+func gpxPoints(waypoints []Waypoint) []gpxWaypoint {
+	wpts := []gpxWaypoint{}
+	for _, p := range waypoints {
+		description := ""
+		for i, property := range p.Properties {
+			if i > 0 {
+				description += ", "
+			}
+			description += fmt.Sprintf("%s: %v", property.Name, property.Value)
+		}
+		wpt := gpxWaypoint{
+			Lat:         p.Lat,
+			Lng:         p.Lng,
+			Name:        p.Name,
+			Description: description,
+		}
+		if !p.Time.IsZero() {
+			wpt.Time = p.Time.UTC().Format(time.RFC3339)
+		}
+		if p.Link != "" {
+			wpt.Link = &gpxLink{Href: p.Link}
+		}
+		wpts = append(wpts, wpt)
+	}
+	return wpts
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
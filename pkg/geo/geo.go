@@ -0,0 +1,321 @@
+// Package geo reads zone boundaries from GeoJSON and KML, tests whether a
+// point lies inside them, and writes located photos as GeoJSON, KML and GPX.
+package geo
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoPolygons = errors.New("geo: no polygons found")
+	ErrInvalid    = errors.New("geo: invalid geometry")
+)
+
+// Point is a position in GeoJSON order, longitude first.
+type Point [2]float64
+
+func (p Point) Lng() float64 { return p[0] }
+func (p Point) Lat() float64 { return p[1] }
+
+// Polygon is an outer ring followed by any holes. Rings are closed or not;
+// both are handled.
+type Polygon [][]Point
+
+// MultiPolygon is a boundary made of one or more polygons.
+type MultiPolygon []Polygon
+
+// Contains reports whether the point is inside the boundary and not in a
+// hole of it.
+func (mp MultiPolygon) Contains(lat, lng float64) bool {
+	p := Point{lng, lat}
+	for _, polygon := range mp {
+		if len(polygon) == 0 || !inRing(polygon[0], p) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if inRing(hole, p) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// inRing casts a ray from p along the longitude axis and counts crossings.
+func inRing(ring []Point, p Point) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat() > p.Lat()) != (b.Lat() > p.Lat()) &&
+			p.Lng() < (b.Lng()-a.Lng())*(p.Lat()-a.Lat())/(b.Lat()-a.Lat())+a.Lng() {
+			in = !in
+		}
+	}
+	return in
+}
+
+// Bounds returns the bounding box of the boundary.
+func (mp MultiPolygon) Bounds() (minLat, minLng, maxLat, maxLng float64) {
+	minLat, minLng = math.Inf(1), math.Inf(1)
+	maxLat, maxLng = math.Inf(-1), math.Inf(-1)
+	for _, polygon := range mp {
+		for _, ring := range polygon {
+			for _, p := range ring {
+				minLat = math.Min(minLat, p.Lat())
+				maxLat = math.Max(maxLat, p.Lat())
+				minLng = math.Min(minLng, p.Lng())
+				maxLng = math.Max(maxLng, p.Lng())
+			}
+		}
+	}
+	return
+}
+
+// Area returns the planar area of the boundary in square degrees, enough to
+// prefer the smaller of two overlapping zones.
+func (mp MultiPolygon) Area() float64 {
+	area := 0.0
+	for _, polygon := range mp {
+		for i, ring := range polygon {
+			a := 0.0
+			for j, k := 0, len(ring)-1; j < len(ring); k, j = j, j+1 {
+				a += ring[k].Lng()*ring[j].Lat() - ring[j].Lng()*ring[k].Lat()
+			}
+			a = math.Abs(a) / 2
+			if i == 0 {
+				area += a
+			} else {
+				area -= a
+			}
+		}
+	}
+	return area
+}
+
+// MarshalJSON writes the boundary as a GeoJSON MultiPolygon geometry.
+func (mp MultiPolygon) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type        string    `json:"type"`
+		Coordinates []Polygon `json:"coordinates"`
+	}{"MultiPolygon", []Polygon(mp)})
+}
+
+// Feature is a named boundary.
+type Feature struct {
+	Name     string
+	Boundary MultiPolygon
+}
+
+type geoJSON struct {
+	Type        string                 `json:"type"`
+	Features    []geoJSON              `json:"features"`
+	Geometry    *geoJSON               `json:"geometry"`
+	Geometries  []geoJSON              `json:"geometries"`
+	Properties  map[string]interface{} `json:"properties"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+}
+
+// ParseGeoJSON reads the polygons of a FeatureCollection, Feature or bare
+// geometry. Features are named after their "name" property.
+func ParseGeoJSON(b []byte) ([]Feature, error) {
+	var g geoJSON
+	if err := json.Unmarshal(b, &g); err != nil {
+		return nil, err
+	}
+
+	features := []Feature{}
+	var walk func(g *geoJSON, name string) error
+	walk = func(g *geoJSON, name string) error {
+		switch g.Type {
+		case "FeatureCollection":
+			for i := range g.Features {
+				if err := walk(&g.Features[i], ""); err != nil {
+					return err
+				}
+			}
+		case "Feature":
+			if g.Geometry == nil {
+				return nil
+			}
+			return walk(g.Geometry, propertyName(g.Properties))
+		case "GeometryCollection":
+			mp := MultiPolygon{}
+			for i := range g.Geometries {
+				sub, err := geometry(&g.Geometries[i])
+				if err != nil {
+					return err
+				}
+				mp = append(mp, sub...)
+			}
+			if len(mp) > 0 {
+				features = append(features, Feature{name, mp})
+			}
+		default:
+			mp, err := geometry(g)
+			if err != nil {
+				return err
+			}
+			if len(mp) > 0 {
+				features = append(features, Feature{name, mp})
+			}
+		}
+		return nil
+	}
+	if err := walk(&g, ""); err != nil {
+		return nil, err
+	}
+	if len(features) == 0 {
+		return nil, ErrNoPolygons
+	}
+	return features, nil
+}
+
+func geometry(g *geoJSON) (MultiPolygon, error) {
+	switch g.Type {
+	case "Polygon":
+		var polygon Polygon
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return nil, ErrInvalid
+		}
+		return MultiPolygon{polygon}, validate(MultiPolygon{polygon})
+	case "MultiPolygon":
+		var mp MultiPolygon
+		if err := json.Unmarshal(g.Coordinates, &mp); err != nil {
+			return nil, ErrInvalid
+		}
+		return mp, validate(mp)
+	}
+	// Points and lines don't bound anything.
+	return nil, nil
+}
+
+func propertyName(properties map[string]interface{}) string {
+	for _, key := range []string{"name", "Name", "NAME"} {
+		if s, ok := properties[key].(string); ok {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+type kmlPlacemark struct {
+	Name     string       `xml:"name"`
+	Polygons []kmlPolygon `xml:"Polygon"`
+	Multi    []kmlPolygon `xml:"MultiGeometry>Polygon"`
+}
+
+type kmlPolygon struct {
+	Outer string   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inner []string `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+// ParseKML reads the polygons of every Placemark in a KML document.
+func ParseKML(r io.Reader) ([]Feature, error) {
+	features := []Feature{}
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+		var placemark kmlPlacemark
+		if err := decoder.DecodeElement(&placemark, &start); err != nil {
+			return nil, err
+		}
+
+		mp := MultiPolygon{}
+		for _, p := range append(placemark.Polygons, placemark.Multi...) {
+			outer, err := kmlRing(p.Outer)
+			if err != nil {
+				return nil, err
+			}
+			polygon := Polygon{outer}
+			for _, s := range p.Inner {
+				inner, err := kmlRing(s)
+				if err != nil {
+					return nil, err
+				}
+				polygon = append(polygon, inner)
+			}
+			mp = append(mp, polygon)
+		}
+		if len(mp) == 0 {
+			continue
+		}
+		if err := validate(mp); err != nil {
+			return nil, err
+		}
+		features = append(features, Feature{strings.TrimSpace(placemark.Name), mp})
+	}
+	if len(features) == 0 {
+		return nil, ErrNoPolygons
+	}
+	return features, nil
+}
+
+// kmlRing parses "lng,lat[,alt]" tuples separated by white space.
+func kmlRing(s string) ([]Point, error) {
+	ring := []Point{}
+	for _, tuple := range strings.Fields(s) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, ErrInvalid
+		}
+		lng, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		lat, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		ring = append(ring, Point{lng, lat})
+	}
+	return ring, nil
+}
+
+func validate(mp MultiPolygon) error {
+	for _, polygon := range mp {
+		if len(polygon) == 0 {
+			return ErrInvalid
+		}
+		for _, ring := range polygon {
+			if len(ring) < 3 {
+				return ErrInvalid
+			}
+			for _, p := range ring {
+				if p.Lat() < -90 || p.Lat() > 90 || p.Lng() < -180 || p.Lng() > 180 {
+					return ErrInvalid
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Parse reads GeoJSON or KML, telling them apart by the first character.
+func Parse(b []byte) ([]Feature, error) {
+	s := strings.TrimSpace(string(b))
+	if strings.HasPrefix(s, "<") {
+		return ParseKML(strings.NewReader(s))
+	}
+	return ParseGeoJSON(b)
+}
@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeohashPrecision is the length of stored geohashes, about 4 cm.
+const GeohashPrecision = 12
+
+// maxCover is the most cells Cover returns before settling for a shorter
+// geohash.
+const maxCover = 16
+
+// Geohash encodes a position as a geohash of precision characters. Points
+// sharing a prefix lie in the same cell, so a prefix search on an indexed
+// geohash column finds the points in a cell.
+func Geohash(lat, lng float64, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLng, maxLng := -180.0, 180.0
+	var b strings.Builder
+	bit, ch, even := 0, 0, true
+	for b.Len() < precision {
+		if even {
+			mid := (minLng + maxLng) / 2
+			if lng >= mid {
+				ch |= 1 << uint(4-bit)
+				minLng = mid
+			} else {
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch |= 1 << uint(4-bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+		} else {
+			b.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return b.String()
+}
+
+// cellSize returns the height and width in degrees of geohash cells of
+// precision characters.
+func cellSize(precision int) (lat, lng float64) {
+	bits := 5 * precision
+	lngBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lngBits))
+}
+
+// Cover returns the geohash prefixes of the cells covering a bounding box,
+// as long as possible while needing few cells. It returns nil when the box
+// is too large for a prefix search to narrow anything down.
+func Cover(minLat, minLng, maxLat, maxLng float64) []string {
+	minLat, maxLat = math.Max(minLat, -90), math.Min(maxLat, 90)
+	minLng, maxLng = math.Max(minLng, -180), math.Min(maxLng, 180)
+	if minLat > maxLat || minLng > maxLng {
+		return nil
+	}
+
+	for precision := GeohashPrecision; precision > 0; precision-- {
+		h, w := cellSize(precision)
+		lat0, lat1 := math.Floor((minLat+90)/h), math.Floor((maxLat+90)/h)
+		lng0, lng1 := math.Floor((minLng+180)/w), math.Floor((maxLng+180)/w)
+		if (lat1-lat0+1)*(lng1-lng0+1) > maxCover {
+			continue
+		}
+
+		cells := []string{}
+		seen := map[string]bool{}
+		for i := lat0; i <= lat1; i++ {
+			for j := lng0; j <= lng1; j++ {
+				lat := math.Min(-90+(i+0.5)*h, 90)
+				lng := math.Min(-180+(j+0.5)*w, 180)
+				cell := Geohash(lat, lng, precision)
+				if !seen[cell] {
+					seen[cell] = true
+					cells = append(cells, cell)
+				}
+			}
+		}
+		return cells
+	}
+	return nil
+}
+
+// BoundsAround returns the bounding box of the circle of radius metres
+// around a point.
+func BoundsAround(lat, lng, radius float64) (minLat, minLng, maxLat, maxLng float64) {
+	const metresPerDegree = 111195.0
+	dLat := radius / metresPerDegree
+	dLng := 360.0
+	if c := math.Cos(lat * math.Pi / 180); c > 1e-6 {
+		dLng = math.Min(dLat/c, 360)
+	}
+	return lat - dLat, lng - dLng, lat + dLat, lng + dLng
+}
@@ -0,0 +1,129 @@
+package geo
+
+import "math"
+
+const earthRadius = 6371008.8
+
+// Distance returns the great-circle distance between two points in metres.
+func Distance(a, b Point) float64 {
+	rad := math.Pi / 180
+	dLat := (b.Lat() - a.Lat()) * rad
+	dLng := (b.Lng() - a.Lng()) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Lat()*rad)*math.Cos(b.Lat()*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// PlanRoute orders stops into a short path that visits each once, starting
+// from start, or from whichever stop gives the shortest path when start is
+// nil. The path is built by going to the nearest unvisited stop each time,
+// then improved by reversing sections of it while that shortens it (2-opt).
+// It returns the visiting order as indexes into stops and the length of
+// the path in metres.
+func PlanRoute(start *Point, stops []Point) ([]int, float64) {
+	if len(stops) == 0 {
+		return []int{}, 0
+	}
+
+	if start != nil {
+		order := improve(start, stops, nearestNeighbour(*start, stops, -1))
+		return order, pathLength(start, stops, order)
+	}
+
+	var best []int
+	bestLength := math.Inf(1)
+	for i := range stops {
+		order := improve(nil, stops, nearestNeighbour(stops[i], stops, i))
+		if length := pathLength(nil, stops, order); length < bestLength {
+			best, bestLength = order, length
+		}
+	}
+	return best, bestLength
+}
+
+// nearestNeighbour orders the stops by repeatedly going to the nearest one
+// not yet visited from p. When first is not -1 the path begins at that
+// stop, which is p.
+func nearestNeighbour(p Point, stops []Point, first int) []int {
+	visited := make([]bool, len(stops))
+	order := make([]int, 0, len(stops))
+	if first != -1 {
+		visited[first] = true
+		order = append(order, first)
+	}
+	for len(order) < len(stops) {
+		next, nextDistance := -1, math.Inf(1)
+		for i, stop := range stops {
+			if visited[i] {
+				continue
+			}
+			if d := Distance(p, stop); d < nextDistance {
+				next, nextDistance = i, d
+			}
+		}
+		visited[next] = true
+		order = append(order, next)
+		p = stops[next]
+	}
+	return order
+}
+
+// improve applies 2-opt to an open path: the section between two stops is
+// reversed whenever that makes the path shorter, until no reversal does.
+// A path with a start keeps it first.
+func improve(start *Point, stops []Point, order []int) []int {
+	// at returns the point in position i of the path, counting the start
+	// as position -1.
+	at := func(i int) (Point, bool) {
+		if i == -1 && start != nil {
+			return *start, true
+		}
+		if i < 0 || i >= len(order) {
+			return Point{}, false
+		}
+		return stops[order[i]], true
+	}
+	edge := func(i, j int) float64 {
+		a, ok := at(i)
+		if !ok {
+			return 0
+		}
+		b, ok := at(j)
+		if !ok {
+			return 0
+		}
+		return Distance(a, b)
+	}
+
+	for pass := 0; pass < 100; pass++ {
+		improved := false
+		for i := 0; i < len(order)-1; i++ {
+			for j := i + 1; j < len(order); j++ {
+				before := edge(i-1, i) + edge(j, j+1)
+				after := edge(i-1, j) + edge(i, j+1)
+				if after < before-1e-6 {
+					for a, b := i, j; a < b; a, b = a+1, b-1 {
+						order[a], order[b] = order[b], order[a]
+					}
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return order
+}
+
+func pathLength(start *Point, stops []Point, order []int) float64 {
+	length := 0.0
+	for i, stop := range order {
+		if i > 0 {
+			length += Distance(stops[order[i-1]], stops[stop])
+		} else if start != nil {
+			length += Distance(*start, stops[stop])
+		}
+	}
+	return length
+}
@@ -0,0 +1,293 @@
+// Package ingest files the photos of a folder, such as the SD card of a
+// camera, into their worksheets. Each file is matched to a worksheet by the
+// name of its folder, by its file name or by the QR code shot at the start
+// of its series, then saved like an upload.
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/qr"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
+)
+
+// Ways to match a file to its worksheet.
+const (
+	// ByFolder takes the name of a folder holding the file, the nearest
+	// first, as a worksheet number.
+	ByFolder = "folder"
+	// ByFileName takes the worksheet number from the file name with a
+	// pattern.
+	ByFileName = "filename"
+	// ByQR reads a worksheet QR code from the file. The files after it in
+	// the same folder, by capture time, belong to the same worksheet until
+	// the next QR code.
+	ByQR = "qr"
+)
+
+// DefaultMatch tries every way in turn.
+var DefaultMatch = []string{ByFolder, ByFileName, ByQR}
+
+// DefaultPattern takes the file name up to the first underscore or space,
+// so WS-0012_0003.jpg goes to worksheet WS-0012.
+var DefaultPattern = regexp.MustCompile(`^([^_ ]+)[_ ]`)
+
+// File is a photo or video found under the root folder.
+type File struct {
+	// Path is relative to the root folder.
+	Path  string
+	Size  int64
+	Taken time.Time
+
+	Worksheet *models.Worksheet
+	MatchedBy string
+	// QR is set when the file shows a worksheet QR code.
+	QR bool
+}
+
+// Ingest saves the files under Root into the worksheets they match.
+type Ingest struct {
+	Root    string
+	Match   []string
+	Pattern *regexp.Regexp
+	DB      *models.Database
+	Store   *store.Store
+
+	// Log records every file saved. Files it holds are skipped, so an
+	// interrupted ingest can be run again.
+	Log string
+
+	worksheets map[string]*models.Worksheet
+}
+
+var extensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".mp4": true}
+
+// Scan lists the photos and videos under Root by folder and capture time.
+// Hidden files and folders are left out.
+func (in *Ingest) Scan() ([]*File, error) {
+	files := []*File{}
+	err := filepath.Walk(in.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != in.Root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !extensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		rel, err := filepath.Rel(in.Root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, &File{
+			Path:  filepath.ToSlash(rel),
+			Size:  info.Size(),
+			Taken: captureTime(path, info),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if da, db := filepath.Dir(a.Path), filepath.Dir(b.Path); da != db {
+			return da < db
+		}
+		if !a.Taken.Equal(b.Taken) {
+			return a.Taken.Before(b.Taken)
+		}
+		return a.Path < b.Path
+	})
+	return files, nil
+}
+
+// captureTime is the EXIF time of a photo, or the modification time of
+// files without one.
+func captureTime(path string, info os.FileInfo) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return info.ModTime()
+	}
+	defer f.Close()
+	x, err := exif.Decode(f)
+	if err != nil {
+		return info.ModTime()
+	}
+	t, err := x.DateTime()
+	if err != nil {
+		return info.ModTime()
+	}
+	return t
+}
+
+// Assign matches each file to a worksheet, trying the ways of Match in
+// turn. Files that match none are left without a worksheet.
+func (in *Ingest) Assign(files []*File) error {
+	pattern := in.Pattern
+	if pattern == nil {
+		pattern = DefaultPattern
+	}
+	match := in.Match
+	if len(match) == 0 {
+		match = DefaultMatch
+	}
+
+	// series holds the worksheet of the last QR code read in each folder.
+	series := map[string]*models.Worksheet{}
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		for _, by := range match {
+			var err error
+			switch by {
+			case ByFolder:
+				for d := dir; d != "." && d != "/" && file.Worksheet == nil; d = filepath.Dir(d) {
+					file.Worksheet, err = in.worksheet(filepath.Base(d))
+				}
+			case ByFileName:
+				name := strings.TrimSuffix(filepath.Base(file.Path), filepath.Ext(file.Path))
+				if m := pattern.FindStringSubmatch(name); m != nil {
+					file.Worksheet, err = in.worksheet(m[len(m)-1])
+				}
+			case ByQR:
+				err = in.readQR(file, series)
+				if file.Worksheet == nil {
+					file.Worksheet = series[dir]
+				}
+			default:
+				return fmt.Errorf("ingest: unknown way to match %q", by)
+			}
+			if err != nil {
+				return err
+			}
+			if file.Worksheet != nil {
+				file.MatchedBy = by
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// readQR looks for a worksheet QR code in an image and starts a series in
+// its folder when there is one.
+func (in *Ingest) readQR(file *File, series map[string]*models.Worksheet) error {
+	if strings.ToLower(filepath.Ext(file.Path)) == ".mp4" {
+		return nil
+	}
+	text, err := qr.DecodeFile(filepath.Join(in.Root, filepath.FromSlash(file.Path)))
+	if err != nil {
+		return nil
+	}
+	id, ok := in.Store.QR.WorksheetID(text)
+	if !ok {
+		return nil
+	}
+	worksheet, err := in.DB.GetWorksheet(id)
+	if err != nil || worksheet == nil {
+		return err
+	}
+	file.QR = true
+	file.Worksheet = worksheet
+	series[filepath.Dir(file.Path)] = worksheet
+	return nil
+}
+
+// worksheet returns the worksheet with a number, remembering the lookups.
+func (in *Ingest) worksheet(number string) (*models.Worksheet, error) {
+	if in.worksheets == nil {
+		in.worksheets = map[string]*models.Worksheet{}
+	}
+	if w, ok := in.worksheets[number]; ok {
+		return w, nil
+	}
+	w, err := in.DB.GetWorksheetByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	in.worksheets[number] = w
+	return w, nil
+}
+
+// Save saves the matched files that the log does not hold yet, numbering
+// them after the last photo of their worksheet, and makes their
+// thumbnails. done is called with the result of each file.
+func (in *Ingest) Save(files []*File, done func(*File, *store.BatchResult)) error {
+	saved, err := in.readLog()
+	if err != nil {
+		return err
+	}
+	log, err := os.OpenFile(in.Log, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	for _, file := range files {
+		if file.Worksheet == nil || saved[logKey(file)] {
+			continue
+		}
+		path := filepath.Join(in.Root, filepath.FromSlash(file.Path))
+		batch := []*store.BatchFile{{
+			Name: filepath.Base(path),
+			Open: func() (io.ReadCloser, error) { return os.Open(path) },
+		}}
+		result := in.Store.SaveBatch(in.DB, &models.Photo{WorksheetID: file.Worksheet.ID}, batch, store.NumberByCaptureTime, nil)[0]
+		if result.Err == nil {
+			// Videos have no thumbnails.
+			for _, size := range store.ThumbnailSizes {
+				in.Store.Thumbnail(result.Photo, size)
+			}
+			_, err := fmt.Fprintf(log, "%d\t%d\t%s\n", result.Photo.ID, file.Size, file.Path)
+			if err != nil {
+				return err
+			}
+		}
+		if done != nil {
+			done(file, result)
+		}
+	}
+	return log.Close()
+}
+
+func logKey(file *File) string {
+	return strconv.FormatInt(file.Size, 10) + "\t" + file.Path
+}
+
+// readLog returns the files the log holds, by logKey. Each line is the ID
+// of the photo, the size of the file and its path.
+func (in *Ingest) readLog() (map[string]bool, error) {
+	saved := map[string]bool{}
+	f, err := os.Open(in.Log)
+	if os.IsNotExist(err) {
+		return saved, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) == 3 {
+			saved[fields[1]+"\t"+fields[2]] = true
+		}
+	}
+	return saved, scanner.Err()
+}
@@ -0,0 +1,266 @@
+// Package labels lays out QR code stickers for worksheets and boards, as
+// sheets of A4 labels in a PDF or as ZPL for thermal label printers.
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	qrcode "github.com/skip2/go-qrcode"
+	"gitlab.com/code-mobi/board-checker/pkg/qr"
+)
+
+// Label is one sticker: a QR code of URL with a number and a name beside
+// it.
+type Label struct {
+	URL    string
+	Number string
+	Name   string
+}
+
+// Layout is a grid of labels on an A4 sheet. Lengths are in millimetres.
+type Layout struct {
+	Name          string
+	Columns, Rows int
+	Width, Height float64
+	// Top and Left are the margins of the first label.
+	Top, Left float64
+	// GapX and GapY are the spaces between columns and rows.
+	GapX, GapY float64
+}
+
+// PerSheet is how many labels a sheet holds.
+func (l *Layout) PerSheet() int {
+	return l.Columns * l.Rows
+}
+
+// A4 in millimetres.
+const (
+	sheetWidth  = 210.0
+	sheetHeight = 297.0
+	// gridMargin surrounds the labels of a COLSxROWS layout.
+	gridMargin = 10.0
+)
+
+// Layouts are common Avery label sheets.
+var Layouts = []*Layout{
+	{Name: "L7159", Columns: 3, Rows: 8, Width: 63.5, Height: 33.9, Top: 12.9, Left: 7.25, GapX: 2.5},
+	{Name: "L7160", Columns: 3, Rows: 7, Width: 63.5, Height: 38.1, Top: 15.15, Left: 7.25, GapX: 2.5},
+	{Name: "L7163", Columns: 2, Rows: 7, Width: 99.1, Height: 38.1, Top: 15.15, Left: 4.65, GapX: 2.5},
+	{Name: "L7165", Columns: 2, Rows: 4, Width: 99.1, Height: 67.7, Top: 13.1, Left: 4.65, GapX: 2.5},
+}
+
+// DefaultLayout is the name of the layout used when none is chosen.
+const DefaultLayout = "L7160"
+
+// ParseLayout returns the layout of Layouts with a name, or for COLSxROWS,
+// such as 4x10, a grid of that many labels spread over the sheet.
+func ParseLayout(name string) (*Layout, error) {
+	for _, l := range Layouts {
+		if strings.EqualFold(l.Name, name) {
+			return l, nil
+		}
+	}
+	parts := strings.Split(strings.ToLower(name), "x")
+	if len(parts) == 2 {
+		cols, err1 := strconv.Atoi(parts[0])
+		rows, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && cols > 0 && cols <= 10 && rows > 0 && rows <= 20 {
+			return &Layout{
+				Name:    name,
+				Columns: cols,
+				Rows:    rows,
+				Width:   (sheetWidth - 2*gridMargin) / float64(cols),
+				Height:  (sheetHeight - 2*gridMargin) / float64(rows),
+				Top:     gridMargin,
+				Left:    gridMargin,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("labels: unknown layout %q", name)
+}
+
+// qrLevel survives a scratched or dirty sticker.
+const qrLevel = qrcode.High
+
+// qrPixels is the side of the QR code images placed in the PDF.
+const qrPixels = 300
+
+// Sheet writes labels as a PDF of A4 sheets.
+type Sheet struct {
+	Layout *Layout
+
+	// Font is a TrueType font file for text outside Latin-1, such as Thai.
+	// Without one the core Helvetica font is used.
+	Font string
+
+	// Outline draws the edge of every label, to check the layout on plain
+	// paper.
+	Outline bool
+
+	pdf *gofpdf.Fpdf
+	tr  func(string) string
+}
+
+// Write writes the PDF of labels, filling each sheet row by row.
+func (s *Sheet) Write(w io.Writer, title string, labels []*Label) error {
+	s.pdf = gofpdf.New("P", "mm", "A4", "")
+	pdf := s.pdf
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("Board Checker", true)
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+
+	if s.Font != "" {
+		pdf.AddUTF8Font("labels", "", s.Font)
+		pdf.AddUTF8Font("labels", "B", s.Font)
+		s.tr = func(s string) string { return s }
+	} else {
+		s.tr = pdf.UnicodeTranslatorFromDescriptor("")
+	}
+
+	layout := s.Layout
+	for i, label := range labels {
+		n := i % layout.PerSheet()
+		if n == 0 {
+			pdf.AddPage()
+		}
+		x := layout.Left + float64(n%layout.Columns)*(layout.Width+layout.GapX)
+		y := layout.Top + float64(n/layout.Columns)*(layout.Height+layout.GapY)
+		if err := s.label(i, label, x, y); err != nil {
+			return err
+		}
+		if err := pdf.Error(); err != nil {
+			return err
+		}
+	}
+	if len(labels) == 0 {
+		pdf.AddPage()
+	}
+	return pdf.Output(w)
+}
+
+// label draws a label with its top left corner at x, y: the QR code on the
+// left and the number and name to its right.
+func (s *Sheet) label(i int, label *Label, x, y float64) error {
+	pdf := s.pdf
+	l := s.Layout
+	if s.Outline {
+		pdf.SetDrawColor(200, 200, 200)
+		pdf.Rect(x, y, l.Width, l.Height, "D")
+	}
+
+	pad := 2.0
+	side := l.Height - 2*pad
+	if side > l.Width/2 {
+		side = l.Width / 2
+	}
+	png, err := qr.PNG(label.URL, qrLevel, qrPixels)
+	if err != nil {
+		return err
+	}
+	name := "qr" + strconv.Itoa(i)
+	pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+	pdf.ImageOptions(name, x+pad, y+(l.Height-side)/2, side, side, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+	tx := x + pad + side + pad
+	tw := x + l.Width - pad - tx
+	if tw < 10 {
+		return nil
+	}
+	pdf.ClipRect(tx, y+pad, tw, l.Height-2*pad, false)
+	defer pdf.ClipEnd()
+
+	number := 12.0
+	text := 8.0
+	if l.Height < 30 {
+		number, text = 10, 7
+	}
+	ty := y + pad + 1
+	s.font("B", number)
+	for _, line := range s.wrap(label.Number, tw, 2) {
+		pdf.SetXY(tx, ty)
+		pdf.CellFormat(tw, number*0.45, line, "", 0, "L", false, 0, "")
+		ty += number * 0.45
+	}
+	ty += 1
+	s.font("", text)
+	lines := int((y + l.Height - pad - ty) / (text * 0.42))
+	for _, line := range s.wrap(label.Name, tw, lines) {
+		pdf.SetXY(tx, ty)
+		pdf.CellFormat(tw, text*0.42, line, "", 0, "L", false, 0, "")
+		ty += text * 0.42
+	}
+	return nil
+}
+
+func (s *Sheet) font(style string, size float64) {
+	if s.Font != "" {
+		s.pdf.SetFont("labels", style, size)
+	} else {
+		s.pdf.SetFont("Helvetica", style, size)
+	}
+}
+
+// wrap breaks text into at most max lines of width, between words where
+// it can and between characters in text without spaces, such as Thai. The
+// last line ends in an ellipsis when text is cut short.
+func (s *Sheet) wrap(text string, width float64, max int) []string {
+	text = s.tr(strings.TrimSpace(text))
+	if max <= 0 || text == "" {
+		return nil
+	}
+	// Translated text is one byte a character, UTF-8 text is not.
+	chars := func(s string) []string { return strings.Split(s, "") }
+	if s.Font == "" {
+		chars = func(s string) []string {
+			b := make([]string, len(s))
+			for i := 0; i < len(s); i++ {
+				b[i] = s[i : i+1]
+			}
+			return b
+		}
+	}
+	fits := func(line string) bool { return s.pdf.GetStringWidth(line) <= width }
+
+	lines := []string{}
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if fits(candidate) {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+			line = ""
+		}
+		for _, c := range chars(word) {
+			if line != "" && !fits(line+c) {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += c
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	if len(lines) > max {
+		last := lines[max-1]
+		for last != "" && !fits(last+"...") {
+			c := chars(last)
+			last = strings.Join(c[:len(c)-1], "")
+		}
+		lines = append(lines[:max-1], last+"...")
+	}
+	return lines
+}
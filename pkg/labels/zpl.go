@@ -0,0 +1,73 @@
+package labels
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Printer is the label stock of a thermal printer. Lengths are in
+// millimetres.
+type Printer struct {
+	DPI           int
+	Width, Height float64
+}
+
+// DefaultPrinter is a 203 dpi printer with 50 by 30 mm labels.
+var DefaultPrinter = Printer{DPI: 203, Width: 50, Height: 30}
+
+func (p Printer) dots(mm float64) int {
+	return int(mm * float64(p.DPI) / 25.4)
+}
+
+// zplEscape hex-escapes the characters ZPL reads as commands, for a field
+// started with ^FH.
+var zplEscape = strings.NewReplacer("_", "_5F", "^", "_5E", "~", "_7E")
+
+// WriteZPL writes labels as ZPL for Zebra printers, one format a label.
+// Text is UTF-8, which printers show with fonts that have its characters.
+func WriteZPL(w io.Writer, p Printer, labels []*Label) error {
+	bw := bufio.NewWriter(w)
+	width, height := p.dots(p.Width), p.dots(p.Height)
+	pad := p.dots(2)
+
+	for _, label := range labels {
+		q, err := qrcode.New(label.URL, qrLevel)
+		if err != nil {
+			return err
+		}
+		// The printer draws the code without the quiet zone of Bitmap.
+		modules := 17 + 4*q.VersionNumber
+		side := height - 2*pad
+		if side > width/2 {
+			side = width / 2
+		}
+		mag := side / modules
+		if mag < 1 {
+			mag = 1
+		} else if mag > 10 {
+			mag = 10
+		}
+		side = mag * modules
+
+		tx := pad + side + pad
+		tw := width - pad - tx
+		number := p.dots(3.5)
+		text := p.dots(2.5)
+
+		fmt.Fprintf(bw, "^XA^CI28^PW%d^LL%d\n", width, height)
+		fmt.Fprintf(bw, "^FO%d,%d^BQN,2,%d^FH^FDQA,%s^FS\n", pad, (height-side)/2, mag, zplEscape.Replace(label.URL))
+		if tw > 0 {
+			fmt.Fprintf(bw, "^FO%d,%d^A0N,%d,%d^FB%d,2,0,L^FH^FD%s^FS\n", tx, pad, number, number, tw, zplEscape.Replace(label.Number))
+			lines := (height - 2*pad - 2*number - pad) / text
+			if lines > 0 {
+				fmt.Fprintf(bw, "^FO%d,%d^A0N,%d,%d^FB%d,%d,0,L^FH^FD%s^FS\n", tx, pad+2*number+pad, text, text, tw, lines, zplEscape.Replace(label.Name))
+			}
+		}
+		fmt.Fprint(bw, "^XZ\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+)
+
+var (
+	ErrDuplicateBoardCode = errors.New("models: board with this code already exists")
+	ErrBoardInUse         = errors.New("models: board has worksheets")
+)
+
+const boardColumns = `b.id, b.code, b.name, b.lat, b.lng, b.size, b.facing, b.type, b.owner, b.zone_id, IFNULL(z.name, ''), b.created, b.updated`
+
+const boardFrom = ` FROM boards b LEFT JOIN zones z on (b.zone_id = z.id)`
+
+func scanBoard(row interface{ Scan(...interface{}) error }) (*Board, error) {
+	b := &Board{}
+	err := row.Scan(&b.ID, &b.Code, &b.Name, &b.Lat, &b.Lng, &b.Size, &b.Facing, &b.Type, &b.Owner, &b.ZoneID, &b.ZoneName, &b.Created, &b.Updated)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (db *Database) ListBoards(q *forms.Query) (Boards, *PageInfo, error) {
+	pageInfo := &PageInfo{MaxResults: q.MaxResults}
+	stmt := boardFrom + " WHERE 1 = 1"
+	params := []interface{}{}
+	if q.Q != "" {
+		stmt += " AND (b.code LIKE ? OR b.name LIKE ?)"
+		params = append(params, "%"+q.Q+"%", "%"+q.Q+"%")
+	}
+
+	row := db.QueryRow("SELECT count(b.id)"+stmt, params...)
+	err := row.Scan(&pageInfo.TotalResults)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	where, keyParams, order := keyset(q, "b.code", "b.id", false)
+	limitStmt, limitParams := limit(q)
+	stmt += where + order + limitStmt
+	params = append(append(params, keyParams...), limitParams...)
+
+	rows, err := db.Query("SELECT "+boardColumns+stmt, params...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	boards := Boards{}
+	for rows.Next() {
+		b, err := scanBoard(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		boards = append(boards, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	page, more := pageRows(q, boards)
+	boards = page.(Boards)
+	if len(boards) > 0 {
+		first, last := boards[0], boards[len(boards)-1]
+		pageInfo.ConfigCursors(q, more, &Cursor{Key: first.Code, ID: first.ID}, &Cursor{Key: last.Code, ID: last.ID})
+	}
+
+	return boards, pageInfo, nil
+}
+
+func (db *Database) GetBoard(id int) (*Board, error) {
+	return scanBoard(db.QueryRow("SELECT "+boardColumns+boardFrom+" WHERE b.id = ?", id))
+}
+
+func (db *Database) InsertBoard(board *Board) error {
+	stmt := `INSERT INTO boards (code, name, lat, lng, geohash, size, facing, type, owner, zone_id, created, updated, seq)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(6), ` + changeSeq + `)`
+	result, err := db.execChange(stmt, board.Code, board.Name, board.Lat, board.Lng, geohash(board.location()), board.Size, board.Facing, board.Type, board.Owner, board.ZoneID)
+	if err != nil {
+		return boardError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	board.ID = int(id)
+	return nil
+}
+
+func (db *Database) UpdateBoard(board *Board) error {
+	stmt := `UPDATE boards SET code = ?, name = ?, lat = ?, lng = ?, geohash = ?, size = ?, facing = ?, type = ?, owner = ?, zone_id = ?,
+	updated = UTC_TIMESTAMP(6), seq = ` + changeSeq + ` WHERE id = ?`
+	_, err := db.execChange(stmt, board.Code, board.Name, board.Lat, board.Lng, geohash(board.location()), board.Size, board.Facing, board.Type, board.Owner, board.ZoneID, board.ID)
+	if err != nil {
+		return boardError(err)
+	}
+	return nil
+}
+
+// DeleteBoard refuses to delete a board that worksheets link to, so its
+// inspection history is never lost.
+func (db *Database) DeleteBoard(boardID int) error {
+	var n int
+	err := db.QueryRow(`SELECT count(id) FROM worksheets WHERE board_id = ?`, boardID).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrBoardInUse
+	}
+	return db.deleteWithTombstone(EntityBoards, boardID)
+}
+
+// ListBoardInspections returns the worksheets of a board with their photos,
+// newest first.
+func (db *Database) ListBoardInspections(boardID int) ([]*Inspection, error) {
+	stmt := `SELECT w.id, w.number, w.name, w.created, z.id zone_id, z.name zone_name, t.id team_id, t.name team_name FROM worksheets w
+	INNER JOIN zones z on (w.zone_id = z.id)
+	INNER JOIN teams t on (w.team_id = t.id)
+	WHERE w.board_id = ?
+	ORDER BY w.created DESC, w.id DESC`
+	rows, err := db.Query(stmt, boardID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	inspections := []*Inspection{}
+	byWorksheet := map[int]*Inspection{}
+	for rows.Next() {
+		p := &Worksheet{BoardID: boardID}
+		err := rows.Scan(&p.ID, &p.Number, &p.Name, &p.Created, &p.ZoneID, &p.ZoneName, &p.TeamID, &p.TeamName)
+		if err != nil {
+			return nil, err
+		}
+		inspection := &Inspection{Worksheet: p, Photos: Photos{}}
+		inspections = append(inspections, inspection)
+		byWorksheet[p.ID] = inspection
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT `+photoColumns+` FROM photos
+	WHERE worksheet_id IN (SELECT id FROM worksheets WHERE board_id = ?)
+	ORDER BY running_number, id`, boardID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		f, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		if inspection, ok := byWorksheet[f.WorksheetID]; ok {
+			inspection.Photos = append(inspection.Photos, f)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return inspections, nil
+}
+
+func boardError(err error) error {
+	if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+		return ErrDuplicateBoardCode
+	}
+	return err
+}
@@ -0,0 +1,366 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	ErrDuplicateChecklist = errors.New("models: another checklist has this zone and board type")
+	ErrUnknownSlot        = errors.New("models: the checklist of the worksheet has no such slot")
+)
+
+// ChecklistSlot is a photo an inspection needs, such as the front of the
+// board. Lit slots are only needed for boards that are lit at night.
+type ChecklistSlot struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Lit  bool   `json:"lit"`
+}
+
+// Checklist is a template of the photo slots of a worksheet. It applies to
+// the worksheets of its zone and of boards of its board type, where 0 and
+// "" stand for any.
+type Checklist struct {
+	ID        int              `json:"id"`
+	Name      string           `json:"name"`
+	ZoneID    int              `json:"zoneID"`
+	ZoneName  string           `json:"zoneName"`
+	BoardType string           `json:"boardType"`
+	Slots     []*ChecklistSlot `json:"slots"`
+	Created   time.Time        `json:"-"`
+	Updated   time.Time        `json:"-"`
+}
+
+// DefaultChecklistSlots are the slots a new checklist starts with.
+var DefaultChecklistSlots = []*ChecklistSlot{
+	{Code: "front", Name: "Front"},
+	{Code: "left", Name: "Left angle"},
+	{Code: "right", Name: "Right angle"},
+	{Code: "lighting", Name: "Lighting close-up", Lit: true},
+	{Code: "night", Name: "Night shot", Lit: true},
+}
+
+// LitBoard reports whether boards of a type are lit at night.
+func LitBoard(boardType string) bool {
+	return boardType == BoardTypeLED || boardType == BoardTypeLightbox
+}
+
+// worksheetChecklist selects the checklist of worksheet w with board b:
+// the one of its zone and board type, else of its zone, else of its board
+// type, else the one for all.
+const worksheetChecklist = `(SELECT c.id FROM checklists c
+	WHERE c.zone_id IN (0, w.zone_id) AND c.board_type IN ('', IFNULL(b.type, ''))
+	ORDER BY c.zone_id <> 0 DESC, c.board_type <> '' DESC LIMIT 1)`
+
+// checklistSlots selects the slots s of the checklist of w that board b
+// needs.
+const checklistSlots = ` FROM checklist_slots s WHERE s.checklist_id = ` + worksheetChecklist + `
+	AND (s.lit = 0 OR b.type IN ('` + BoardTypeLED + `', '` + BoardTypeLightbox + `'))`
+
+const slotsRequired = `(SELECT count(s.id)` + checklistSlots + `)`
+
+const slotsFilled = `(SELECT count(s.id)` + checklistSlots + `
+	AND EXISTS (SELECT 1 FROM photos p WHERE p.worksheet_id = w.id AND p.slot = s.code AND p.review <> '` + ReviewRejected + `'))`
+
+const checklistColumns = `c.id, c.name, c.zone_id, IFNULL(z.name, ''), c.board_type, c.created, c.updated`
+
+const checklistFrom = ` FROM checklists c LEFT JOIN zones z on (c.zone_id = z.id)`
+
+func scanChecklist(row interface{ Scan(...interface{}) error }) (*Checklist, error) {
+	c := &Checklist{}
+	err := row.Scan(&c.ID, &c.Name, &c.ZoneID, &c.ZoneName, &c.BoardType, &c.Created, &c.Updated)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListChecklists returns every checklist with its slots, by name.
+func (db *Database) ListChecklists() ([]*Checklist, error) {
+	rows, err := db.Query(`SELECT ` + checklistColumns + checklistFrom + ` ORDER BY c.name, c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checklists := []*Checklist{}
+	byID := map[int]*Checklist{}
+	for rows.Next() {
+		c, err := scanChecklist(rows)
+		if err != nil {
+			return nil, err
+		}
+		c.Slots = []*ChecklistSlot{}
+		checklists = append(checklists, c)
+		byID[c.ID] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT checklist_id, code, name, lit FROM checklist_slots ORDER BY checklist_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var checklistID int
+		s := &ChecklistSlot{}
+		if err := rows.Scan(&checklistID, &s.Code, &s.Name, &s.Lit); err != nil {
+			return nil, err
+		}
+		if c, ok := byID[checklistID]; ok {
+			c.Slots = append(c.Slots, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return checklists, nil
+}
+
+// GetChecklist returns a checklist with its slots, or nil.
+func (db *Database) GetChecklist(id int) (*Checklist, error) {
+	c, err := scanChecklist(db.QueryRow(`SELECT `+checklistColumns+checklistFrom+` WHERE c.id = ?`, id))
+	if err != nil || c == nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT code, name, lit FROM checklist_slots WHERE checklist_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c.Slots = []*ChecklistSlot{}
+	for rows.Next() {
+		s := &ChecklistSlot{}
+		if err := rows.Scan(&s.Code, &s.Name, &s.Lit); err != nil {
+			return nil, err
+		}
+		c.Slots = append(c.Slots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// InsertChecklist inserts a checklist and its slots. It returns
+// ErrDuplicateChecklist when another one has the same zone and board type.
+func (db *Database) InsertChecklist(c *Checklist) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`INSERT INTO checklists (name, zone_id, board_type, created, updated)
+	VALUES (?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(6))`, c.Name, c.ZoneID, c.BoardType)
+	if err != nil {
+		tx.Rollback()
+		return checklistError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertChecklistSlots(tx, int(id), c.Slots); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.ID = int(id)
+	return nil
+}
+
+// UpdateChecklist saves a checklist and replaces its slots.
+func (db *Database) UpdateChecklist(c *Checklist) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE checklists SET name = ?, zone_id = ?, board_type = ?, updated = UTC_TIMESTAMP(6) WHERE id = ?`,
+		c.Name, c.ZoneID, c.BoardType, c.ID)
+	if err != nil {
+		tx.Rollback()
+		return checklistError(err)
+	}
+	if _, err := tx.Exec(`DELETE FROM checklist_slots WHERE checklist_id = ?`, c.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := insertChecklistSlots(tx, c.ID, c.Slots); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertChecklistSlots(ex execer, checklistID int, slots []*ChecklistSlot) error {
+	for i, s := range slots {
+		_, err := ex.Exec(`INSERT INTO checklist_slots (checklist_id, position, code, name, lit) VALUES (?, ?, ?, ?, ?)`,
+			checklistID, i, s.Code, s.Name, s.Lit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checklistError(err error) error {
+	if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+		return ErrDuplicateChecklist
+	}
+	return err
+}
+
+// DeleteChecklist deletes a checklist and its slots. Photos keep the slot
+// they were taken for.
+func (db *Database) DeleteChecklist(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM checklist_slots WHERE checklist_id = ?`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM checklists WHERE id = ?`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SlotCompletion is a slot of the checklist of a worksheet with the number
+// of photos taken for it.
+type SlotCompletion struct {
+	ChecklistSlot
+	Photos int `json:"photos"`
+}
+
+// Completion is how many of the slots of its checklist the photos of a
+// worksheet fill.
+type Completion struct {
+	ChecklistID   int               `json:"checklistID"`
+	ChecklistName string            `json:"checklistName"`
+	Slots         []*SlotCompletion `json:"slots"`
+	Filled        int               `json:"filled"`
+	Required      int               `json:"required"`
+}
+
+// Complete reports whether every slot has a photo.
+func (c *Completion) Complete() bool {
+	return c.Filled == c.Required
+}
+
+// HasSlot reports whether the checklist has a slot with code. A nil
+// Completion has none.
+func (c *Completion) HasSlot(code string) bool {
+	if c == nil {
+		return false
+	}
+	for _, s := range c.Slots {
+		if s.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCompletion returns the completion of the checklist of a worksheet, or
+// nil when the worksheet is missing or no checklist applies to it. Lit
+// slots only count for lit boards, and rejected photos fill none.
+func (db *Database) GetCompletion(worksheetID int) (*Completion, error) {
+	var checklistID int
+	var boardType string
+	err := db.QueryRow(`SELECT IFNULL(`+worksheetChecklist+`, 0), IFNULL(b.type, '')`+worksheetFrom+`
+	WHERE w.id = ?`, worksheetID).Scan(&checklistID, &boardType)
+	if err == sql.ErrNoRows || checklistID == 0 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	checklist, err := db.GetChecklist(checklistID)
+	if err != nil || checklist == nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT slot, count(id) FROM photos WHERE worksheet_id = ? AND slot <> '' AND review <> ? GROUP BY slot`, worksheetID, ReviewRejected)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := map[string]int{}
+	for rows.Next() {
+		var slot string
+		var n int
+		if err := rows.Scan(&slot, &n); err != nil {
+			return nil, err
+		}
+		photos[slot] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	c := &Completion{ChecklistID: checklist.ID, ChecklistName: checklist.Name, Slots: []*SlotCompletion{}}
+	for _, s := range checklist.Slots {
+		if s.Lit && !LitBoard(boardType) {
+			continue
+		}
+		c.Slots = append(c.Slots, &SlotCompletion{ChecklistSlot: *s, Photos: photos[s.Code]})
+		c.Required++
+		if photos[s.Code] > 0 {
+			c.Filled++
+		}
+	}
+	return c, nil
+}
+
+// CheckSlot returns ErrUnknownSlot unless slot is empty or one of the
+// checklist of a worksheet.
+func (db *Database) CheckSlot(worksheetID int, slot string) error {
+	if slot == "" {
+		return nil
+	}
+	c, err := db.GetCompletion(worksheetID)
+	if err != nil {
+		return err
+	}
+	if !c.HasSlot(slot) {
+		return ErrUnknownSlot
+	}
+	return nil
+}
+
+// SetPhotoSlot sets the checklist slot a photo was taken for, or clears it.
+// It returns ErrWorksheetApproved once the photo's worksheet is approved.
+func (db *Database) SetPhotoSlot(photoID int, slot string) error {
+	return db.change(func(tx *sql.Tx) error {
+		var worksheetID int
+		err := tx.QueryRow(`SELECT worksheet_id FROM photos WHERE id = ? FOR UPDATE`, photoID).Scan(&worksheetID)
+		if err != nil {
+			return err
+		}
+		if err := lockAcceptsPhotos(tx, worksheetID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE photos SET slot = ?, updated = UTC_TIMESTAMP(6), seq = `+changeSeq+` WHERE id = ?`, slot, photoID)
+		return err
+	})
+}
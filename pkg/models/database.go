@@ -2,18 +2,37 @@ package models
 
 import (
 	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 type Database struct {
 	*sql.DB
 }
 
+// execer runs statements on the database or within a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 func (db *Database) CreateTable() error {
 
 	_, err := db.Exec(`CREATE TABLE zones (
 		id int(11) NOT NULL AUTO_INCREMENT,
 		name varchar(255) NOT NULL,
-		PRIMARY KEY (id)
+		boundary mediumtext,
+		min_lat double DEFAULT NULL,
+		min_lng double DEFAULT NULL,
+		max_lat double DEFAULT NULL,
+		max_lng double DEFAULT NULL,
+		created datetime NOT NULL DEFAULT '1970-01-01 00:00:00',
+		updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00',
+		seq bigint NOT NULL DEFAULT 0,
+		PRIMARY KEY (id),
+		KEY updated (updated),
+		KEY seq (seq),
+		KEY bounds (min_lat, max_lat, min_lng, max_lng),
+		FULLTEXT KEY ft_zones (name)
 	  ) ENGINE=InnoDB AUTO_INCREMENT=4 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 	
 	  CREATE TABLE photos (
@@ -23,14 +42,50 @@ func (db *Database) CreateTable() error {
 		filename varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL,
 		created datetime NOT NULL,
 		location varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL,
+		caption varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
 		photoscol varchar(45) COLLATE utf8mb4_general_ci DEFAULT NULL,
-		PRIMARY KEY (id)
+		updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00',
+		uuid varchar(36) COLLATE utf8mb4_general_ci DEFAULT NULL,
+		sha256 char(64) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		exif mediumblob,
+		lat double DEFAULT NULL,
+		lng double DEFAULT NULL,
+		geohash char(12) CHARACTER SET ascii COLLATE ascii_bin DEFAULT NULL,
+		geofence varchar(10) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		distance double DEFAULT NULL,
+		qr_worksheet_id int(11) DEFAULT NULL,
+		user_id int(11) DEFAULT NULL,
+		review varchar(10) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		review_reason varchar(30) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		review_note varchar(255) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		reviewer_id int(11) DEFAULT NULL,
+		reviewed datetime DEFAULT NULL,
+		slot varchar(30) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		seq bigint NOT NULL DEFAULT 0,
+		PRIMARY KEY (id),
+		KEY worksheet_geofence (worksheet_id, geofence),
+		KEY qr_worksheet_id (qr_worksheet_id),
+		KEY review (review),
+		KEY user_review (user_id, review),
+		KEY worksheet_slot (worksheet_id, slot),
+		UNIQUE KEY uuid (uuid),
+		KEY worksheet_sha256 (worksheet_id, sha256),
+		KEY updated (updated),
+		KEY seq (seq),
+		KEY geohash (geohash),
+		FULLTEXT KEY ft_photos (location, caption)
 	  ) ENGINE=InnoDB AUTO_INCREMENT=7 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 	
 	  CREATE TABLE teams (
 		id int(11) NOT NULL AUTO_INCREMENT,
 		name varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL,
-		PRIMARY KEY (id)
+		created datetime NOT NULL DEFAULT '1970-01-01 00:00:00',
+		updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00',
+		seq bigint NOT NULL DEFAULT 0,
+		PRIMARY KEY (id),
+		KEY updated (updated),
+		KEY seq (seq),
+		FULLTEXT KEY ft_teams (name)
 	  ) ENGINE=InnoDB AUTO_INCREMENT=4 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 	
 	
@@ -40,9 +95,24 @@ func (db *Database) CreateTable() error {
 		team_id int(11) NOT NULL,
 		zone_id int(11) NOT NULL,
 		name varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL,
+		campaign varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		board_id int(11) DEFAULT NULL,
+		lat double DEFAULT NULL,
+		lng double DEFAULT NULL,
+		geohash char(12) CHARACTER SET ascii COLLATE ascii_bin DEFAULT NULL,
+		status varchar(20) COLLATE utf8mb4_general_ci NOT NULL DEFAULT 'draft',
 		created datetime NOT NULL,
+		updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00',
+		seq bigint NOT NULL DEFAULT 0,
 		PRIMARY KEY (id,number),
-		UNIQUE KEY number_UNIQUE (number)
+		KEY status (status),
+		KEY board_id (board_id),
+		KEY geohash (geohash),
+		KEY campaign (campaign),
+		UNIQUE KEY number_UNIQUE (number),
+		KEY updated (updated),
+		KEY seq (seq),
+		FULLTEXT KEY ft_worksheets (number, name)
 	  ) ENGINE=InnoDB AUTO_INCREMENT=10 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 	  
 	
@@ -50,9 +120,98 @@ func (db *Database) CreateTable() error {
 		id int(11) NOT NULL AUTO_INCREMENT,
 		name varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
 		password char(60) COLLATE utf8mb4_general_ci NOT NULL,
+		role varchar(20) COLLATE utf8mb4_general_ci NOT NULL DEFAULT 'inspector',
+		team_id int(11) DEFAULT NULL,
 		created datetime NOT NULL,
 		PRIMARY KEY (id)
 	) ENGINE=InnoDB AUTO_INCREMENT=0 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+	CREATE TABLE worksheet_status_changes (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		worksheet_id int(11) NOT NULL,
+		from_status varchar(20) COLLATE utf8mb4_general_ci NOT NULL,
+		to_status varchar(20) COLLATE utf8mb4_general_ci NOT NULL,
+		user_id int(11) NOT NULL,
+		reason varchar(255) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		created datetime NOT NULL,
+		PRIMARY KEY (id),
+		KEY worksheet_id (worksheet_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+	CREATE TABLE deletions (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		entity varchar(20) COLLATE utf8mb4_general_ci NOT NULL,
+		entity_id int(11) NOT NULL,
+		team_id int(11) NOT NULL DEFAULT 0,
+		deleted datetime(6) NOT NULL,
+		seq bigint NOT NULL DEFAULT 0,
+		PRIMARY KEY (id),
+		KEY deleted (deleted),
+		KEY seq (seq)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+	CREATE TABLE sync_sequence (
+		id tinyint NOT NULL,
+		seq bigint NOT NULL,
+		PRIMARY KEY (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+	INSERT INTO sync_sequence (id, seq) VALUES (1, 1);
+
+	CREATE TABLE idempotency_keys (
+		idempotency_key varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		path varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		status int(3) NOT NULL DEFAULT 0,
+		response mediumblob,
+		created datetime NOT NULL,
+		PRIMARY KEY (idempotency_key),
+		KEY created (created)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+	CREATE TABLE boards (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		code varchar(45) COLLATE utf8mb4_general_ci NOT NULL,
+		name varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		lat double NOT NULL DEFAULT 0,
+		lng double NOT NULL DEFAULT 0,
+		geohash char(12) CHARACTER SET ascii COLLATE ascii_bin DEFAULT NULL,
+		size varchar(45) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		facing varchar(45) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		type varchar(20) COLLATE utf8mb4_general_ci NOT NULL DEFAULT 'static',
+		owner varchar(255) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		zone_id int(11) NOT NULL DEFAULT 0,
+		created datetime NOT NULL,
+		updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00',
+		seq bigint NOT NULL DEFAULT 0,
+		PRIMARY KEY (id),
+		UNIQUE KEY code (code),
+		KEY zone_id (zone_id),
+		KEY updated (updated),
+		KEY seq (seq),
+		KEY geohash (geohash)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+	CREATE TABLE checklists (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		name varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		zone_id int(11) NOT NULL DEFAULT 0,
+		board_type varchar(20) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		created datetime NOT NULL,
+		updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00',
+		PRIMARY KEY (id),
+		UNIQUE KEY zone_board_type (zone_id, board_type)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+	CREATE TABLE checklist_slots (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		checklist_id int(11) NOT NULL,
+		position int(5) NOT NULL DEFAULT 0,
+		code varchar(30) COLLATE utf8mb4_general_ci NOT NULL,
+		name varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		lit tinyint(1) NOT NULL DEFAULT 0,
+		PRIMARY KEY (id),
+		UNIQUE KEY checklist_code (checklist_id, code)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 	`)
 
 	if err != nil {
@@ -61,3 +220,161 @@ func (db *Database) CreateTable() error {
 
 	return err
 }
+
+// upgrades brings a database created by an older CreateTable up to date.
+// Statements are applied in order and must be safe to run more than once.
+var upgrades = []string{
+	`ALTER TABLE photos ADD COLUMN caption varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' AFTER location`,
+	`ALTER TABLE worksheets ADD FULLTEXT KEY ft_worksheets (number, name)`,
+	`ALTER TABLE zones ADD FULLTEXT KEY ft_zones (name)`,
+	`ALTER TABLE teams ADD FULLTEXT KEY ft_teams (name)`,
+	`ALTER TABLE photos ADD FULLTEXT KEY ft_photos (location, caption)`,
+	`ALTER TABLE worksheets ADD COLUMN updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00', ADD KEY updated (updated)`,
+	`ALTER TABLE photos ADD COLUMN updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00', ADD KEY updated (updated)`,
+	`ALTER TABLE teams ADD COLUMN created datetime NOT NULL DEFAULT '1970-01-01 00:00:00', ADD COLUMN updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00', ADD KEY updated (updated)`,
+	`ALTER TABLE zones ADD COLUMN created datetime NOT NULL DEFAULT '1970-01-01 00:00:00', ADD COLUMN updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00', ADD KEY updated (updated)`,
+	`UPDATE worksheets SET updated = created WHERE updated = '1970-01-01 00:00:00'`,
+	`UPDATE photos SET updated = created WHERE updated = '1970-01-01 00:00:00'`,
+	`UPDATE teams SET created = UTC_TIMESTAMP(), updated = UTC_TIMESTAMP(6) WHERE updated = '1970-01-01 00:00:00'`,
+	`UPDATE zones SET created = UTC_TIMESTAMP(), updated = UTC_TIMESTAMP(6) WHERE updated = '1970-01-01 00:00:00'`,
+	`CREATE TABLE deletions (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		entity varchar(20) COLLATE utf8mb4_general_ci NOT NULL,
+		entity_id int(11) NOT NULL,
+		deleted datetime(6) NOT NULL,
+		PRIMARY KEY (id),
+		KEY deleted (deleted)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci`,
+	`ALTER TABLE photos ADD COLUMN uuid varchar(36) COLLATE utf8mb4_general_ci DEFAULT NULL, ADD UNIQUE KEY uuid (uuid)`,
+	`ALTER TABLE photos ADD COLUMN sha256 char(64) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '', ADD KEY worksheet_sha256 (worksheet_id, sha256)`,
+	`CREATE TABLE idempotency_keys (
+		idempotency_key varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		path varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		status int(3) NOT NULL DEFAULT 0,
+		response mediumblob,
+		created datetime NOT NULL,
+		PRIMARY KEY (idempotency_key),
+		KEY created (created)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci`,
+	`ALTER TABLE photos ADD COLUMN exif mediumblob`,
+	`CREATE TABLE boards (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		code varchar(45) COLLATE utf8mb4_general_ci NOT NULL,
+		name varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		lat double NOT NULL DEFAULT 0,
+		lng double NOT NULL DEFAULT 0,
+		size varchar(45) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		facing varchar(45) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		type varchar(20) COLLATE utf8mb4_general_ci NOT NULL DEFAULT 'static',
+		owner varchar(255) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		zone_id int(11) NOT NULL DEFAULT 0,
+		created datetime NOT NULL,
+		updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00',
+		PRIMARY KEY (id),
+		UNIQUE KEY code (code),
+		KEY zone_id (zone_id),
+		KEY updated (updated)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci`,
+	`ALTER TABLE worksheets ADD COLUMN board_id int(11) DEFAULT NULL AFTER zone_id, ADD KEY board_id (board_id)`,
+	`ALTER TABLE worksheets ADD COLUMN lat double DEFAULT NULL AFTER board_id, ADD COLUMN lng double DEFAULT NULL AFTER lat`,
+	`ALTER TABLE photos ADD COLUMN lat double DEFAULT NULL, ADD COLUMN lng double DEFAULT NULL,
+		ADD COLUMN geofence varchar(10) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '', ADD COLUMN distance double DEFAULT NULL,
+		ADD KEY worksheet_geofence (worksheet_id, geofence)`,
+	`ALTER TABLE zones ADD COLUMN boundary mediumtext AFTER name,
+		ADD COLUMN min_lat double DEFAULT NULL AFTER boundary, ADD COLUMN min_lng double DEFAULT NULL AFTER min_lat,
+		ADD COLUMN max_lat double DEFAULT NULL AFTER min_lng, ADD COLUMN max_lng double DEFAULT NULL AFTER max_lat,
+		ADD KEY bounds (min_lat, max_lat, min_lng, max_lng)`,
+	`ALTER TABLE worksheets ADD COLUMN geohash char(12) CHARACTER SET ascii COLLATE ascii_bin DEFAULT NULL AFTER lng, ADD KEY geohash (geohash)`,
+	`ALTER TABLE boards ADD COLUMN geohash char(12) CHARACTER SET ascii COLLATE ascii_bin DEFAULT NULL AFTER lng, ADD KEY geohash (geohash)`,
+	`ALTER TABLE photos ADD COLUMN geohash char(12) CHARACTER SET ascii COLLATE ascii_bin DEFAULT NULL AFTER lng, ADD KEY geohash (geohash)`,
+	`ALTER TABLE worksheets ADD COLUMN campaign varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' AFTER name, ADD KEY campaign (campaign)`,
+	`ALTER TABLE photos ADD COLUMN qr_worksheet_id int(11) DEFAULT NULL AFTER distance, ADD KEY qr_worksheet_id (qr_worksheet_id)`,
+	`ALTER TABLE worksheets ADD COLUMN status varchar(20) COLLATE utf8mb4_general_ci NOT NULL DEFAULT 'draft' AFTER geohash, ADD KEY status (status)`,
+	// Users from before roles keep doing everything they could.
+	`ALTER TABLE users ADD COLUMN role varchar(20) COLLATE utf8mb4_general_ci NOT NULL DEFAULT 'admin' AFTER password`,
+	`ALTER TABLE users ALTER COLUMN role SET DEFAULT 'inspector'`,
+	`CREATE TABLE worksheet_status_changes (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		worksheet_id int(11) NOT NULL,
+		from_status varchar(20) COLLATE utf8mb4_general_ci NOT NULL,
+		to_status varchar(20) COLLATE utf8mb4_general_ci NOT NULL,
+		user_id int(11) NOT NULL,
+		reason varchar(255) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		created datetime NOT NULL,
+		PRIMARY KEY (id),
+		KEY worksheet_id (worksheet_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci`,
+	`ALTER TABLE photos ADD COLUMN user_id int(11) DEFAULT NULL AFTER qr_worksheet_id,
+		ADD COLUMN review varchar(10) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' AFTER user_id,
+		ADD COLUMN review_reason varchar(30) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' AFTER review,
+		ADD COLUMN review_note varchar(255) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' AFTER review_reason,
+		ADD COLUMN reviewer_id int(11) DEFAULT NULL AFTER review_note,
+		ADD COLUMN reviewed datetime DEFAULT NULL AFTER reviewer_id,
+		ADD KEY review (review), ADD KEY user_review (user_id, review)`,
+	`CREATE TABLE checklists (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		name varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		zone_id int(11) NOT NULL DEFAULT 0,
+		board_type varchar(20) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '',
+		created datetime NOT NULL,
+		updated datetime(6) NOT NULL DEFAULT '1970-01-01 00:00:00',
+		PRIMARY KEY (id),
+		UNIQUE KEY zone_board_type (zone_id, board_type)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci`,
+	`CREATE TABLE checklist_slots (
+		id int(11) NOT NULL AUTO_INCREMENT,
+		checklist_id int(11) NOT NULL,
+		position int(5) NOT NULL DEFAULT 0,
+		code varchar(30) COLLATE utf8mb4_general_ci NOT NULL,
+		name varchar(255) COLLATE utf8mb4_general_ci NOT NULL,
+		lit tinyint(1) NOT NULL DEFAULT 0,
+		PRIMARY KEY (id),
+		UNIQUE KEY checklist_code (checklist_id, code)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci`,
+	`ALTER TABLE photos ADD COLUMN slot varchar(30) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' AFTER reviewed,
+		ADD KEY worksheet_slot (worksheet_id, slot)`,
+	// Sync follows a sequence of changes. Rows from before it are all
+	// the first change, so a full sync gets them.
+	`CREATE TABLE sync_sequence (
+		id tinyint NOT NULL,
+		seq bigint NOT NULL,
+		PRIMARY KEY (id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci`,
+	`INSERT IGNORE INTO sync_sequence (id, seq) VALUES (1, 1)`,
+	`ALTER TABLE worksheets ADD COLUMN seq bigint NOT NULL DEFAULT 0 AFTER updated, ADD KEY seq (seq)`,
+	`ALTER TABLE photos ADD COLUMN seq bigint NOT NULL DEFAULT 0 AFTER slot, ADD KEY seq (seq)`,
+	`ALTER TABLE teams ADD COLUMN seq bigint NOT NULL DEFAULT 0 AFTER updated, ADD KEY seq (seq)`,
+	`ALTER TABLE zones ADD COLUMN seq bigint NOT NULL DEFAULT 0 AFTER updated, ADD KEY seq (seq)`,
+	`ALTER TABLE boards ADD COLUMN seq bigint NOT NULL DEFAULT 0 AFTER updated, ADD KEY seq (seq)`,
+	`ALTER TABLE deletions ADD COLUMN team_id int(11) NOT NULL DEFAULT 0 AFTER entity_id,
+		ADD COLUMN seq bigint NOT NULL DEFAULT 0 AFTER deleted, ADD KEY seq (seq)`,
+	`UPDATE worksheets SET seq = 1 WHERE seq = 0`,
+	`UPDATE photos SET seq = 1 WHERE seq = 0`,
+	`UPDATE teams SET seq = 1 WHERE seq = 0`,
+	`UPDATE zones SET seq = 1 WHERE seq = 0`,
+	`UPDATE boards SET seq = 1 WHERE seq = 0`,
+	`UPDATE deletions SET seq = 1 WHERE seq = 0`,
+	`ALTER TABLE users ADD COLUMN team_id int(11) DEFAULT NULL AFTER role`,
+}
+
+func (db *Database) UpgradeTable() error {
+	for _, stmt := range upgrades {
+		_, err := db.Exec(stmt)
+		if err != nil && !alreadyApplied(err) {
+			return err
+		}
+	}
+	return db.indexGeohashes()
+}
+
+// alreadyApplied reports whether err means the upgrade statement has been
+// run before (duplicate column, key or table).
+func alreadyApplied(err error) bool {
+	if e, ok := err.(*mysql.MySQLError); ok {
+		switch e.Number {
+		case 1050, 1060, 1061, 1091:
+			return true
+		}
+	}
+	return false
+}
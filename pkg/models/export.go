@@ -0,0 +1,213 @@
+package models
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+)
+
+// LocalZone is the time zone of the pages and exports, and of the cameras
+// whose EXIF times say none.
+var LocalZone = time.FixedZone("UTC+7", 7*60*60)
+
+// localDay returns the UTC times a date, YYYY-MM-DD in LocalZone, starts
+// and ends at, as the database compares them.
+func localDay(date string) (string, string, error) {
+	start, err := time.ParseInLocation("2006-01-02", date, LocalZone)
+	if err != nil {
+		return "", "", err
+	}
+	return start.UTC().Format(keyTime), start.AddDate(0, 0, 1).UTC().Format(keyTime), nil
+}
+
+// TakenPhoto is a photo with its worksheet and the time it was taken, in
+// UTC like the times of the database.
+type TakenPhoto struct {
+	Photo     *Photo
+	Worksheet *Worksheet
+	Taken     time.Time
+}
+
+// worksheetFilter returns the conditions on worksheets w selecting f.
+func worksheetFilter(f *forms.PhotoFilter) (string, []interface{}) {
+	stmt := ""
+	params := []interface{}{}
+	if f.WorksheetID != 0 {
+		stmt += " AND w.id = ?"
+		params = append(params, f.WorksheetID)
+	}
+	if f.Date != "" {
+		stmt += " AND date_format(w.created, '%Y-%m-%d') = ?"
+		params = append(params, f.Date)
+	}
+	if f.ZoneID != 0 {
+		stmt += " AND w.zone_id = ?"
+		params = append(params, f.ZoneID)
+	}
+	if f.TeamID != 0 {
+		stmt += " AND w.team_id = ?"
+		params = append(params, f.TeamID)
+	}
+	return stmt, params
+}
+
+// ListLocatedPhotos returns the photos with a GPS position selected by f,
+// by worksheet and running number.
+func (db *Database) ListLocatedPhotos(f *forms.PhotoFilter) ([]*TakenPhoto, error) {
+	return db.listTakenPhotos(f, true)
+}
+
+// ListTakenPhotos returns the photos selected by f, by worksheet and
+// running number.
+func (db *Database) ListTakenPhotos(f *forms.PhotoFilter) ([]*TakenPhoto, error) {
+	return db.listTakenPhotos(f, false)
+}
+
+// listTakenPhotos returns the photos selected by f, only those with a GPS
+// position when located is set. The time taken comes from the EXIF data
+// kept for the photo, else the upload time.
+func (db *Database) listTakenPhotos(f *forms.PhotoFilter, located bool) ([]*TakenPhoto, error) {
+	where, params := worksheetFilter(f)
+
+	rows, err := db.Query(`SELECT w.id, w.number, w.name, w.created, z.id, z.name, t.id, t.name
+	FROM worksheets w
+	INNER JOIN zones z on (w.zone_id = z.id)
+	INNER JOIN teams t on (w.team_id = t.id)
+	WHERE 1 = 1`+where, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	worksheets := map[int]*Worksheet{}
+	for rows.Next() {
+		p := &Worksheet{}
+		err = rows.Scan(&p.ID, &p.Number, &p.Name, &p.Created, &p.ZoneID, &p.ZoneName, &p.TeamID, &p.TeamName)
+		if err != nil {
+			return nil, err
+		}
+		worksheets[p.ID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt := `SELECT ` + photoColumns + `, exif FROM photos WHERE worksheet_id IN (
+		SELECT w.id FROM worksheets w WHERE 1 = 1` + where + `)`
+	if located {
+		stmt += ` AND lat IS NOT NULL`
+	}
+	rows, err = db.Query(stmt+` ORDER BY worksheet_id, running_number`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []*TakenPhoto{}
+	for rows.Next() {
+		var raw []byte
+		f, err := scanPhoto(scanWith{rows, []interface{}{&raw}})
+		if err != nil {
+			return nil, err
+		}
+		worksheet := worksheets[f.WorksheetID]
+		if worksheet == nil {
+			continue
+		}
+		photos = append(photos, &TakenPhoto{
+			Photo:     f,
+			Worksheet: worksheet,
+			Taken:     exifTime(raw, f.Created),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// scanWith scans extra columns after those of a row scanner.
+type scanWith struct {
+	row   interface{ Scan(...interface{}) error }
+	extra []interface{}
+}
+
+func (s scanWith) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// exifTime returns when the photo with raw EXIF data was taken, in UTC, or
+// def. EXIF times are the wall clock of the camera and rarely say its zone;
+// without one the camera is taken to be set to LocalZone.
+func exifTime(raw []byte, def time.Time) time.Time {
+	if len(raw) == 0 {
+		return def
+	}
+	x, err := exif.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return def
+	}
+	t, err := x.DateTime()
+	if err != nil {
+		return def
+	}
+	if _, err := x.TimeZone(); err != nil {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, LocalZone)
+	}
+	return t.UTC()
+}
+
+// WorksheetSummary is a worksheet with its photos counted by geofence
+// result and its first photo that is not a video, if any.
+type WorksheetSummary struct {
+	Worksheet  *Worksheet
+	Compliance Compliance
+	Photo      *Photo
+}
+
+// EachWorksheetSummary calls fn with the summary of each worksheet selected
+// by f, newest first. Summaries are passed on as they are read, so any
+// number of worksheets can be exported; an error from fn stops the loop.
+func (db *Database) EachWorksheetSummary(f *forms.PhotoFilter, fn func(*WorksheetSummary) error) error {
+	where, params := worksheetFilter(f)
+
+	rows, err := db.Query(`SELECT `+worksheetColumns+`,
+	IFNULL(c.total, 0), IFNULL(c.n_within, 0), IFNULL(c.n_outside, 0), IFNULL(c.n_missing, 0),
+	IFNULL(fp.id, 0), IFNULL(fp.running_number, 0), IFNULL(fp.filename, '')`+worksheetFrom+`
+	LEFT JOIN (SELECT worksheet_id, count(id) total,
+		SUM(geofence = 'within') n_within, SUM(geofence = 'outside') n_outside, SUM(geofence = 'missing') n_missing
+		FROM photos GROUP BY worksheet_id) c ON (c.worksheet_id = w.id)
+	LEFT JOIN photos fp ON (fp.id = (SELECT p.id FROM photos p
+		WHERE p.worksheet_id = w.id AND p.filename NOT LIKE '%.mp4'
+		ORDER BY p.running_number, p.id LIMIT 1))
+	WHERE 1 = 1`+where+`
+	ORDER BY w.created DESC, w.id DESC`, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := &WorksheetSummary{}
+		photo := &Photo{}
+		c := &s.Compliance
+		s.Worksheet, err = scanWorksheet(scanWith{rows, []interface{}{
+			&c.Total, &c.Within, &c.Outside, &c.Missing,
+			&photo.ID, &photo.RunningNumber, &photo.FileName,
+		}})
+		if err != nil {
+			return err
+		}
+		c.Unchecked = c.Total - c.Within - c.Outside - c.Missing
+		if photo.ID != 0 {
+			photo.WorksheetID = s.Worksheet.ID
+			s.Photo = photo
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"math"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/mknote"
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
+)
+
+// Geofence results of a photo. A photo of a worksheet without expected
+// coordinates is not checked and has an empty result.
+const (
+	GeofenceWithin  = "within"
+	GeofenceOutside = "outside"
+	GeofenceMissing = "missing"
+)
+
+// Distance returns the great-circle distance to o in metres.
+func (l *Location) Distance(o *Location) float64 {
+	return geo.Distance(geo.Point{l.Lng, l.Lat}, geo.Point{o.Lng, o.Lat})
+}
+
+// CheckGeofence sets the geofence result and distance of the photo against
+// the expected location and the radius in metres.
+func (f *Photo) CheckGeofence(expected *Location, radius float64) {
+	f.Distance = nil
+	switch {
+	case f.GPS == nil:
+		f.Geofence = GeofenceMissing
+	case expected == nil:
+		f.Geofence = ""
+	default:
+		d := expected.Distance(f.GPS)
+		f.Distance = &d
+		if d <= radius {
+			f.Geofence = GeofenceWithin
+		} else {
+			f.Geofence = GeofenceOutside
+		}
+	}
+}
+
+// ExifLocation returns the GPS position in raw EXIF data, or nil if it has
+// none.
+func ExifLocation(raw []byte) *Location {
+	if len(raw) == 0 {
+		return nil
+	}
+	x, err := exif.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	return exifLocation(x)
+}
+
+func exifLocation(x *exif.Exif) *Location {
+	lat, lng, err := x.LatLong()
+	if err != nil || math.IsNaN(lat) || math.IsNaN(lng) || (lat == 0 && lng == 0) {
+		return nil
+	}
+	return &Location{lat, lng}
+}
+
+func nullLocation(lat, lng sql.NullFloat64) *Location {
+	if !lat.Valid || !lng.Valid {
+		return nil
+	}
+	return &Location{lat.Float64, lng.Float64}
+}
+
+func nullFloat(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+// ExpectedLocation returns where the photos of a worksheet should be taken:
+// the worksheet's own coordinates, else those of its board, else nil.
+func (db *Database) ExpectedLocation(worksheetID int) (*Location, error) {
+	var lat, lng sql.NullFloat64
+	err := db.QueryRow(`SELECT
+	IFNULL(w.lat, IF(b.lat = 0 AND b.lng = 0, NULL, b.lat)),
+	IFNULL(w.lng, IF(b.lat = 0 AND b.lng = 0, NULL, b.lng))
+	FROM worksheets w LEFT JOIN boards b on (w.board_id = b.id)
+	WHERE w.id = ?`, worksheetID).Scan(&lat, &lng)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return nullLocation(lat, lng), nil
+}
+
+// RecheckGeofence checks the photos of a worksheet again, after its expected
+// location or the radius changed. Only photos whose result changes are
+// updated.
+func (db *Database) RecheckGeofence(worksheetID int, radius float64) error {
+	expected, err := db.ExpectedLocation(worksheetID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT id, lat, lng, geofence, distance FROM photos WHERE worksheet_id = ?`, worksheetID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	changed := Photos{}
+	for rows.Next() {
+		f := &Photo{}
+		var lat, lng, distance sql.NullFloat64
+		err = rows.Scan(&f.ID, &lat, &lng, &f.Geofence, &distance)
+		if err != nil {
+			return err
+		}
+		f.GPS = nullLocation(lat, lng)
+
+		geofence := f.Geofence
+		f.CheckGeofence(expected, radius)
+		if f.Geofence != geofence || distance.Valid != (f.Distance != nil) ||
+			(f.Distance != nil && math.Abs(*f.Distance-distance.Float64) > 0.01) {
+			changed = append(changed, f)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, f := range changed {
+		_, err := db.execChange(`UPDATE photos SET geofence = ?, distance = ?, updated = UTC_TIMESTAMP(6), seq = `+changeSeq+` WHERE id = ?`,
+			f.Geofence, nullFloat(f.Distance), f.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecheckBoardGeofence rechecks every worksheet of a board.
+func (db *Database) RecheckBoardGeofence(boardID int, radius float64) error {
+	rows, err := db.Query(`SELECT id FROM worksheets WHERE board_id = ?`, boardID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := db.RecheckGeofence(id, radius); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillGeofence reads the GPS position of photos stored before it was
+// captured at upload, then rechecks every worksheet. It returns how many
+// photos got a position.
+func (db *Database) BackfillGeofence(storeDir string, radius float64) (int, error) {
+	rows, err := db.Query(`SELECT id, worksheet_id, filename, exif FROM photos WHERE lat IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	photos := Photos{}
+	for rows.Next() {
+		f := &Photo{}
+		err = rows.Scan(&f.ID, &f.WorksheetID, &f.FileName, &f.Exif)
+		if err != nil {
+			return 0, err
+		}
+		photos = append(photos, f)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	exif.RegisterParsers(mknote.All...)
+	n := 0
+	for _, f := range photos {
+		x, err := photoExif(f, storeDir)
+		if err != nil {
+			continue
+		}
+		gps := exifLocation(x)
+		if gps == nil {
+			continue
+		}
+		_, err = db.execChange(`UPDATE photos SET lat = ?, lng = ?, geohash = ?, updated = UTC_TIMESTAMP(6), seq = `+changeSeq+` WHERE id = ?`,
+			gps.Lat, gps.Lng, geohash(gps), f.ID)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	ids := []int{}
+	rows, err = db.Query(`SELECT id FROM worksheets`)
+	if err != nil {
+		return n, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return n, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	for _, id := range ids {
+		if err := db.RecheckGeofence(id, radius); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Compliance counts the photos of a worksheet by geofence result.
+type Compliance struct {
+	Total     int `json:"total"`
+	Within    int `json:"within"`
+	Outside   int `json:"outside"`
+	Missing   int `json:"missing"`
+	Unchecked int `json:"unchecked"`
+}
+
+func (db *Database) GetCompliance(worksheetID int) (*Compliance, error) {
+	rows, err := db.Query(`SELECT geofence, count(id) FROM photos WHERE worksheet_id = ? GROUP BY geofence`, worksheetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c := &Compliance{}
+	for rows.Next() {
+		var geofence string
+		var n int
+		err = rows.Scan(&geofence, &n)
+		if err != nil {
+			return nil, err
+		}
+		c.Total += n
+		switch geofence {
+		case GeofenceWithin:
+			c.Within += n
+		case GeofenceOutside:
+			c.Outside += n
+		case GeofenceMissing:
+			c.Missing += n
+		default:
+			c.Unchecked += n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	ErrIdempotencyKeyInUse    = errors.New("models: a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyMismatch = errors.New("models: idempotency key was used for a different request")
+)
+
+// IdempotentResponse is the stored result of a request made with an
+// Idempotency-Key header.
+type IdempotentResponse struct {
+	Status   int
+	Response []byte
+}
+
+// ReserveIdempotencyKey claims key for a request to path. It returns nil
+// when the caller should process the request, or the stored response of
+// an earlier request with the same key made within ttl. Keys older than
+// ttl are forgotten.
+func (db *Database) ReserveIdempotencyKey(key, path string, ttl time.Duration) (*IdempotentResponse, error) {
+	_, err := db.Exec(`DELETE FROM idempotency_keys WHERE created < UTC_TIMESTAMP() - INTERVAL ? SECOND`, int(ttl.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`INSERT INTO idempotency_keys (idempotency_key, path, created) VALUES (?, ?, UTC_TIMESTAMP())`, key, path)
+	if err == nil {
+		return nil, nil
+	}
+	if e, ok := err.(*mysql.MySQLError); !ok || e.Number != 1062 {
+		return nil, err
+	}
+
+	var storedPath string
+	stored := &IdempotentResponse{}
+	err = db.QueryRow(`SELECT path, status, response FROM idempotency_keys WHERE idempotency_key = ?`, key).
+		Scan(&storedPath, &stored.Status, &stored.Response)
+	if err == sql.ErrNoRows {
+		// Expired between the insert and the select; try once more.
+		return db.ReserveIdempotencyKey(key, path, ttl)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if storedPath != path {
+		return nil, ErrIdempotencyKeyMismatch
+	}
+	if stored.Status == 0 {
+		return nil, ErrIdempotencyKeyInUse
+	}
+	return stored, nil
+}
+
+func (db *Database) SaveIdempotentResponse(key string, status int, response []byte) error {
+	_, err := db.Exec(`UPDATE idempotency_keys SET status = ?, response = ? WHERE idempotency_key = ?`, status, response, key)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a reserved key after a failed request so
+// the client can retry it.
+func (db *Database) ReleaseIdempotencyKey(key string) error {
+	_, err := db.Exec(`DELETE FROM idempotency_keys WHERE idempotency_key = ?`, key)
+	return err
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+)
+
+// WorksheetCSVColumns are the columns a worksheet CSV may have, in any
+// order. number, name and team are required; a worksheet without a zone is
+// put in the zone whose boundary contains its location or board.
+var WorksheetCSVColumns = []string{"number", "name", "campaign", "zone", "team", "board", "lat", "lng"}
+
+// WorksheetImport is a row of a worksheet CSV and the outcome of importing
+// it. Rows with Errors are not imported.
+type WorksheetImport struct {
+	Line     int       `json:"line"`
+	Number   string    `json:"number"`
+	Name     string    `json:"name"`
+	Campaign string    `json:"campaign"`
+	Zone     string    `json:"zone"`
+	Team     string    `json:"team"`
+	Board    string    `json:"board"`
+	Location *Location `json:"location"`
+
+	WorksheetID int      `json:"worksheetID"`
+	ZoneID      int      `json:"zoneID"`
+	TeamID      int      `json:"teamID"`
+	BoardID     int      `json:"boardID"`
+	NewZone     bool     `json:"newZone"`
+	NewTeam     bool     `json:"newTeam"`
+	Errors      []string `json:"errors"`
+}
+
+func (row *WorksheetImport) fail(format string, args ...interface{}) {
+	row.Errors = append(row.Errors, fmt.Sprintf(format, args...))
+}
+
+type WorksheetImports []*WorksheetImport
+
+// Failed counts the rows with errors.
+func (rows WorksheetImports) Failed() int {
+	n := 0
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// ReadWorksheetCSV reads the worksheets of a CSV file whose first row
+// names its columns out of WorksheetCSVColumns. Values that cannot be read
+// are reported as errors of their row; an error is only returned when the
+// file itself is unusable.
+func ReadWorksheetCSV(r io.Reader) (WorksheetImports, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		known := false
+		for _, c := range WorksheetCSVColumns {
+			known = known || c == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q, columns are %s", name, strings.Join(WorksheetCSVColumns, ", "))
+		}
+		index[name] = i
+	}
+	for _, name := range []string{"number", "name", "team"} {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("the %s column is missing", name)
+		}
+	}
+
+	rows := WorksheetImports{}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := &WorksheetImport{
+			Line:     line,
+			Number:   field("number"),
+			Name:     field("name"),
+			Campaign: field("campaign"),
+			Zone:     field("zone"),
+			Team:     field("team"),
+			Board:    field("board"),
+		}
+		f := &forms.Worksheet{Lat: field("lat"), Lng: field("lng")}
+		lat, lng, ok, err := f.Coordinates()
+		if err != nil {
+			row.fail("%s", err)
+		} else if ok {
+			row.Location = &Location{lat, lng}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ImportWorksheets checks every row and, unless dryRun is set or a row
+// failed, inserts them all in one transaction. Zones and teams named by no
+// existing one are created when create is set and fail their rows
+// otherwise. Boards must exist, and numbers must be new and unique.
+func (db *Database) ImportWorksheets(rows WorksheetImports, create, dryRun bool) error {
+	zones, err := db.ListZones()
+	if err != nil {
+		return err
+	}
+	zoneIDs := map[string]int{}
+	for _, zone := range zones {
+		if _, ok := zoneIDs[strings.ToLower(zone.Name)]; !ok {
+			zoneIDs[strings.ToLower(zone.Name)] = zone.ID
+		}
+	}
+	teams, err := db.ListTeams()
+	if err != nil {
+		return err
+	}
+	teamIDs := map[string]int{}
+	for _, team := range teams {
+		if _, ok := teamIDs[strings.ToLower(team.Name)]; !ok {
+			teamIDs[strings.ToLower(team.Name)] = team.ID
+		}
+	}
+
+	numbers := map[string]int{}
+	for _, row := range rows {
+		if err := db.checkWorksheetImport(row, numbers, zoneIDs, teamIDs, create); err != nil {
+			return err
+		}
+	}
+	if dryRun || rows.Failed() > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := takeChange(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	newZones := map[string]int{}
+	newTeams := map[string]int{}
+	for _, row := range rows {
+		if row.NewZone {
+			key := strings.ToLower(row.Zone)
+			if _, ok := newZones[key]; !ok {
+				zone := &Zone{Name: row.Zone}
+				if err := insertZone(tx, zone); err != nil {
+					tx.Rollback()
+					return err
+				}
+				newZones[key] = zone.ID
+			}
+			row.ZoneID = newZones[key]
+		}
+		if row.NewTeam {
+			key := strings.ToLower(row.Team)
+			if _, ok := newTeams[key]; !ok {
+				team := &Team{Name: row.Team}
+				if err := insertTeam(tx, team); err != nil {
+					tx.Rollback()
+					return err
+				}
+				newTeams[key] = team.ID
+			}
+			row.TeamID = newTeams[key]
+		}
+
+		worksheet := &Worksheet{
+			Number:   row.Number,
+			Name:     row.Name,
+			Campaign: row.Campaign,
+			ZoneID:   row.ZoneID,
+			TeamID:   row.TeamID,
+			BoardID:  row.BoardID,
+			Location: row.Location,
+		}
+		if err := insertWorksheet(tx, worksheet); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("line %d: %s", row.Line, err)
+		}
+		row.WorksheetID = worksheet.ID
+	}
+	return tx.Commit()
+}
+
+// checkWorksheetImport resolves the zone, team and board of a row and adds
+// its problems to its errors. numbers holds the line of each number seen.
+func (db *Database) checkWorksheetImport(row *WorksheetImport, numbers map[string]int, zoneIDs, teamIDs map[string]int, create bool) error {
+	switch {
+	case row.Number == "":
+		row.fail("number is missing")
+	case len([]rune(row.Number)) > 45:
+		row.fail("number is longer than 45 characters")
+	case numbers[strings.ToLower(row.Number)] != 0:
+		row.fail("number %s is also on line %d", row.Number, numbers[strings.ToLower(row.Number)])
+	default:
+		numbers[strings.ToLower(row.Number)] = row.Line
+		var n int
+		if err := db.QueryRow(`SELECT count(id) FROM worksheets WHERE number = ?`, row.Number).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			row.fail("worksheet %s already exists", row.Number)
+		}
+	}
+	if row.Name == "" {
+		row.fail("name is missing")
+	}
+
+	if row.Board != "" {
+		board, err := scanBoard(db.QueryRow("SELECT "+boardColumns+boardFrom+" WHERE b.code = ?", row.Board))
+		if err != nil {
+			return err
+		}
+		if board == nil {
+			row.fail("no board has code %s", row.Board)
+		} else {
+			row.BoardID = board.ID
+		}
+	}
+
+	if row.Team == "" {
+		row.fail("team is missing")
+	} else if id, ok := teamIDs[strings.ToLower(row.Team)]; ok {
+		row.TeamID = id
+	} else if create {
+		row.NewTeam = true
+	} else {
+		row.fail("no team is named %s", row.Team)
+	}
+
+	if row.Zone != "" {
+		if id, ok := zoneIDs[strings.ToLower(row.Zone)]; ok {
+			row.ZoneID = id
+		} else if create {
+			row.NewZone = true
+		} else {
+			row.fail("no zone is named %s", row.Zone)
+		}
+		return nil
+	}
+	zone, err := db.LocateZone(row.Location, row.BoardID)
+	if err != nil {
+		return err
+	}
+	if zone == nil {
+		row.fail("zone is missing and no zone boundary contains the worksheet")
+	} else {
+		row.ZoneID = zone.ID
+		row.Zone = zone.Name
+	}
+	return nil
+}
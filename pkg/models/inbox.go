@@ -0,0 +1,126 @@
+package models
+
+import "database/sql"
+
+// InboxWorksheetID is the worksheet of photos uploaded without one whose
+// QR code, if any, names no worksheet. They wait in the inbox until they
+// are assigned by hand.
+const InboxWorksheetID = 0
+
+// ListInboxPhotos returns the photos waiting in the inbox, oldest first.
+func (db *Database) ListInboxPhotos() (Photos, error) {
+	rows, err := db.Query(`SELECT `+photoColumns+` FROM photos WHERE worksheet_id = ? ORDER BY id`, InboxWorksheetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := Photos{}
+	for rows.Next() {
+		f, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// QRMismatch is a photo filed under another worksheet than the one its QR
+// code names.
+type QRMismatch struct {
+	Photo       *Photo
+	Worksheet   *Worksheet
+	QRWorksheet *Worksheet
+}
+
+// ListQRMismatches returns the photos whose QR code names another
+// worksheet than theirs, newest first. A zero worksheetID lists them for
+// every worksheet.
+func (db *Database) ListQRMismatches(worksheetID int) ([]*QRMismatch, error) {
+	stmt := `SELECT ` + photoColumns + ` FROM photos
+	WHERE worksheet_id <> ? AND qr_worksheet_id <> worksheet_id`
+	params := []interface{}{InboxWorksheetID}
+	if worksheetID != 0 {
+		stmt += " AND worksheet_id = ?"
+		params = append(params, worksheetID)
+	}
+	rows, err := db.Query(stmt+" ORDER BY id DESC", params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := Photos{}
+	for rows.Next() {
+		f, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	worksheets := map[int]*Worksheet{}
+	worksheet := func(id int) (*Worksheet, error) {
+		if w, ok := worksheets[id]; ok {
+			return w, nil
+		}
+		w, err := db.GetWorksheet(id)
+		worksheets[id] = w
+		return w, err
+	}
+	mismatches := []*QRMismatch{}
+	for _, f := range photos {
+		m := &QRMismatch{Photo: f}
+		if m.Worksheet, err = worksheet(f.WorksheetID); err != nil {
+			return nil, err
+		}
+		if m.QRWorksheet, err = worksheet(f.QRWorksheetID); err != nil {
+			return nil, err
+		}
+		// The worksheet named may have been deleted since.
+		if m.Worksheet != nil && m.QRWorksheet != nil {
+			mismatches = append(mismatches, m)
+		}
+	}
+	return mismatches, nil
+}
+
+// MovePhoto files a photo under another worksheet with a new file name and
+// checklist slot, numbering it after the last photo there. The sync
+// clients of the team of the worksheet it leaves drop it. It returns
+// ErrWorksheetApproved when either worksheet is approved.
+func (db *Database) MovePhoto(photoID, worksheetID int, fileName, slot string) error {
+	return db.change(func(tx *sql.Tx) error {
+		var from int
+		err := tx.QueryRow(`SELECT worksheet_id FROM photos WHERE id = ? FOR UPDATE`, photoID).Scan(&from)
+		if err != nil {
+			return err
+		}
+		if err := lockAcceptsPhotos(tx, from); err != nil {
+			return err
+		}
+		if err := lockAcceptsPhotos(tx, worksheetID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO deletions (entity, entity_id, team_id, deleted, seq)
+		SELECT ?, p.id, w.team_id, UTC_TIMESTAMP(6), `+changeSeq+` FROM photos p INNER JOIN worksheets w ON (p.worksheet_id = w.id)
+		WHERE p.id = ?`, EntityPhotos, photoID)
+		if err != nil {
+			return err
+		}
+		next, err := nextRunningNumber(tx, worksheetID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE photos SET worksheet_id = ?, running_number = ?, filename = ?, slot = ?, updated = UTC_TIMESTAMP(6), seq = `+changeSeq+` WHERE id = ?`,
+			worksheetID, next, fileName, slot, photoID)
+		return err
+	})
+}
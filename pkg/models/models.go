@@ -3,42 +3,114 @@ package models
 import (
 	"strconv"
 	"time"
+
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
 )
 
 type Worksheet struct {
-	ID       int    `json:"id"`
-	Number   string `json:"number"`
-	Name     string `json:"name"`
-	ZoneID   int
-	ZoneName string
-	TeamID   int
-	TeamName string
-	Created  time.Time `json:"created"`
+	ID        int    `json:"id"`
+	Number    string `json:"number"`
+	Name      string `json:"name"`
+	Campaign  string `json:"campaign"`
+	ZoneID    int
+	ZoneName  string
+	TeamID    int
+	TeamName  string
+	BoardID   int
+	BoardCode string
+	BoardName string
+	Status    string    `json:"status"`
+	Location  *Location `json:"location"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	// SlotsFilled of the SlotsRequired by its checklist have a photo. Only
+	// ListWorksheets sets them.
+	SlotsFilled   int `json:"-"`
+	SlotsRequired int `json:"-"`
 }
 
 type Worksheets []*Worksheet
 
 type Team struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"-"`
+	Updated time.Time `json:"-"`
 }
 
 type Teams []*Team
 
 type Zone struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID       int              `json:"id"`
+	Name     string           `json:"name"`
+	Boundary geo.MultiPolygon `json:"boundary,omitempty"`
+	Created  time.Time        `json:"-"`
+	Updated  time.Time        `json:"-"`
 }
 
 type Zones []*Zone
 
+// Board types.
+const (
+	BoardTypeStatic   = "static"
+	BoardTypeLED      = "led"
+	BoardTypeLightbox = "lightbox"
+)
+
+var BoardTypes = []string{BoardTypeStatic, BoardTypeLED, BoardTypeLightbox}
+
+// Board is a physical billboard that worksheets inspect.
+type Board struct {
+	ID       int       `json:"id"`
+	Code     string    `json:"code"`
+	Name     string    `json:"name"`
+	Lat      float64   `json:"lat"`
+	Lng      float64   `json:"lng"`
+	Size     string    `json:"size"`
+	Facing   string    `json:"facing"`
+	Type     string    `json:"type"`
+	Owner    string    `json:"owner"`
+	ZoneID   int       `json:"zoneID"`
+	ZoneName string    `json:"zoneName"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+type Boards []*Board
+
+// Inspection is one worksheet of a board with its photos.
+type Inspection struct {
+	Worksheet *Worksheet
+	Photos    Photos
+}
+
 type Photo struct {
 	ID            int
 	WorksheetID   int
 	RunningNumber int
 	FileName      string
 	Location      string
-	Created       time.Time
+	Caption       string
+	Slot          string
+	UUID          string
+	Hash          string
+	Exif          []byte
+	GPS           *Location
+	Geofence      string
+	Distance      *float64
+	// QRWorksheetID is the worksheet named by a QR code in the photo, or 0.
+	QRWorksheetID int
+	// UserID is the user who uploaded the photo, or 0 when unknown.
+	UserID int
+	// Review is ReviewPending, ReviewApproved or ReviewRejected, with the
+	// code of one of ReviewReasons and a note for rejections.
+	Review       string
+	ReviewReason string
+	ReviewNote   string
+	ReviewerID   int
+	Reviewed     time.Time
+	Created      time.Time
+	Updated      time.Time
 }
 
 type Photos []*Photo
@@ -47,6 +119,15 @@ func (f *Photo) FilePath() string {
 	return "/store/" + strconv.Itoa(f.WorksheetID) + "/" + f.FileName
 }
 
+// DistanceText returns the distance from the expected location, rounded to
+// metres, or "" if it is unknown.
+func (f *Photo) DistanceText() string {
+	if f.Distance == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f.Distance, 'f', 0, 64) + " m"
+}
+
 type FormField struct {
 	ID    int
 	Name  string
@@ -59,5 +140,3 @@ type Location struct {
 	Lat float64 `json:"lat"`
 	Lng float64 `json:"lng"`
 }
-
-type Locations []*Location
@@ -0,0 +1,245 @@
+package models
+
+import (
+	"sort"
+	"strings"
+
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
+)
+
+// geohash returns the geohash stored for a location, or nil to store NULL.
+func geohash(l *Location) interface{} {
+	if l == nil {
+		return nil
+	}
+	return geo.Geohash(l.Lat, l.Lng, geo.GeohashPrecision)
+}
+
+// location returns where the board stands, or nil if it has no
+// coordinates.
+func (b *Board) location() *Location {
+	if b.Lat == 0 && b.Lng == 0 {
+		return nil
+	}
+	return &Location{b.Lat, b.Lng}
+}
+
+// Area is a circle or bounding box to search. Results are sorted by their
+// distance from Center.
+type Area struct {
+	Center Location
+
+	// Radius is in metres, 0 for a bounding box.
+	Radius float64
+
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// AreaAround returns the circle of radius metres around center.
+func AreaAround(center Location, radius float64) *Area {
+	a := &Area{Center: center, Radius: radius}
+	a.MinLat, a.MinLng, a.MaxLat, a.MaxLng = geo.BoundsAround(center.Lat, center.Lng, radius)
+	return a
+}
+
+// AreaWithin returns a bounding box, centred on its middle.
+func AreaWithin(minLat, minLng, maxLat, maxLng float64) *Area {
+	return &Area{
+		Center: Location{(minLat + maxLat) / 2, (minLng + maxLng) / 2},
+		MinLat: minLat, MinLng: minLng, MaxLat: maxLat, MaxLng: maxLng,
+	}
+}
+
+// Contains reports whether l lies in the area.
+func (a *Area) Contains(l *Location) bool {
+	if l == nil || l.Lat < a.MinLat || l.Lat > a.MaxLat || l.Lng < a.MinLng || l.Lng > a.MaxLng {
+		return false
+	}
+	return a.Radius == 0 || a.Center.Distance(l) <= a.Radius
+}
+
+// where returns the conditions selecting rows of table alias t in the
+// bounding box of the area. The geohash prefixes let the index on geohash
+// narrow the rows down before the coordinates are compared.
+func (a *Area) where(t string) (string, []interface{}) {
+	stmt := t + ".lat BETWEEN ? AND ? AND " + t + ".lng BETWEEN ? AND ?"
+	params := []interface{}{a.MinLat, a.MaxLat, a.MinLng, a.MaxLng}
+
+	cells := geo.Cover(a.MinLat, a.MinLng, a.MaxLat, a.MaxLng)
+	if len(cells) == 0 {
+		return stmt, params
+	}
+	likes := []string{}
+	for _, cell := range cells {
+		likes = append(likes, t+".geohash LIKE ?")
+		params = append(params, cell+"%")
+	}
+	return "(" + strings.Join(likes, " OR ") + ") AND " + stmt, params
+}
+
+// NearbyWorksheet is a worksheet in an area. Location is that of the
+// worksheet, or of its board when it has none.
+type NearbyWorksheet struct {
+	Worksheet *Worksheet
+	Location  *Location
+	Distance  float64
+}
+
+// NearbyBoard is a board in an area.
+type NearbyBoard struct {
+	Board    *Board
+	Distance float64
+}
+
+// NearbyPhoto is a photo taken in an area.
+type NearbyPhoto struct {
+	Photo    *Photo
+	Distance float64
+}
+
+// NearbyWorksheets returns up to limit worksheets located in the area,
+// nearest first. Worksheets without a location of their own are found by
+// the location of their board.
+func (db *Database) NearbyWorksheets(a *Area, limit int) ([]*NearbyWorksheet, error) {
+	worksheets := []*NearbyWorksheet{}
+	seen := map[int]bool{}
+
+	where, params := a.where("w")
+	boardWhere, boardParams := a.where("b2")
+	queries := []struct {
+		stmt   string
+		params []interface{}
+	}{
+		{`SELECT ` + worksheetColumns + `, w.lat, w.lng` + worksheetFrom + ` WHERE ` + where, params},
+		{`SELECT ` + worksheetColumns + `, b.lat, b.lng` + worksheetFrom + ` WHERE w.lat IS NULL AND w.board_id IN (
+			SELECT b2.id FROM boards b2 WHERE ` + boardWhere + `)`, boardParams},
+	}
+	for _, q := range queries {
+		rows, err := db.Query(q.stmt, q.params...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			l := &Location{}
+			p, err := scanWorksheet(scanWith{rows, []interface{}{&l.Lat, &l.Lng}})
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if seen[p.ID] || !a.Contains(l) {
+				continue
+			}
+			seen[p.ID] = true
+			worksheets = append(worksheets, &NearbyWorksheet{p, l, a.Center.Distance(l)})
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(worksheets, func(i, j int) bool { return worksheets[i].Distance < worksheets[j].Distance })
+	if limit > -1 && len(worksheets) > limit {
+		worksheets = worksheets[:limit]
+	}
+	return worksheets, nil
+}
+
+// NearbyBoards returns up to limit boards in the area, nearest first.
+func (db *Database) NearbyBoards(a *Area, limit int) ([]*NearbyBoard, error) {
+	where, params := a.where("b")
+	rows, err := db.Query("SELECT "+boardColumns+boardFrom+" WHERE "+where, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	boards := []*NearbyBoard{}
+	for rows.Next() {
+		b, err := scanBoard(rows)
+		if err != nil {
+			return nil, err
+		}
+		if l := b.location(); a.Contains(l) {
+			boards = append(boards, &NearbyBoard{b, a.Center.Distance(l)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(boards, func(i, j int) bool { return boards[i].Distance < boards[j].Distance })
+	if limit > -1 && len(boards) > limit {
+		boards = boards[:limit]
+	}
+	return boards, nil
+}
+
+// NearbyPhotos returns up to limit photos taken in the area, nearest
+// first.
+func (db *Database) NearbyPhotos(a *Area, limit int) ([]*NearbyPhoto, error) {
+	where, params := a.where("p")
+	rows, err := db.Query(`SELECT `+photoColumns+` FROM photos p WHERE `+where, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []*NearbyPhoto{}
+	for rows.Next() {
+		f, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		if a.Contains(f.GPS) {
+			photos = append(photos, &NearbyPhoto{f, a.Center.Distance(f.GPS)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(photos, func(i, j int) bool { return photos[i].Distance < photos[j].Distance })
+	if limit > -1 && len(photos) > limit {
+		photos = photos[:limit]
+	}
+	return photos, nil
+}
+
+// indexGeohashes fills in the geohash of rows located before it was
+// stored.
+func (db *Database) indexGeohashes() error {
+	for _, table := range []string{"worksheets", "boards", "photos"} {
+		rows, err := db.Query(`SELECT id, lat, lng FROM ` + table + ` WHERE geohash IS NULL AND lat IS NOT NULL AND NOT (lat = 0 AND lng = 0)`)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id int
+			l  Location
+		}
+		located := []row{}
+		for rows.Next() {
+			var v row
+			if err := rows.Scan(&v.id, &v.l.Lat, &v.l.Lng); err != nil {
+				rows.Close()
+				return err
+			}
+			located = append(located, v)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, v := range located {
+			_, err := db.Exec(`UPDATE `+table+` SET geohash = ? WHERE id = ?`, geohash(&v.l), v.id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
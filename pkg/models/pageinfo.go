@@ -1,16 +1,115 @@
 package models
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"reflect"
+
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
 )
 
+var ErrInvalidCursor = errors.New("models: invalid page cursor")
+
+// keyTime is how cursors hold a datetime sort key, as MySQL compares it.
+const keyTime = "2006-01-02 15:04:05"
+
 type PageInfo struct {
 	TotalResults int         `json:"totalResults"`
 	MaxResults   int         `json:"maxResults"`
+	NextCursor   string      `json:"next,omitempty"`
+	PrevCursor   string      `json:"prev,omitempty"`
 	Paginations  Paginations `json:"-"`
 }
 
+// Cursor is the position of a page in a list: the sort key and ID of the
+// row the page goes on after, or ends before when Before is set. Clients
+// only see it encoded so the paging scheme can change without breaking them.
+type Cursor struct {
+	Key        string `json:"k,omitempty"`
+	ID         int    `json:"i"`
+	Before     bool   `json:"b,omitempty"`
+	MaxResults int    `json:"n"`
+}
+
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &Cursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID < 1 || c.MaxResults < 1 {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// keyset returns the condition selecting the rows of the page q continues
+// from its cursor in a list ordered by key and id, and the order to read
+// them in. An empty key orders by id alone. Pages before the cursor are
+// read backwards from it, so their rows are in the reverse order.
+func keyset(q *forms.Query, key, id string, desc bool) (string, []interface{}, string) {
+	cmp, dir := ">", "ASC"
+	if desc != q.Before {
+		cmp, dir = "<", "DESC"
+	}
+
+	order := " ORDER BY " + id + " " + dir
+	if key != "" {
+		order = " ORDER BY " + key + " " + dir + ", " + id + " " + dir
+	}
+
+	if q.KeyID == 0 {
+		return "", nil, order
+	}
+	if key == "" {
+		return " AND " + id + " " + cmp + " ?", []interface{}{q.KeyID}, order
+	}
+	where := " AND (" + key + " " + cmp + " ? OR (" + key + " = ? AND " + id + " " + cmp + " ?))"
+	return where, []interface{}{q.Key, q.Key, q.KeyID}, order
+}
+
+// limit returns the LIMIT of a page of q. It reads a row more than the page
+// holds to tell whether the list goes on.
+func limit(q *forms.Query) (string, []interface{}) {
+	if q.MaxResults < 0 {
+		return "", nil
+	}
+	if q.KeyID != 0 {
+		return " LIMIT ?", []interface{}{q.MaxResults + 1}
+	}
+	return " LIMIT ? OFFSET ?", []interface{}{q.MaxResults + 1, q.Start}
+}
+
+// pageRows trims the rows read for a page of q, a slice, to the page and
+// puts them in list order. It returns them with whether the list goes on
+// past the page in the direction it was read.
+func pageRows(q *forms.Query, rows interface{}) (interface{}, bool) {
+	v := reflect.ValueOf(rows)
+	more := q.MaxResults > -1 && v.Len() > q.MaxResults
+	if more {
+		v = v.Slice(0, q.MaxResults)
+	}
+	if q.Before {
+		swap := reflect.Swapper(v.Interface())
+		for i, j := 0, v.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	return v.Interface(), more
+}
+
 type Pagination struct {
 	Start        int
 	CurrentStart int
@@ -35,3 +134,28 @@ func (page *PageInfo) ConfigPaginations(pageURL string, currentStart int) {
 	}
 	page.Paginations = paginations
 }
+
+// ConfigCursors sets the cursors of the pages before and after a page of q
+// from the cursors of its first and last rows. more tells whether the list
+// goes on past the page in the direction it was read. An empty page, with
+// nil cursors, has none.
+func (page *PageInfo) ConfigCursors(q *forms.Query, more bool, first, last *Cursor) {
+	if page.MaxResults < 1 || first == nil {
+		return
+	}
+
+	next, prev := more, q.KeyID != 0 || q.Start > 0
+	if q.Before {
+		next, prev = true, more
+	}
+
+	if next {
+		last.MaxResults = page.MaxResults
+		page.NextCursor = last.Encode()
+	}
+	if prev {
+		first.Before = true
+		first.MaxResults = page.MaxResults
+		page.PrevCursor = first.Encode()
+	}
+}
@@ -1,111 +1,167 @@
 package models
 
 import (
-	"encoding/json"
+	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"strconv"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/rwcarlsen/goexif/exif"
-	"github.com/rwcarlsen/goexif/mknote"
 	"gitlab.com/code-mobi/board-checker/pkg/forms"
 )
 
-func (db *Database) GetAutoRunningNumber(worksheetID int) (next int) {
-	stmt := `SELECT MAX(running_number) FROM photos WHERE worksheet_id = ?`
-	db.QueryRow(stmt, worksheetID).Scan(&next)
-	next++
-	return
+var ErrDuplicatePhoto = errors.New("models: photo with this uuid already exists")
+
+// nextRunningNumber returns the number after the last photo of a
+// worksheet. Read it in the transaction that files the photo, after
+// lockAcceptsPhotos, so that concurrent uploads don't share a number.
+func nextRunningNumber(tx *sql.Tx, worksheetID int) (int, error) {
+	var last sql.NullInt64
+	err := tx.QueryRow(`SELECT MAX(running_number) FROM photos WHERE worksheet_id = ?`, worksheetID).Scan(&last)
+	return int(last.Int64) + 1, err
 }
 
+// InsertPhoto adds a photo, numbered after the last photo of its worksheet
+// unless it has a running number.
 func (db *Database) InsertPhoto(f *Photo) error {
-	if f.RunningNumber < 1 {
-		f.RunningNumber = db.GetAutoRunningNumber(f.WorksheetID)
+	var lat, lng interface{}
+	if f.GPS != nil {
+		lat, lng = f.GPS.Lat, f.GPS.Lng
 	}
 
-	stmt := `INSERT INTO photos (worksheet_id, running_number, filename, location, created)
-	VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`
-	_, err := db.Exec(stmt, f.WorksheetID, f.RunningNumber, f.FileName, f.Location)
+	stmt := `INSERT INTO photos (worksheet_id, running_number, filename, location, caption, uuid, sha256, exif, lat, lng, geohash, geofence, distance, qr_worksheet_id, user_id, slot, created, updated, seq)
+	VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, 0), ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(6), ` + changeSeq + `)`
+	err := db.change(func(tx *sql.Tx) error {
+		if err := lockAcceptsPhotos(tx, f.WorksheetID); err != nil {
+			return err
+		}
+		if f.RunningNumber < 1 {
+			next, err := nextRunningNumber(tx, f.WorksheetID)
+			if err != nil {
+				return err
+			}
+			f.RunningNumber = next
+		}
+		result, err := tx.Exec(stmt, f.WorksheetID, f.RunningNumber, f.FileName, f.Location, f.Caption, f.UUID, f.Hash, f.Exif,
+			lat, lng, geohash(f.GPS), f.Geofence, nullFloat(f.Distance), f.QRWorksheetID, f.UserID, f.Slot)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		f.ID = int(id)
+		return nil
+	})
+	if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+		return ErrDuplicatePhoto
+	}
 	return err
 }
 
-func (db *Database) ListPhotos(worksheetID int, q *forms.Query) (Photos, error) {
-	stmt := `SELECT id, worksheet_id, running_number, filename, location, created FROM photos WHERE worksheet_id = ? ORDER BY id ASC`
-	rows, err := db.Query(stmt, worksheetID)
-	if err != nil {
+const photoColumns = `id, worksheet_id, running_number, filename, location, caption, IFNULL(uuid, ''), sha256, lat, lng, geofence, distance, IFNULL(qr_worksheet_id, 0),
+	IFNULL(user_id, 0), review, review_reason, review_note, IFNULL(reviewer_id, 0), reviewed, slot, created, updated`
+
+func scanPhoto(row interface{ Scan(...interface{}) error }) (*Photo, error) {
+	f := &Photo{}
+	var lat, lng, distance sql.NullFloat64
+	var reviewed sql.NullTime
+	err := row.Scan(&f.ID, &f.WorksheetID, &f.RunningNumber, &f.FileName, &f.Location, &f.Caption, &f.UUID, &f.Hash,
+		&lat, &lng, &f.Geofence, &distance, &f.QRWorksheetID,
+		&f.UserID, &f.Review, &f.ReviewReason, &f.ReviewNote, &f.ReviewerID, &reviewed, &f.Slot, &f.Created, &f.Updated)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	photos := Photos{}
-	for rows.Next() {
-		f := &Photo{}
-		rows.Scan(&f.ID, &f.WorksheetID, &f.RunningNumber, &f.FileName, &f.Location, &f.Created)
-		if err != nil {
-			return nil, err
-		}
-		photos = append(photos, f)
+	f.GPS = nullLocation(lat, lng)
+	f.Reviewed = reviewed.Time
+	if distance.Valid {
+		f.Distance = &distance.Float64
 	}
+	return f, nil
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+func (db *Database) GetPhoto(id int) (*Photo, error) {
+	return scanPhoto(db.QueryRow(`SELECT `+photoColumns+` FROM photos WHERE id = ?`, id))
+}
 
-	return photos, nil
+// GetPhotoByUUID returns the photo uploaded with a client generated UUID.
+func (db *Database) GetPhotoByUUID(uuid string) (*Photo, error) {
+	return scanPhoto(db.QueryRow(`SELECT `+photoColumns+` FROM photos WHERE uuid = ?`, uuid))
 }
-func (db *Database) ListPhotosMaps(worksheetID int, storeDir string) (Locations, error) {
-	stmt := `SELECT id, worksheet_id, running_number, filename, location, created FROM photos WHERE worksheet_id = ? ORDER BY id ASC`
-	rows, err := db.Query(stmt, worksheetID)
+
+// GetPhotoByHash returns the photo of a worksheet with the given SHA-256
+// content hash.
+func (db *Database) GetPhotoByHash(worksheetID int, hash string) (*Photo, error) {
+	return scanPhoto(db.QueryRow(`SELECT `+photoColumns+` FROM photos
+	WHERE worksheet_id = ? AND sha256 = ? ORDER BY id LIMIT 1`, worksheetID, hash))
+}
+
+func (db *Database) ListPhotos(worksheetID int, q *forms.Query) (Photos, *PageInfo, error) {
+	pageInfo := &PageInfo{MaxResults: q.MaxResults}
+	countStmt := "SELECT count(id) "
+	selectStmt := "SELECT " + photoColumns
+	stmt := " FROM photos WHERE worksheet_id = ?"
+
+	params := []interface{}{worksheetID}
+
+	row := db.QueryRow(countStmt+stmt, params...)
+	err := row.Scan(&pageInfo.TotalResults)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	where, keyParams, order := keyset(q, "", "id", false)
+	limitStmt, limitParams := limit(q)
+	stmt += where + order + limitStmt
+	params = append(append(params, keyParams...), limitParams...)
+
+	rows, err := db.Query(selectStmt+stmt, params...)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	photos := Photos{}
 	for rows.Next() {
-		f := &Photo{}
-		rows.Scan(&f.ID, &f.WorksheetID, &f.RunningNumber, &f.FileName, &f.Location, &f.Created)
+		f, err := scanPhoto(rows)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		photos = append(photos, f)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	locations := Locations{}
-	for _, photo := range photos {
-		photoPath := storeDir + "/" + strconv.Itoa(photo.WorksheetID) + "/" + photo.FileName
-		log.Println(photoPath)
+	page, more := pageRows(q, photos)
+	photos = page.(Photos)
+	if len(photos) > 0 {
+		pageInfo.ConfigCursors(q, more, &Cursor{ID: photos[0].ID}, &Cursor{ID: photos[len(photos)-1].ID})
+	}
 
-		f, err := os.Open(photoPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer f.Close()
+	return photos, pageInfo, nil
+}
 
-		exif.RegisterParsers(mknote.All...)
-		x, err := exif.Decode(f)
-		if err != nil {
-			log.Println(err.Error())
-			return locations, nil
-		}
-		lat, long, err := x.LatLong()
-		fmt.Printf("lat, long: %f %f\n", lat, long)
-		if err != nil {
-			continue
+// photoExif reads the EXIF data of the stored file, or the copy kept in the
+// database when the file was re-encoded without it.
+func photoExif(photo *Photo, storeDir string) (*exif.Exif, error) {
+	photoPath := storeDir + "/" + strconv.Itoa(photo.WorksheetID) + "/" + photo.FileName
+	f, err := os.Open(photoPath)
+	if err == nil {
+		defer f.Close()
+		if x, err := exif.Decode(f); err == nil {
+			return x, nil
 		}
-
-		lo := &Location{lat, long}
-		locations = append(locations, lo)
 	}
-	locationStr, err := json.Marshal(locations)
-	if err != nil {
-		log.Print(err.Error())
+	if len(photo.Exif) == 0 {
+		return nil, fmt.Errorf("models: no EXIF data for %s", photoPath)
 	}
-	log.Print(string(locationStr))
-	return locations, nil
+	return exif.Decode(bytes.NewReader(photo.Exif))
 }
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"errors"
+
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+)
+
+// Reviews of a photo by a supervisor.
+const (
+	ReviewPending  = ""
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// ReviewReason is why a photo was rejected: a code stored with the photo
+// and a name shown to people.
+type ReviewReason struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// ReviewReasons are the reasons a photo can be rejected for.
+var ReviewReasons = []ReviewReason{
+	{"blurry", "Blurry or out of focus"},
+	{"too_dark", "Too dark or overexposed"},
+	{"obstructed", "Board is obstructed"},
+	{"wrong_angle", "Wrong angle or framing"},
+	{"wrong_board", "Wrong board"},
+	{"missing_gps", "Missing or wrong GPS"},
+	{"other", "Other, see the note"},
+}
+
+// ReviewReasonName returns the name of a reason code, or the code itself
+// when it is not one of ReviewReasons.
+func ReviewReasonName(code string) string {
+	for _, r := range ReviewReasons {
+		if r.Code == code {
+			return r.Name
+		}
+	}
+	return code
+}
+
+func validReviewReason(code string) bool {
+	for _, r := range ReviewReasons {
+		if r.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrInvalidReview     = errors.New("models: a review is approved or rejected")
+	ErrReviewReason      = errors.New("models: a rejected photo needs one of the review reasons")
+	ErrReviewRole        = errors.New("models: only supervisors review photos")
+	ErrPhotosNotApproved = errors.New("models: worksheet has photos that are not approved")
+	ErrNoPhotos          = errors.New("models: worksheet has no photos")
+	ErrSlotsIncomplete   = errors.New("models: worksheet has checklist slots without a photo")
+)
+
+// ReviewItem is a photo of the review queue with its worksheet.
+type ReviewItem struct {
+	Photo     *Photo
+	Worksheet *Worksheet
+}
+
+// ListReviewQueue returns the photos of worksheets with the review of f,
+// pending by default, uploaded on its date to worksheets of its zone and
+// team, oldest first.
+func (db *Database) ListReviewQueue(f *forms.ReviewFilter, q *forms.Query) ([]*ReviewItem, *PageInfo, error) {
+	pageInfo := &PageInfo{MaxResults: q.MaxResults}
+	stmt := ` FROM photos WHERE review = ? AND worksheet_id IN (SELECT id FROM worksheets WHERE 1 = 1`
+	params := []interface{}{f.Review}
+	if f.ZoneID != 0 {
+		stmt += " AND zone_id = ?"
+		params = append(params, f.ZoneID)
+	}
+	if f.TeamID != 0 {
+		stmt += " AND team_id = ?"
+		params = append(params, f.TeamID)
+	}
+	stmt += ")"
+	if f.Date != "" {
+		stmt += " AND date_format(created, '%Y-%m-%d') = ?"
+		params = append(params, f.Date)
+	}
+
+	err := db.QueryRow(`SELECT count(id)`+stmt, params...).Scan(&pageInfo.TotalResults)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	where, keyParams, order := keyset(q, "", "id", false)
+	limitStmt, limitParams := limit(q)
+	stmt += where + order + limitStmt
+	params = append(append(params, keyParams...), limitParams...)
+
+	photos, err := db.queryPhotos(`SELECT `+photoColumns+stmt, params...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, more := pageRows(q, photos)
+	photos = page.(Photos)
+	if len(photos) > 0 {
+		pageInfo.ConfigCursors(q, more, &Cursor{ID: photos[0].ID}, &Cursor{ID: photos[len(photos)-1].ID})
+	}
+
+	worksheets := map[int]*Worksheet{}
+	items := []*ReviewItem{}
+	for _, p := range photos {
+		w, ok := worksheets[p.WorksheetID]
+		if !ok {
+			if w, err = db.GetWorksheet(p.WorksheetID); err != nil {
+				return nil, nil, err
+			}
+			worksheets[p.WorksheetID] = w
+		}
+		if w != nil {
+			items = append(items, &ReviewItem{Photo: p, Worksheet: w})
+		}
+	}
+	return items, pageInfo, nil
+}
+
+// ListRejectedPhotos returns the rejected photos a user uploaded, newest
+// first.
+func (db *Database) ListRejectedPhotos(userID int) (Photos, error) {
+	return db.queryPhotos(`SELECT `+photoColumns+` FROM photos
+	WHERE user_id = ? AND review = ? ORDER BY reviewed DESC, id DESC`, userID, ReviewRejected)
+}
+
+func (db *Database) queryPhotos(stmt string, params ...interface{}) (Photos, error) {
+	rows, err := db.Query(stmt, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := Photos{}
+	for rows.Next() {
+		f, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// ReviewPhoto approves or rejects a photo on behalf of a supervisor. A
+// rejection needs the code of one of ReviewReasons and may have a note. It
+// returns sql.ErrNoRows for a missing photo or one in the inbox, and
+// ErrWorksheetApproved once its worksheet is approved.
+func (db *Database) ReviewPhoto(photoID int, review, reason, note string, user *User) error {
+	if !contains(supervisors, user.Role) {
+		return ErrReviewRole
+	}
+	switch review {
+	case ReviewApproved:
+		reason, note = "", ""
+	case ReviewRejected:
+		if !validReviewReason(reason) {
+			return ErrReviewReason
+		}
+	default:
+		return ErrInvalidReview
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := takeChange(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Locking the worksheet keeps it from being approved meanwhile.
+	var status string
+	err = tx.QueryRow(`SELECT w.status FROM photos p INNER JOIN worksheets w ON (p.worksheet_id = w.id)
+	WHERE p.id = ? FOR UPDATE`, photoID).Scan(&status)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if status == StatusApproved {
+		tx.Rollback()
+		return ErrWorksheetApproved
+	}
+
+	_, err = tx.Exec(`UPDATE photos SET review = ?, review_reason = ?, review_note = ?, reviewer_id = ?,
+	reviewed = UTC_TIMESTAMP(), updated = UTC_TIMESTAMP(6), seq = `+changeSeq+` WHERE id = ?`, review, reason, note, user.ID, photoID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
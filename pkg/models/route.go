@@ -0,0 +1,91 @@
+package models
+
+import (
+	"database/sql"
+
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
+)
+
+// RouteStop is a worksheet on a route, visited as stop number Sequence.
+// Location is that of the worksheet, or of its board when it has none. Leg
+// is the distance in metres from the previous stop, or from the start, and
+// Distance the distance travelled so far.
+type RouteStop struct {
+	Sequence  int
+	Worksheet *Worksheet
+	Location  *Location
+	Leg       float64
+	Distance  float64
+}
+
+// Route is the order a team visits its worksheets of a day in. Worksheets
+// without a location cannot be placed and are listed in Unlocated.
+type Route struct {
+	TeamID    int
+	Date      string
+	Start     *Location
+	Stops     []*RouteStop
+	Unlocated Worksheets
+	Distance  float64
+}
+
+// TeamRoute plans the route of a team through its worksheets created on
+// date, in LocalZone, that are not approved yet, from start, or from
+// whichever worksheet makes the route shortest when start is nil.
+func (db *Database) TeamRoute(teamID int, date string, start *Location) (*Route, error) {
+	dayStart, dayEnd, err := localDay(date)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT `+worksheetColumns+`,
+	IFNULL(w.lat, IF(b.lat = 0 AND b.lng = 0, NULL, b.lat)),
+	IFNULL(w.lng, IF(b.lat = 0 AND b.lng = 0, NULL, b.lng))`+worksheetFrom+`
+	WHERE w.team_id = ? AND w.created >= ? AND w.created < ? AND w.status <> ?
+	ORDER BY w.created, w.id`, teamID, dayStart, dayEnd, StatusApproved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	route := &Route{TeamID: teamID, Date: date, Start: start, Stops: []*RouteStop{}, Unlocated: Worksheets{}}
+	stops := []*RouteStop{}
+	for rows.Next() {
+		var lat, lng sql.NullFloat64
+		p, err := scanWorksheet(scanWith{rows, []interface{}{&lat, &lng}})
+		if err != nil {
+			return nil, err
+		}
+		if location := nullLocation(lat, lng); location != nil {
+			stops = append(stops, &RouteStop{Worksheet: p, Location: location})
+		} else {
+			route.Unlocated = append(route.Unlocated, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	points := make([]geo.Point, len(stops))
+	for i, stop := range stops {
+		points[i] = geo.Point{stop.Location.Lng, stop.Location.Lat}
+	}
+	var from *geo.Point
+	if start != nil {
+		from = &geo.Point{start.Lng, start.Lat}
+	}
+	order, _ := geo.PlanRoute(from, points)
+
+	previous := start
+	for _, i := range order {
+		stop := stops[i]
+		if previous != nil {
+			stop.Leg = previous.Distance(stop.Location)
+		}
+		route.Distance += stop.Leg
+		stop.Distance = route.Distance
+		stop.Sequence = len(route.Stops) + 1
+		route.Stops = append(route.Stops, stop)
+		previous = stop.Location
+	}
+	return route, nil
+}
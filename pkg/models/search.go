@@ -0,0 +1,262 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"gitlab.com/code-mobi/board-checker/pkg/search"
+)
+
+var ErrFullTextUnsupported = errors.New("models: full-text search is not supported by the database")
+
+// Search runs q against the FULLTEXT indexes of worksheets, zones, teams
+// and photos. Worksheets also match the names of their zone and team,
+// which count less than their own number and name. It returns ErrFullTextUnsupported when the database is not
+// MySQL or the indexes have not been created, so the caller can fall back
+// to an in-process search.Index built from SearchDocuments.
+func (db *Database) Search(q string, limit int) (search.Results, error) {
+	if _, ok := db.Driver().(*mysql.MySQLDriver); !ok {
+		return nil, ErrFullTextUnsupported
+	}
+
+	terms := search.Tokenize(q)
+	if len(terms) == 0 {
+		return search.Results{}, nil
+	}
+	against := strings.Join(terms, "* ") + "*"
+
+	stmt := `SELECT w.id, w.number, w.name, z.name, t.name,
+	MATCH(w.number, w.name) AGAINST(? IN BOOLEAN MODE) * 3
+	+ MATCH(z.name) AGAINST(? IN BOOLEAN MODE)
+	+ MATCH(t.name) AGAINST(? IN BOOLEAN MODE) score
+	FROM worksheets w
+	INNER JOIN zones z on (w.zone_id = z.id)
+	INNER JOIN teams t on (w.team_id = t.id)
+	WHERE MATCH(w.number, w.name) AGAINST(? IN BOOLEAN MODE)
+	OR MATCH(z.name) AGAINST(? IN BOOLEAN MODE)
+	OR MATCH(t.name) AGAINST(? IN BOOLEAN MODE)
+	ORDER BY score DESC
+	LIMIT ?`
+	rows, err := db.Query(stmt, against, against, against, against, against, against, limit)
+	if err != nil {
+		return nil, fullTextError(err)
+	}
+	defer rows.Close()
+
+	results := search.Results{}
+	for rows.Next() {
+		w := &Worksheet{}
+		var score float64
+		err = rows.Scan(&w.ID, &w.Number, &w.Name, &w.ZoneName, &w.TeamName, &score)
+		if err != nil {
+			return nil, err
+		}
+		doc := worksheetDocument(w)
+		results = append(results, &search.Result{
+			Document:  *doc,
+			Score:     score,
+			Highlight: search.HighlightFields(doc.Fields, q),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, table := range []string{"zones", "teams"} {
+		stmt = `SELECT id, name, MATCH(name) AGAINST(? IN BOOLEAN MODE) score FROM ` + table + `
+		WHERE MATCH(name) AGAINST(? IN BOOLEAN MODE)
+		ORDER BY score DESC
+		LIMIT ?`
+		rows, err = db.Query(stmt, against, against, limit)
+		if err != nil {
+			return nil, fullTextError(err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int
+			var name string
+			var score float64
+			if err := rows.Scan(&id, &name, &score); err != nil {
+				return nil, err
+			}
+			doc := groupDocument(table, id, name)
+			results = append(results, &search.Result{
+				Document:  *doc,
+				Score:     score,
+				Highlight: search.HighlightFields(doc.Fields, q),
+			})
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt = `SELECT p.id, p.worksheet_id, p.running_number, p.location, p.caption, w.number,
+	MATCH(p.location, p.caption) AGAINST(? IN BOOLEAN MODE) score
+	FROM photos p
+	INNER JOIN worksheets w on (p.worksheet_id = w.id)
+	WHERE MATCH(p.location, p.caption) AGAINST(? IN BOOLEAN MODE)
+	ORDER BY score DESC
+	LIMIT ?`
+	rows, err = db.Query(stmt, against, against, limit)
+	if err != nil {
+		return nil, fullTextError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &Photo{}
+		var number string
+		var score float64
+		err = rows.Scan(&p.ID, &p.WorksheetID, &p.RunningNumber, &p.Location, &p.Caption, &number, &score)
+		if err != nil {
+			return nil, err
+		}
+		doc := photoDocument(p, number)
+		results = append(results, &search.Result{
+			Document:  *doc,
+			Score:     score,
+			Highlight: search.HighlightFields(doc.Fields, q),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results.Sort()
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// SearchDocuments loads every searchable worksheet, zone, team and photo
+// for building an in-process search.Index.
+func (db *Database) SearchDocuments() ([]*search.Document, error) {
+	stmt := `SELECT w.id, w.number, w.name, z.name, t.name FROM worksheets w
+	INNER JOIN zones z on (w.zone_id = z.id)
+	INNER JOIN teams t on (w.team_id = t.id)`
+	rows, err := db.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []*search.Document{}
+	for rows.Next() {
+		w := &Worksheet{}
+		err = rows.Scan(&w.ID, &w.Number, &w.Name, &w.ZoneName, &w.TeamName)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, worksheetDocument(w))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, table := range []string{"zones", "teams"} {
+		rows, err = db.Query(`SELECT id, name FROM ` + table)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				return nil, err
+			}
+			docs = append(docs, groupDocument(table, id, name))
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt = `SELECT p.id, p.worksheet_id, p.running_number, p.location, p.caption, w.number
+	FROM photos p
+	INNER JOIN worksheets w on (p.worksheet_id = w.id)
+	WHERE p.location <> '' OR p.caption <> ''`
+	rows, err = db.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &Photo{}
+		var number string
+		err = rows.Scan(&p.ID, &p.WorksheetID, &p.RunningNumber, &p.Location, &p.Caption, &number)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, photoDocument(p, number))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return docs, nil
+}
+
+func worksheetDocument(w *Worksheet) *search.Document {
+	return &search.Document{
+		Type:        "worksheet",
+		ID:          w.ID,
+		WorksheetID: w.ID,
+		Title:       w.Number + " - " + w.Name,
+		Path:        "/worksheet/" + strconv.Itoa(w.ID),
+		Fields: []search.Field{
+			{Name: "number", Text: w.Number, Boost: 3},
+			{Name: "name", Text: w.Name, Boost: 2},
+			{Name: "zone", Text: w.ZoneName, Boost: 1},
+			{Name: "team", Text: w.TeamName, Boost: 1},
+		},
+	}
+}
+
+func photoDocument(p *Photo, number string) *search.Document {
+	return &search.Document{
+		Type:        "photo",
+		ID:          p.ID,
+		WorksheetID: p.WorksheetID,
+		Title:       number + " No. " + strconv.Itoa(p.RunningNumber),
+		Path:        "/worksheet/" + strconv.Itoa(p.WorksheetID),
+		Fields: []search.Field{
+			{Name: "location", Text: p.Location, Boost: 1},
+			{Name: "caption", Text: p.Caption, Boost: 1},
+		},
+	}
+}
+
+// groupDocument is a zone or team, from the table of that name, whose
+// result opens the list of its worksheets.
+func groupDocument(table string, id int, name string) *search.Document {
+	typ := strings.TrimSuffix(table, "s")
+	return &search.Document{
+		Type:  typ,
+		ID:    id,
+		Title: name,
+		Path:  "/worksheet/" + typ + "/" + strconv.Itoa(id),
+		Fields: []search.Field{
+			{Name: "name", Text: name, Boost: 1},
+		},
+	}
+}
+
+// fullTextError maps the MySQL errors for a missing FULLTEXT index to
+// ErrFullTextUnsupported.
+func fullTextError(err error) error {
+	if e, ok := err.(*mysql.MySQLError); ok {
+		switch e.Number {
+		case 1191, 1214:
+			return ErrFullTextUnsupported
+		}
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Worksheet statuses, from a job being planned to its photos being checked.
+const (
+	StatusDraft      = "draft"
+	StatusAssigned   = "assigned"
+	StatusInProgress = "in_progress"
+	StatusSubmitted  = "submitted"
+	StatusApproved   = "approved"
+	StatusRejected   = "rejected"
+)
+
+// Statuses lists every worksheet status in workflow order.
+var Statuses = []string{StatusDraft, StatusAssigned, StatusInProgress, StatusSubmitted, StatusApproved, StatusRejected}
+
+// Roles of users. Inspectors take the photos, supervisors assign the jobs
+// and check the results, and admins can also reopen approved worksheets.
+const (
+	RoleInspector  = "inspector"
+	RoleSupervisor = "supervisor"
+	RoleAdmin      = "admin"
+)
+
+var Roles = []string{RoleInspector, RoleSupervisor, RoleAdmin}
+
+var (
+	ErrInvalidRole       = errors.New("models: unknown user role")
+	ErrInvalidStatus     = errors.New("models: unknown worksheet status")
+	ErrStatusTransition  = errors.New("models: worksheet status change not allowed")
+	ErrWorksheetApproved = errors.New("models: worksheet is approved and takes no more photos")
+	ErrNoWorksheet       = errors.New("models: worksheet does not exist")
+)
+
+// Transition is a status change and the roles allowed to make it.
+type Transition struct {
+	From, To string
+	Roles    []string
+}
+
+var (
+	anyone      = []string{RoleInspector, RoleSupervisor, RoleAdmin}
+	supervisors = []string{RoleSupervisor, RoleAdmin}
+)
+
+// Transitions are the allowed status changes of a worksheet.
+var Transitions = []Transition{
+	{StatusDraft, StatusAssigned, supervisors},
+	{StatusAssigned, StatusDraft, supervisors},
+	{StatusAssigned, StatusInProgress, anyone},
+	{StatusInProgress, StatusSubmitted, anyone},
+	{StatusSubmitted, StatusApproved, supervisors},
+	{StatusSubmitted, StatusRejected, supervisors},
+	{StatusRejected, StatusInProgress, anyone},
+	{StatusApproved, StatusInProgress, []string{RoleAdmin}},
+}
+
+func ValidStatus(status string) bool {
+	return contains(Statuses, status)
+}
+
+func ValidRole(role string) bool {
+	return contains(Roles, role)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CanTransition reports whether a user with role may change a worksheet
+// from one status to another.
+func CanTransition(from, to, role string) bool {
+	for _, t := range Transitions {
+		if t.From == from && t.To == to {
+			return contains(t.Roles, role)
+		}
+	}
+	return false
+}
+
+// NextStatuses returns the statuses a user with role may move a worksheet
+// to from status.
+func NextStatuses(status, role string) []string {
+	next := []string{}
+	for _, t := range Transitions {
+		if t.From == status && contains(t.Roles, role) {
+			next = append(next, t.To)
+		}
+	}
+	return next
+}
+
+// AcceptsPhotos reports whether photos may still be uploaded to the
+// worksheet.
+func (worksheet *Worksheet) AcceptsPhotos() bool {
+	return worksheet.Status != StatusApproved
+}
+
+// StatusChange records who changed the status of a worksheet, when and
+// why.
+type StatusChange struct {
+	ID          int       `json:"id"`
+	WorksheetID int       `json:"worksheetID"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	UserID      int       `json:"userID"`
+	UserName    string    `json:"userName"`
+	Reason      string    `json:"reason"`
+	Created     time.Time `json:"created"`
+}
+
+// ChangeWorksheetStatus moves a worksheet to status on behalf of user and
+// records the change. It returns sql.ErrNoRows for a missing worksheet,
+// ErrStatusTransition when the user's role may not make the change and
+// ErrPhotosNotApproved when approving a worksheet with photos that are not,
+// ErrNoPhotos when it has none and ErrSlotsIncomplete when a slot of its
+// checklist has no photo.
+func (db *Database) ChangeWorksheetStatus(worksheetID int, status string, user *User, reason string) (*StatusChange, error) {
+	if !ValidStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if err := takeChange(tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	change := &StatusChange{
+		WorksheetID: worksheetID,
+		To:          status,
+		UserID:      user.ID,
+		UserName:    user.Name,
+		Reason:      reason,
+	}
+	err = tx.QueryRow(`SELECT status FROM worksheets WHERE id = ? FOR UPDATE`, worksheetID).Scan(&change.From)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !CanTransition(change.From, change.To, user.Role) {
+		tx.Rollback()
+		return nil, ErrStatusTransition
+	}
+	if status == StatusApproved {
+		var photos, unapproved, filled, required int
+		err = tx.QueryRow(`SELECT count(id), IFNULL(SUM(review <> ?), 0) FROM photos WHERE worksheet_id = ?`, ReviewApproved, worksheetID).Scan(&photos, &unapproved)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if unapproved > 0 {
+			tx.Rollback()
+			return nil, ErrPhotosNotApproved
+		}
+		if photos == 0 {
+			tx.Rollback()
+			return nil, ErrNoPhotos
+		}
+		err = tx.QueryRow(`SELECT `+slotsFilled+`, `+slotsRequired+worksheetFrom+` WHERE w.id = ?`, worksheetID).Scan(&filled, &required)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if filled < required {
+			tx.Rollback()
+			return nil, ErrSlotsIncomplete
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE worksheets SET status = ?, updated = UTC_TIMESTAMP(6), seq = `+changeSeq+` WHERE id = ?`, status, worksheetID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	change.Created = time.Now().UTC().Truncate(time.Second)
+	result, err := tx.Exec(`INSERT INTO worksheet_status_changes (worksheet_id, from_status, to_status, user_id, reason, created)
+	VALUES (?, ?, ?, ?, ?, ?)`, worksheetID, change.From, change.To, user.ID, reason, change.Created)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	change.ID = int(id)
+
+	return change, tx.Commit()
+}
+
+// ListStatusChanges returns the status history of a worksheet, oldest
+// first.
+func (db *Database) ListStatusChanges(worksheetID int) ([]*StatusChange, error) {
+	rows, err := db.Query(`SELECT c.id, c.worksheet_id, c.from_status, c.to_status, c.user_id, IFNULL(u.name, ''), c.reason, c.created
+	FROM worksheet_status_changes c LEFT JOIN users u ON (c.user_id = u.id)
+	WHERE c.worksheet_id = ? ORDER BY c.created, c.id`, worksheetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*StatusChange{}
+	for rows.Next() {
+		c := &StatusChange{}
+		err := rows.Scan(&c.ID, &c.WorksheetID, &c.From, &c.To, &c.UserID, &c.UserName, &c.Reason, &c.Created)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// CheckAcceptsPhotos returns ErrWorksheetApproved when the worksheet is
+// approved and ErrNoWorksheet when it doesn't exist, unless it is the
+// inbox. It only spares the work of storing a photo that would be refused:
+// the writes check again with lockAcceptsPhotos.
+func (db *Database) CheckAcceptsPhotos(worksheetID int) error {
+	return acceptsPhotos(worksheetID, db.QueryRow(`SELECT status FROM worksheets WHERE id = ?`, worksheetID))
+}
+
+// lockAcceptsPhotos is CheckAcceptsPhotos within tx. It locks the worksheet
+// row, as ChangeWorksheetStatus does, so the worksheet cannot be approved
+// before tx commits.
+func lockAcceptsPhotos(tx *sql.Tx, worksheetID int) error {
+	return acceptsPhotos(worksheetID, tx.QueryRow(`SELECT status FROM worksheets WHERE id = ? FOR UPDATE`, worksheetID))
+}
+
+func acceptsPhotos(worksheetID int, row *sql.Row) error {
+	var status string
+	err := row.Scan(&status)
+	if err == sql.ErrNoRows {
+		if worksheetID == InboxWorksheetID {
+			return nil
+		}
+		return ErrNoWorksheet
+	} else if err != nil {
+		return err
+	}
+	if status == StatusApproved {
+		return ErrWorksheetApproved
+	}
+	return nil
+}
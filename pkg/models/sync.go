@@ -0,0 +1,318 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSyncToken = errors.New("models: invalid sync token")
+
+// Entities tracked for delta sync. They are also the table names.
+const (
+	EntityWorksheets = "worksheets"
+	EntityPhotos     = "photos"
+	EntityTeams      = "teams"
+	EntityZones      = "zones"
+	EntityBoards     = "boards"
+)
+
+// SyncToken is how far a sync client got in the change sequence, and when.
+// The time only tells created rows from updated ones.
+type SyncToken struct {
+	Seq  int64
+	Time time.Time
+}
+
+// Changes holds every entity created, updated or deleted after Since up to
+// Until.
+type Changes struct {
+	Since      SyncToken
+	Until      SyncToken
+	Worksheets Worksheets
+	Photos     Photos
+	Teams      Teams
+	Zones      Zones
+	Boards     Boards
+	Deleted    map[string][]int
+}
+
+func EncodeSyncToken(t SyncToken) string {
+	s := strconv.FormatInt(t.Seq, 10) + "/" + t.Time.UTC().Format(time.RFC3339Nano)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// DecodeSyncToken returns the zero token for an empty one so that a first
+// sync downloads everything. So do tokens from before the change sequence,
+// which only held a time.
+func DecodeSyncToken(s string) (SyncToken, error) {
+	if s == "" {
+		return SyncToken{}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+
+	t := SyncToken{}
+	seq, at := "0", string(b)
+	if i := strings.IndexByte(at, '/'); i >= 0 {
+		seq, at = at[:i], at[i+1:]
+	}
+	t.Seq, err = strconv.ParseInt(seq, 10, 64)
+	if err != nil || t.Seq < 0 {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+	t.Time, err = time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+	return t, nil
+}
+
+// changeSeq is the number of the change a transaction makes, once
+// takeChange took it. Writes to tracked rows set their seq to it.
+const changeSeq = `(SELECT seq FROM sync_sequence WHERE id = 1)`
+
+// takeChange takes the next number of the change sequence for the rows tx
+// writes. The sequence row stays locked until tx ends, so changes commit in
+// the order of their numbers and a sync that read up to a number has seen
+// every change before it. It must come before tx locks any other row.
+func takeChange(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE sync_sequence SET seq = seq + 1 WHERE id = 1`)
+	return err
+}
+
+// change runs fn in a transaction that took a number of the change
+// sequence.
+func (db *Database) change(fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := takeChange(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// execChange runs a statement writing tracked rows as a change of its own.
+func (db *Database) execChange(query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := db.change(func(tx *sql.Tx) error {
+		var err error
+		result, err = tx.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
+
+// ListChanges returns what changed since the given token. When teamID is
+// not zero worksheets and photos are limited to that team's assignments,
+// and those that left them since count as deleted.
+func (db *Database) ListChanges(since SyncToken, teamID int) (*Changes, error) {
+	changes := &Changes{
+		Since:   since,
+		Deleted: map[string][]int{},
+	}
+
+	// Every read shares the snapshot of the first, which holds the changes
+	// up to the sequence number it reads and none after.
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT seq, UTC_TIMESTAMP(6) FROM sync_sequence WHERE id = 1`).Scan(&changes.Until.Seq, &changes.Until.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `SELECT w.id, w.number, w.name, w.created, w.updated, z.id zone_id, z.name zone_name, t.id team_id, t.name team_name,
+	IFNULL(b.id, 0), IFNULL(b.code, ''), IFNULL(b.name, ''), w.status FROM worksheets w
+	INNER JOIN zones z on (w.zone_id = z.id)
+	INNER JOIN teams t on (w.team_id = t.id)
+	LEFT JOIN boards b on (w.board_id = b.id)
+	WHERE w.seq > ? AND w.seq <= ?`
+	params := []interface{}{changes.Since.Seq, changes.Until.Seq}
+	if teamID != 0 {
+		stmt += " AND w.team_id = ?"
+		params = append(params, teamID)
+	}
+	rows, err := tx.Query(stmt+" ORDER BY w.seq, w.id", params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes.Worksheets = Worksheets{}
+	for rows.Next() {
+		p := &Worksheet{}
+		err = rows.Scan(&p.ID, &p.Number, &p.Name, &p.Created, &p.Updated, &p.ZoneID, &p.ZoneName, &p.TeamID, &p.TeamName, &p.BoardID, &p.BoardCode, &p.BoardName, &p.Status)
+		if err != nil {
+			return nil, err
+		}
+		changes.Worksheets = append(changes.Worksheets, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt = `SELECT ` + photoColumns + ` FROM photos
+	WHERE seq > ? AND seq <= ?`
+	params = []interface{}{changes.Since.Seq, changes.Until.Seq}
+	if teamID != 0 {
+		stmt += " AND worksheet_id IN (SELECT id FROM worksheets WHERE team_id = ?)"
+		params = append(params, teamID)
+	}
+	rows, err = tx.Query(stmt+" ORDER BY seq, id", params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes.Photos = Photos{}
+	for rows.Next() {
+		f, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes.Photos = append(changes.Photos, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT id, name, created, updated FROM teams
+	WHERE seq > ? AND seq <= ? ORDER BY seq, id`, changes.Since.Seq, changes.Until.Seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes.Teams = Teams{}
+	for rows.Next() {
+		t := &Team{}
+		err = rows.Scan(&t.ID, &t.Name, &t.Created, &t.Updated)
+		if err != nil {
+			return nil, err
+		}
+		changes.Teams = append(changes.Teams, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT `+zoneColumns+` FROM zones
+	WHERE seq > ? AND seq <= ? ORDER BY seq, id`, changes.Since.Seq, changes.Until.Seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes.Zones = Zones{}
+	for rows.Next() {
+		t, err := scanZone(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes.Zones = append(changes.Zones, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT `+boardColumns+boardFrom+`
+	WHERE b.seq > ? AND b.seq <= ? ORDER BY b.seq, b.id`, changes.Since.Seq, changes.Until.Seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes.Boards = Boards{}
+	for rows.Next() {
+		b, err := scanBoard(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes.Boards = append(changes.Boards, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Rows that left a team are deletions for that team only, unless they
+	// are back with it by now.
+	stmt = `SELECT entity, entity_id FROM deletions WHERE seq > ? AND seq <= ?`
+	params = []interface{}{changes.Since.Seq, changes.Until.Seq}
+	if teamID != 0 {
+		stmt += ` AND (team_id = 0 OR (team_id = ?
+		AND NOT (entity = ? AND entity_id IN (SELECT id FROM worksheets WHERE team_id = ?))
+		AND NOT (entity = ? AND entity_id IN (SELECT p.id FROM photos p INNER JOIN worksheets w ON (p.worksheet_id = w.id) WHERE w.team_id = ?))))`
+		params = append(params, teamID, EntityWorksheets, teamID, EntityPhotos, teamID)
+	} else {
+		stmt += " AND team_id = 0"
+	}
+	rows, err = tx.Query(stmt+" ORDER BY seq, id", params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for _, entity := range []string{EntityWorksheets, EntityPhotos, EntityTeams, EntityZones, EntityBoards} {
+		changes.Deleted[entity] = []int{}
+	}
+	for rows.Next() {
+		var entity string
+		var id int
+		err = rows.Scan(&entity, &id)
+		if err != nil {
+			return nil, err
+		}
+		changes.Deleted[entity] = append(changes.Deleted[entity], id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// deleteWithTombstone deletes a row and records the deletion for sync
+// clients in the same change.
+func (db *Database) deleteWithTombstone(entity string, id int) error {
+	return db.change(func(tx *sql.Tx) error {
+		return deleteWithTombstone(tx, entity, id)
+	})
+}
+
+func deleteWithTombstone(tx *sql.Tx, entity string, id int) error {
+	if _, err := tx.Exec(`DELETE FROM `+entity+` WHERE id = ?`, id); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO deletions (entity, entity_id, deleted, seq) VALUES (?, ?, UTC_TIMESTAMP(6), `+changeSeq+`)`, entity, id)
+	return err
+}
+
+// leaveTeam records that a worksheet and its photos left the worksheets of
+// a team, so the sync clients of that team drop them.
+func leaveTeam(tx *sql.Tx, worksheetID, teamID int) error {
+	_, err := tx.Exec(`INSERT INTO deletions (entity, entity_id, team_id, deleted, seq)
+	VALUES (?, ?, ?, UTC_TIMESTAMP(6), `+changeSeq+`)`, EntityWorksheets, worksheetID, teamID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO deletions (entity, entity_id, team_id, deleted, seq)
+	SELECT ?, id, ?, UTC_TIMESTAMP(6), `+changeSeq+` FROM photos WHERE worksheet_id = ?`, EntityPhotos, teamID, worksheetID)
+	return err
+}
@@ -1,6 +1,10 @@
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+)
 
 func (db *Database) ListTeams() (Teams, error) {
 	stmt := `SELECT id, name FROM teams ORDER BY name`
@@ -28,6 +32,50 @@ func (db *Database) ListTeams() (Teams, error) {
 	return teams, nil
 }
 
+func (db *Database) ListTeamsPaged(q *forms.Query) (Teams, *PageInfo, error) {
+	pageInfo := &PageInfo{MaxResults: q.MaxResults}
+	row := db.QueryRow(`SELECT count(id) FROM teams`)
+	err := row.Scan(&pageInfo.TotalResults)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	where, params, order := keyset(q, "name", "id", false)
+	limitStmt, limitParams := limit(q)
+	stmt := `SELECT id, name FROM teams WHERE 1 = 1` + where + order + limitStmt
+	params = append(params, limitParams...)
+
+	rows, err := db.Query(stmt, params...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	teams := Teams{}
+	for rows.Next() {
+		t := &Team{}
+		rows.Scan(&t.ID, &t.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		teams = append(teams, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	page, more := pageRows(q, teams)
+	teams = page.(Teams)
+	if len(teams) > 0 {
+		first, last := teams[0], teams[len(teams)-1]
+		pageInfo.ConfigCursors(q, more, &Cursor{Key: first.Name, ID: first.ID}, &Cursor{Key: last.Name, ID: last.ID})
+	}
+
+	return teams, pageInfo, nil
+}
+
 func (db *Database) GetTeam(id int) (*Team, error) {
 	stmt := `SELECT id, name FROM teams WHERE id = ?`
 	row := db.QueryRow(stmt, id)
@@ -44,17 +92,28 @@ func (db *Database) GetTeam(id int) (*Team, error) {
 }
 
 func (db *Database) InsertTeam(team *Team) error {
-	stmt := `INSERT INTO teams (name) VALUES (?)`
-	_, err := db.Exec(stmt, team.Name)
+	return db.change(func(tx *sql.Tx) error {
+		return insertTeam(tx, team)
+	})
+}
+
+func insertTeam(ex execer, team *Team) error {
+	stmt := `INSERT INTO teams (name, created, updated, seq) VALUES (?, UTC_TIMESTAMP(), UTC_TIMESTAMP(6), ` + changeSeq + `)`
+	result, err := ex.Exec(stmt, team.Name)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
 		return err
 	}
+	team.ID = int(id)
 	return nil
 }
 
 func (db *Database) UpdateTeam(team *Team) error {
-	stmt := `UPDATE teams SET name = ? WHERE id = ?`
-	_, err := db.Exec(stmt, team.Name, team.ID)
+	stmt := `UPDATE teams SET name = ?, updated = UTC_TIMESTAMP(6), seq = ` + changeSeq + ` WHERE id = ?`
+	_, err := db.execChange(stmt, team.Name, team.ID)
 	if err != nil {
 		return err
 	}
@@ -62,10 +121,5 @@ func (db *Database) UpdateTeam(team *Team) error {
 }
 
 func (db *Database) DeleteTeam(teamID int) error {
-	stmt := `DELETE FROM teams WHERE id = ?`
-	_, err := db.Exec(stmt, teamID)
-	if err != nil {
-		return err
-	}
-	return nil
+	return db.deleteWithTombstone(EntityTeams, teamID)
 }
@@ -20,6 +20,8 @@ type User struct {
 	ID       int
 	Name     string
 	Password string
+	Role     string
+	TeamID   int
 	Created  time.Time
 }
 
@@ -27,6 +29,9 @@ func (user *User) Valid() error {
 	if user.Name == "" || user.Password == "" {
 		return errors.New(fmt.Sprintf("User data incorrect!\n=== %v ===", user))
 	}
+	if user.Role != "" && !ValidRole(user.Role) {
+		return ErrInvalidRole
+	}
 	return nil
 }
 
@@ -41,9 +46,14 @@ func (db *Database) InsertUser(user *User) error {
 		return err
 	}
 
-	stmt := `INSERT INTO users (name, password, created)
-	VALUES (?, ?, UTC_TIMESTAMP())`
-	_, err = db.Exec(stmt, user.Name, hashedPassword)
+	role := user.Role
+	if role == "" {
+		role = RoleInspector
+	}
+
+	stmt := `INSERT INTO users (name, password, role, created)
+	VALUES (?, ?, ?, UTC_TIMESTAMP())`
+	_, err = db.Exec(stmt, user.Name, hashedPassword, role)
 	if err != nil {
 		if err.(*mysql.MySQLError).Number == 1062 {
 			return ErrDuplicateName
@@ -103,8 +113,8 @@ func (db *Database) VerifyUser(name, password string) (int, error) {
 
 func (db *Database) UserInfo(userID int) (*User, error) {
 	user := &User{}
-	row := db.QueryRow("SELECT id, name FROM users WHERE id = ?", userID)
-	err := row.Scan(&user.ID, &user.Name)
+	row := db.QueryRow("SELECT id, name, role, IFNULL(team_id, 0) FROM users WHERE id = ?", userID)
+	err := row.Scan(&user.ID, &user.Name, &user.Role, &user.TeamID)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -112,3 +122,39 @@ func (db *Database) UserInfo(userID int) (*User, error) {
 	}
 	return user, nil
 }
+
+// SetUserTeam puts the user with a name in a team, or in none with 0.
+func (db *Database) SetUserTeam(username string, teamID int) error {
+	result, err := db.Exec(`UPDATE users SET team_id = NULLIF(?, 0) WHERE name = ?`, teamID, username)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	log.Printf("SetUserTeam %d Rows Affected", rowsAffected)
+
+	return nil
+}
+
+// SetUserRole changes the role of the user with a name to one of Roles.
+func (db *Database) SetUserRole(username string, role string) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+
+	result, err := db.Exec(`UPDATE users SET role = ? WHERE name = ?`, role, username)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	log.Printf("SetUserRole %d Rows Affected", rowsAffected)
+
+	return nil
+}
@@ -38,14 +38,22 @@ func (db *Database) ListDistinctDate() ([]string, error) {
 func (db *Database) ListWorksheets(q *forms.Query) (Worksheets, *PageInfo, error) {
 	pageInfo := &PageInfo{MaxResults: q.MaxResults}
 	countStmt := "SELECT count(w.id) "
-	selectStmt := "SELECT w.id, w.number, w.name, w.created, z.id zone_id, z.name zone_name, t.id team_id, t.name team_name "
+	selectStmt := "SELECT w.id, w.number, w.name, w.created, z.id zone_id, z.name zone_name, t.id team_id, t.name team_name, IFNULL(b.id, 0), IFNULL(b.code, ''), IFNULL(b.name, ''), w.status, " + slotsFilled + ", " + slotsRequired + " "
 	stmt := ` FROM worksheets w 
 	INNER JOIN zones z on (w.zone_id = z.id) 
-	INNER JOIN teams t on (w.team_id = t.id) `
+	INNER JOIN teams t on (w.team_id = t.id) 
+	LEFT JOIN boards b on (w.board_id = b.id) `
 
 	params := []interface{}{}
 
-	stmt += " ORDER BY w.created DESC"
+	stmt += " WHERE 1 = 1"
+	if q.Status != "" {
+		stmt += " AND w.status = ?"
+		params = append(params, q.Status)
+	}
+	if q.Incomplete {
+		stmt += " AND " + slotsFilled + " < " + slotsRequired
+	}
 
 	row := db.QueryRow(countStmt+stmt, params...)
 	err := row.Scan(&pageInfo.TotalResults)
@@ -53,10 +61,10 @@ func (db *Database) ListWorksheets(q *forms.Query) (Worksheets, *PageInfo, error
 		return nil, nil, err
 	}
 
-	if q.MaxResults > -1 {
-		stmt += " LIMIT ? OFFSET ?"
-		params = append(params, q.MaxResults, q.Start)
-	}
+	where, keyParams, order := keyset(q, "w.created", "w.id", true)
+	limitStmt, limitParams := limit(q)
+	stmt += where + order + limitStmt
+	params = append(append(params, keyParams...), limitParams...)
 
 	rows, err := db.Query(selectStmt+stmt, params...)
 	if err != nil {
@@ -68,7 +76,7 @@ func (db *Database) ListWorksheets(q *forms.Query) (Worksheets, *PageInfo, error
 	worksheets := Worksheets{}
 	for rows.Next() {
 		p := &Worksheet{}
-		rows.Scan(&p.ID, &p.Number, &p.Name, &p.Created, &p.ZoneID, &p.ZoneName, &p.TeamID, &p.TeamName)
+		rows.Scan(&p.ID, &p.Number, &p.Name, &p.Created, &p.ZoneID, &p.ZoneName, &p.TeamID, &p.TeamName, &p.BoardID, &p.BoardCode, &p.BoardName, &p.Status, &p.SlotsFilled, &p.SlotsRequired)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -79,6 +87,15 @@ func (db *Database) ListWorksheets(q *forms.Query) (Worksheets, *PageInfo, error
 		return nil, nil, err
 	}
 
+	page, more := pageRows(q, worksheets)
+	worksheets = page.(Worksheets)
+	if len(worksheets) > 0 {
+		first, last := worksheets[0], worksheets[len(worksheets)-1]
+		pageInfo.ConfigCursors(q, more,
+			&Cursor{Key: first.Created.Format(keyTime), ID: first.ID},
+			&Cursor{Key: last.Created.Format(keyTime), ID: last.ID})
+	}
+
 	return worksheets, pageInfo, nil
 }
 
@@ -189,15 +206,112 @@ func (db *Database) ListWorksheetsByTeam(teamID int) (Worksheets, error) {
 	return worksheets, nil
 }
 
-func (db *Database) GetWorksheet(id int) (*Worksheet, error) {
-	stmt := `SELECT w.id, w.number, w.name, w.created, z.id zone_id, z.name zone_name, t.id team_id, t.name team_name FROM worksheets w 
+// ListCampaigns returns the campaigns worksheets were created for.
+func (db *Database) ListCampaigns() ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT campaign FROM worksheets WHERE campaign <> '' ORDER BY campaign`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []string{}
+	for rows.Next() {
+		var campaign string
+		if err := rows.Scan(&campaign); err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+// ListWorksheetsByCampaign returns the worksheets of a campaign with their
+// zone, team and board, oldest first.
+func (db *Database) ListWorksheetsByCampaign(campaign string) (Worksheets, error) {
+	rows, err := db.Query(`SELECT `+worksheetColumns+worksheetFrom+`
+	WHERE w.campaign = ? ORDER BY w.created, w.id`, campaign)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	worksheets := Worksheets{}
+	for rows.Next() {
+		p, err := scanWorksheet(rows)
+		if err != nil {
+			return nil, err
+		}
+		worksheets = append(worksheets, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return worksheets, nil
+}
+
+// ListWorksheetsByFilter returns the worksheets selected by f with their
+// zone, team and board, by number.
+func (db *Database) ListWorksheetsByFilter(f *forms.PhotoFilter) (Worksheets, error) {
+	where, params := worksheetFilter(f)
+	rows, err := db.Query(`SELECT `+worksheetColumns+worksheetFrom+`
+	WHERE 1 = 1`+where+` ORDER BY w.number, w.id`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	worksheets := Worksheets{}
+	for rows.Next() {
+		p, err := scanWorksheet(rows)
+		if err != nil {
+			return nil, err
+		}
+		worksheets = append(worksheets, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return worksheets, nil
+}
+
+const worksheetColumns = `w.id, w.number, w.name, w.campaign, w.created, z.id zone_id, z.name zone_name, t.id team_id, t.name team_name,
+	IFNULL(b.id, 0), IFNULL(b.code, ''), IFNULL(b.name, ''), w.lat, w.lng, w.status`
+
+const worksheetFrom = ` FROM worksheets w 
 	INNER JOIN zones z on (w.zone_id = z.id) 
 	INNER JOIN teams t on (w.team_id = t.id) 
-	WHERE w.id = ?`
-	row := db.QueryRow(stmt, id)
+	LEFT JOIN boards b on (w.board_id = b.id)`
 
+func scanWorksheet(row interface{ Scan(...interface{}) error }) (*Worksheet, error) {
 	p := &Worksheet{}
-	err := row.Scan(&p.ID, &p.Number, &p.Name, &p.Created, &p.ZoneID, &p.ZoneName, &p.TeamID, &p.TeamName)
+	var lat, lng sql.NullFloat64
+	err := row.Scan(&p.ID, &p.Number, &p.Name, &p.Campaign, &p.Created, &p.ZoneID, &p.ZoneName, &p.TeamID, &p.TeamName, &p.BoardID, &p.BoardCode, &p.BoardName, &lat, &lng, &p.Status)
+	if err != nil {
+		return nil, err
+	}
+	p.Location = nullLocation(lat, lng)
+	return p, nil
+}
+
+func (db *Database) GetWorksheet(id int) (*Worksheet, error) {
+	stmt := `SELECT ` + worksheetColumns + worksheetFrom + ` WHERE w.id = ?`
+	p, err := scanWorksheet(db.QueryRow(stmt, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// GetWorksheetByNumber returns the worksheet with a number, or nil.
+func (db *Database) GetWorksheetByNumber(number string) (*Worksheet, error) {
+	stmt := `SELECT ` + worksheetColumns + worksheetFrom + ` WHERE w.number = ?`
+	p, err := scanWorksheet(db.QueryRow(stmt, number))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -208,8 +322,15 @@ func (db *Database) GetWorksheet(id int) (*Worksheet, error) {
 }
 
 func (db *Database) InsertWorksheet(worksheet *Worksheet) error {
-	stmt := `INSERT INTO worksheets (number, name, zone_id, team_id, created) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`
-	result, err := db.Exec(stmt, worksheet.Number, worksheet.Name, worksheet.ZoneID, worksheet.TeamID)
+	return db.change(func(tx *sql.Tx) error {
+		return insertWorksheet(tx, worksheet)
+	})
+}
+
+func insertWorksheet(ex execer, worksheet *Worksheet) error {
+	lat, lng := worksheet.nullLocation()
+	stmt := `INSERT INTO worksheets (number, name, campaign, zone_id, team_id, board_id, lat, lng, geohash, created, updated, seq) VALUES (?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(6), ` + changeSeq + `)`
+	result, err := ex.Exec(stmt, worksheet.Number, worksheet.Name, worksheet.Campaign, worksheet.ZoneID, worksheet.TeamID, worksheet.BoardID, lat, lng, geohash(worksheet.Location))
 	if err != nil {
 		return err
 	}
@@ -222,20 +343,55 @@ func (db *Database) InsertWorksheet(worksheet *Worksheet) error {
 	return err
 }
 
+// UpdateWorksheet saves a worksheet. When it goes to another team its
+// photos go along to the sync clients of that team, and leave those of the
+// team it had.
 func (db *Database) UpdateWorksheet(worksheet *Worksheet) error {
-	stmt := `UPDATE worksheets SET number = ?, name = ?, zone_id = ?, team_id = ? WHERE id = ?`
-	_, err := db.Exec(stmt, worksheet.Number, worksheet.Name, worksheet.ZoneID, worksheet.TeamID, worksheet.ID)
-	if err != nil {
+	return db.change(func(tx *sql.Tx) error {
+		var teamID int
+		err := tx.QueryRow(`SELECT team_id FROM worksheets WHERE id = ? FOR UPDATE`, worksheet.ID).Scan(&teamID)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		lat, lng := worksheet.nullLocation()
+		stmt := `UPDATE worksheets SET number = ?, name = ?, campaign = ?, zone_id = ?, team_id = ?, board_id = NULLIF(?, 0), lat = ?, lng = ?, geohash = ?, updated = UTC_TIMESTAMP(6), seq = ` + changeSeq + ` WHERE id = ?`
+		_, err = tx.Exec(stmt, worksheet.Number, worksheet.Name, worksheet.Campaign, worksheet.ZoneID, worksheet.TeamID, worksheet.BoardID, lat, lng, geohash(worksheet.Location), worksheet.ID)
+		if err != nil {
+			return err
+		}
+
+		if teamID == worksheet.TeamID {
+			return nil
+		}
+		if err := leaveTeam(tx, worksheet.ID, teamID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE photos SET seq = `+changeSeq+` WHERE worksheet_id = ?`, worksheet.ID)
 		return err
-	}
-	return nil
+	})
 }
 
+// DeleteWorksheet deletes a worksheet with its photos.
 func (db *Database) DeleteWorksheet(worksheetID int) error {
-	stmt := `DELETE FROM worksheets WHERE id = ?`
-	_, err := db.Exec(stmt, worksheetID)
-	if err != nil {
-		return err
+	return db.change(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO deletions (entity, entity_id, deleted, seq)
+		SELECT ?, id, UTC_TIMESTAMP(6), `+changeSeq+` FROM photos WHERE worksheet_id = ?`, EntityPhotos, worksheetID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM photos WHERE worksheet_id = ?`, worksheetID); err != nil {
+			return err
+		}
+		return deleteWithTombstone(tx, EntityWorksheets, worksheetID)
+	})
+}
+
+func (worksheet *Worksheet) nullLocation() (lat, lng interface{}) {
+	if worksheet.Location == nil {
+		return nil, nil
 	}
-	return nil
+	return worksheet.Location.Lat, worksheet.Location.Lng
 }
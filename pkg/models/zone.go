@@ -1,9 +1,35 @@
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"gitlab.com/code-mobi/board-checker/pkg/forms"
+	"gitlab.com/code-mobi/board-checker/pkg/geo"
+)
+
+const zoneColumns = `id, name, boundary, created, updated`
+
+func scanZone(row interface{ Scan(...interface{}) error }) (*Zone, error) {
+	t := &Zone{}
+	var boundary sql.NullString
+	err := row.Scan(&t.ID, &t.Name, &boundary, &t.Created, &t.Updated)
+	if err != nil {
+		return nil, err
+	}
+	if boundary.Valid {
+		features, err := geo.ParseGeoJSON([]byte(boundary.String))
+		if err != nil {
+			return nil, err
+		}
+		t.Boundary = features[0].Boundary
+	}
+	return t, nil
+}
 
 func (db *Database) ListZones() (Zones, error) {
-	stmt := `SELECT id, name FROM zones ORDER BY name`
+	stmt := `SELECT ` + zoneColumns + ` FROM zones ORDER BY name`
 	rows, err := db.Query(stmt)
 	if err != nil {
 		return nil, err
@@ -13,8 +39,7 @@ func (db *Database) ListZones() (Zones, error) {
 
 	zones := Zones{}
 	for rows.Next() {
-		t := &Zone{}
-		rows.Scan(&t.ID, &t.Name)
+		t, err := scanZone(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -28,12 +53,52 @@ func (db *Database) ListZones() (Zones, error) {
 	return zones, nil
 }
 
-func (db *Database) GetZone(id int) (*Zone, error) {
-	stmt := `SELECT id, name FROM zones WHERE id = ?`
-	row := db.QueryRow(stmt, id)
+func (db *Database) ListZonesPaged(q *forms.Query) (Zones, *PageInfo, error) {
+	pageInfo := &PageInfo{MaxResults: q.MaxResults}
+	row := db.QueryRow(`SELECT count(id) FROM zones`)
+	err := row.Scan(&pageInfo.TotalResults)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	t := &Zone{}
-	err := row.Scan(&t.ID, &t.Name)
+	where, params, order := keyset(q, "name", "id", false)
+	limitStmt, limitParams := limit(q)
+	stmt := `SELECT ` + zoneColumns + ` FROM zones WHERE 1 = 1` + where + order + limitStmt
+	params = append(params, limitParams...)
+
+	rows, err := db.Query(stmt, params...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	zones := Zones{}
+	for rows.Next() {
+		t, err := scanZone(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		zones = append(zones, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	page, more := pageRows(q, zones)
+	zones = page.(Zones)
+	if len(zones) > 0 {
+		first, last := zones[0], zones[len(zones)-1]
+		pageInfo.ConfigCursors(q, more, &Cursor{Key: first.Name, ID: first.ID}, &Cursor{Key: last.Name, ID: last.ID})
+	}
+
+	return zones, pageInfo, nil
+}
+
+func (db *Database) GetZone(id int) (*Zone, error) {
+	stmt := `SELECT ` + zoneColumns + ` FROM zones WHERE id = ?`
+	t, err := scanZone(db.QueryRow(stmt, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -44,19 +109,245 @@ func (db *Database) GetZone(id int) (*Zone, error) {
 }
 
 func (db *Database) InsertZone(zone *Zone) error {
-	stmt := `INSERT INTO zones (name) VALUES (?)`
-	_, err := db.Exec(stmt, zone.Name)
+	return db.change(func(tx *sql.Tx) error {
+		return insertZone(tx, zone)
+	})
+}
+
+func insertZone(ex execer, zone *Zone) error {
+	stmt := `INSERT INTO zones (name, created, updated, seq) VALUES (?, UTC_TIMESTAMP(), UTC_TIMESTAMP(6), ` + changeSeq + `)`
+	result, err := ex.Exec(stmt, zone.Name)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
 		return err
 	}
+	zone.ID = int(id)
 	return nil
 }
 
 func (db *Database) UpdateZone(zone *Zone) error {
-	stmt := `UPDATE zones SET name = ? WHERE id = ?`
-	_, err := db.Exec(stmt, zone.Name, zone.ID)
+	stmt := `UPDATE zones SET name = ?, updated = UTC_TIMESTAMP(6), seq = ` + changeSeq + ` WHERE id = ?`
+	_, err := db.execChange(stmt, zone.Name, zone.ID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// SetZoneBoundary replaces the boundary of a zone. An empty boundary
+// removes it. The bounding box is kept alongside so lookups can skip zones
+// that are nowhere near a point.
+func (db *Database) SetZoneBoundary(zoneID int, boundary geo.MultiPolygon) error {
+	if len(boundary) == 0 {
+		_, err := db.execChange(`UPDATE zones SET boundary = NULL, min_lat = NULL, min_lng = NULL, max_lat = NULL, max_lng = NULL,
+		updated = UTC_TIMESTAMP(6), seq = `+changeSeq+` WHERE id = ?`, zoneID)
+		return err
+	}
+
+	b, err := json.Marshal(boundary)
+	if err != nil {
+		return err
+	}
+	minLat, minLng, maxLat, maxLng := boundary.Bounds()
+	_, err = db.execChange(`UPDATE zones SET boundary = ?, min_lat = ?, min_lng = ?, max_lat = ?, max_lng = ?,
+	updated = UTC_TIMESTAMP(6), seq = `+changeSeq+` WHERE id = ?`, string(b), minLat, minLng, maxLat, maxLng, zoneID)
+	return err
+}
+
+// At returns the zone whose boundary contains the point. Where boundaries
+// overlap the smallest zone wins.
+func (zones Zones) At(lat, lng float64) *Zone {
+	var found *Zone
+	for _, zone := range zones {
+		if !zone.Boundary.Contains(lat, lng) {
+			continue
+		}
+		if found == nil || zone.Boundary.Area() < found.Boundary.Area() {
+			found = zone
+		}
+	}
+	return found
+}
+
+// ZoneAt returns the zone containing the point, or nil if no boundary
+// does.
+func (db *Database) ZoneAt(lat, lng float64) (*Zone, error) {
+	rows, err := db.Query(`SELECT `+zoneColumns+` FROM zones
+	WHERE boundary IS NOT NULL AND ? BETWEEN min_lat AND max_lat AND ? BETWEEN min_lng AND max_lng`, lat, lng)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := Zones{}
+	for rows.Next() {
+		t, err := scanZone(rows)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return zones.At(lat, lng), nil
+}
+
+// LocateZone returns the zone of a location, falling back to the location
+// of the board when there is none. It returns nil when neither is known or
+// no boundary contains them.
+func (db *Database) LocateZone(location *Location, boardID int) (*Zone, error) {
+	if location == nil && boardID != 0 {
+		board, err := db.GetBoard(boardID)
+		if err != nil {
+			return nil, err
+		}
+		if board != nil {
+			location = board.location()
+		}
+	}
+	if location == nil {
+		return nil, nil
+	}
+	return db.ZoneAt(location.Lat, location.Lng)
+}
+
+// ZoneImport is the outcome of importing one named boundary.
+type ZoneImport struct {
+	Name    string `json:"name"`
+	ZoneID  int    `json:"zoneID"`
+	Created bool   `json:"created"`
+	Skipped bool   `json:"skipped"`
+}
+
+// ImportZoneBoundaries sets the boundary of each zone named by a feature.
+// Features sharing a name are merged. Features naming no zone create one
+// when create is set and are skipped otherwise, as are unnamed features.
+// With dryRun nothing is written.
+func (db *Database) ImportZoneBoundaries(features []geo.Feature, create, dryRun bool) ([]*ZoneImport, error) {
+	names := []string{}
+	boundaries := map[string]geo.MultiPolygon{}
+	for _, feature := range features {
+		key := strings.ToLower(feature.Name)
+		if _, ok := boundaries[key]; !ok {
+			names = append(names, feature.Name)
+		}
+		boundaries[key] = append(boundaries[key], feature.Boundary...)
+	}
+
+	results := []*ZoneImport{}
+	for _, name := range names {
+		result := &ZoneImport{Name: name}
+		results = append(results, result)
+		if name == "" {
+			result.Skipped = true
+			continue
+		}
+
+		err := db.QueryRow(`SELECT id FROM zones WHERE name = ? ORDER BY id LIMIT 1`, name).Scan(&result.ZoneID)
+		if err == sql.ErrNoRows {
+			if !create {
+				result.Skipped = true
+				continue
+			}
+			result.Created = true
+		} else if err != nil {
+			return nil, err
+		}
+		if dryRun {
+			continue
+		}
+
+		if result.Created {
+			zone := &Zone{Name: name}
+			if err := db.InsertZone(zone); err != nil {
+				return nil, err
+			}
+			result.ZoneID = zone.ID
+		}
+		err = db.SetZoneBoundary(result.ZoneID, boundaries[strings.ToLower(name)])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// ZoneOutlier is a photo taken outside the zone of its worksheet. TakenIn
+// is the zone it was taken in, if any.
+type ZoneOutlier struct {
+	Photo     *Photo
+	Worksheet *Worksheet
+	TakenIn   *Zone
+}
+
+// ListZoneOutliers returns the photos whose GPS position lies outside the
+// boundary of their worksheet's zone, limited to one zone unless zoneID is
+// 0. Zones without a boundary are not checked.
+func (db *Database) ListZoneOutliers(zoneID int) ([]*ZoneOutlier, error) {
+	zones, err := db.ListZones()
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]*Zone{}
+	for _, zone := range zones {
+		byID[zone.ID] = zone
+	}
+
+	stmt := `SELECT ` + photoColumns + ` FROM photos WHERE lat IS NOT NULL AND worksheet_id IN (
+		SELECT w.id FROM worksheets w INNER JOIN zones z on (w.zone_id = z.id) WHERE z.boundary IS NOT NULL`
+	params := []interface{}{}
+	if zoneID != 0 {
+		stmt += ` AND z.id = ?`
+		params = append(params, zoneID)
+	}
+	stmt += `) ORDER BY worksheet_id, running_number`
+
+	rows, err := db.Query(stmt, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := Photos{}
+	for rows.Next() {
+		f, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	outliers := []*ZoneOutlier{}
+	worksheets := map[int]*Worksheet{}
+	for _, f := range photos {
+		worksheet, ok := worksheets[f.WorksheetID]
+		if !ok {
+			worksheet, err = db.GetWorksheet(f.WorksheetID)
+			if err != nil {
+				return nil, err
+			}
+			worksheets[f.WorksheetID] = worksheet
+		}
+		if worksheet == nil {
+			continue
+		}
+		zone := byID[worksheet.ZoneID]
+		if zone == nil || zone.Boundary.Contains(f.GPS.Lat, f.GPS.Lng) {
+			continue
+		}
+		outliers = append(outliers, &ZoneOutlier{
+			Photo:     f,
+			Worksheet: worksheet,
+			TakenIn:   zones.At(f.GPS.Lat, f.GPS.Lng),
+		})
+	}
+	return outliers, nil
+}
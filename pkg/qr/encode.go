@@ -0,0 +1,56 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Error correction levels, from the smallest code to the one that survives
+// the most damage, such as a dirty or torn sticker.
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// DefaultLevel recovers from 15% of the code being damaged.
+const DefaultLevel = qrcode.Medium
+
+// ParseLevel returns the error correction level named L, M, Q or H.
+func ParseLevel(name string) (qrcode.RecoveryLevel, bool) {
+	level, ok := levels[strings.ToUpper(name)]
+	return level, ok
+}
+
+// PNG encodes text as a QR code PNG of size pixels square.
+func PNG(text string, level qrcode.RecoveryLevel, size int) ([]byte, error) {
+	return qrcode.Encode(text, level, size)
+}
+
+// SVG encodes text as a QR code SVG of size pixels square, drawn as one
+// path so that it scales without blurring.
+func SVG(text string, level qrcode.RecoveryLevel, size int) ([]byte, error) {
+	q, err := qrcode.New(text, level)
+	if err != nil {
+		return nil, err
+	}
+	bitmap := q.Bitmap()
+	n := len(bitmap)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
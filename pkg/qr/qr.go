@@ -0,0 +1,93 @@
+// Package qr draws the worksheet and board QR codes stuck on boards, and
+// reads them back from photos.
+package qr
+
+import (
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// ErrNotFound is returned when an image holds no readable QR code.
+var ErrNotFound = errors.New("qr: no QR code found")
+
+// Decode returns the text of the QR code in img.
+func Decode(img image.Image) (string, error) {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", err
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, hints)
+	if err != nil {
+		return "", ErrNotFound
+	}
+	return result.GetText(), nil
+}
+
+// DecodeFile returns the text of the QR code in a JPEG or PNG file.
+func DecodeFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+	return Decode(img)
+}
+
+var (
+	rxWorksheetPath = regexp.MustCompile(`/worksheet/([0-9]+)/?$`)
+	rxTokenPath     = regexp.MustCompile(`/q/([^/]+)$`)
+)
+
+// Reader tells which worksheet the QR code in a photo names.
+type Reader struct {
+	Signer Signer
+
+	// LegacyIDs accepts the unsigned codes printed before /q/{token} URLs:
+	// a bare ID, as /createqr/{id} encodes, or a URL of the worksheet
+	// page. Anyone can make those for any worksheet.
+	LegacyIDs bool
+}
+
+// WorksheetID returns the worksheet a QR code text names: a /q/{token} URL
+// of a worksheet whose signature is right, or a legacy code when they are
+// accepted.
+func (r Reader) WorksheetID(text string) (int, bool) {
+	text = strings.TrimSpace(text)
+	if id, err := strconv.Atoi(text); err == nil {
+		return id, r.LegacyIDs && id > 0
+	}
+	u, err := url.Parse(text)
+	if err != nil {
+		return 0, false
+	}
+	if m := rxTokenPath.FindStringSubmatch(u.Path); m != nil {
+		kind, id, ok := r.Signer.Parse(m[1])
+		if !ok || kind != KindWorksheet {
+			return 0, false
+		}
+		return id, true
+	}
+	m := rxWorksheetPath.FindStringSubmatch(u.Path)
+	if m == nil || !r.LegacyIDs {
+		return 0, false
+	}
+	id, _ := strconv.Atoi(m[1])
+	return id, id > 0
+}
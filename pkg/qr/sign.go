@@ -0,0 +1,68 @@
+package qr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// Kinds of things a signed QR code opens.
+const (
+	KindWorksheet = "w"
+	KindBoard     = "b"
+)
+
+// Signer makes and checks the tokens of /q/{token} URLs. A token names a
+// worksheet or board and carries a signature, so that a QR code cannot be
+// made for another one without the key.
+type Signer struct {
+	Key []byte
+}
+
+// sigBytes is how much of the HMAC a token keeps; 96 bits are plenty
+// against guessing and keep the QR code small.
+const sigBytes = 12
+
+// Token returns the token of the worksheet or board with id, such as
+// w42.Xq3bY0oaEF1sPu0h.
+func (s Signer) Token(kind string, id int) string {
+	payload := kind + strconv.Itoa(id)
+	return payload + "." + s.sign(payload)
+}
+
+// Parse returns what a token names when its signature is right.
+func (s Signer) Parse(token string) (kind string, id int, ok bool) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return "", 0, false
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return "", 0, false
+	}
+	kind, id, ok = parsePayload(payload)
+	return kind, id, ok
+}
+
+func (s Signer) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte("qr:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:sigBytes])
+}
+
+func parsePayload(payload string) (kind string, id int, ok bool) {
+	if len(payload) < 2 {
+		return "", 0, false
+	}
+	kind = payload[:1]
+	if kind != KindWorksheet && kind != KindBoard {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(payload[1:])
+	if err != nil || id <= 0 {
+		return "", 0, false
+	}
+	return kind, id, true
+}
@@ -0,0 +1,360 @@
+// Package report writes proof of inspection documents: PDFs showing the
+// details of worksheets, a map of where their photos were taken and the
+// photos themselves.
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/staticmap"
+	"gitlab.com/code-mobi/board-checker/pkg/store"
+	"gitlab.com/code-mobi/board-checker/pkg/tiles"
+)
+
+// Page layout of A4 portrait in millimetres.
+const (
+	pageWidth    = 210.0
+	pageHeight   = 297.0
+	margin       = 15.0
+	contentWidth = pageWidth - 2*margin
+
+	mapHeight       = 95.0
+	pixelsPerMM     = 4
+	photoWidth      = (contentWidth - 6) / 2
+	photoHeight     = 62.0
+	captionHeight   = 14.0
+	photoCellHeight = photoHeight + captionHeight + 4
+)
+
+// Inspection is a worksheet to report on with the place its photos should
+// be taken, its photos and its QR code as a PNG.
+type Inspection struct {
+	Worksheet *models.Worksheet
+	Expected  *models.Location
+	Photos    []*models.TakenPhoto
+	QR        []byte
+}
+
+// Report writes inspections as a PDF.
+type Report struct {
+	Store *store.Store
+
+	// Tiles, if set, are drawn under the photo maps.
+	Tiles *tiles.MBTiles
+
+	// Radius is the geofence radius in metres drawn around the expected
+	// location.
+	Radius float64
+
+	// Font is a TrueType font file for text outside Latin-1, such as Thai.
+	// Without one the core Helvetica font is used.
+	Font string
+
+	pdf *gofpdf.Fpdf
+	tr  func(string) string
+}
+
+// Write writes the PDF of the inspections. Several inspections start with
+// a contents page titled title.
+func (rep *Report) Write(w io.Writer, title string, inspections []*Inspection) error {
+	rep.pdf = gofpdf.New("P", "mm", "A4", "")
+	pdf := rep.pdf
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("Board Checker", true)
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(false, margin)
+	pdf.AliasNbPages("")
+
+	if rep.Font != "" {
+		pdf.AddUTF8Font("report", "", rep.Font)
+		pdf.AddUTF8Font("report", "B", rep.Font)
+		rep.tr = func(s string) string { return s }
+	} else {
+		rep.tr = pdf.UnicodeTranslatorFromDescriptor("")
+	}
+
+	footer := title
+	pdf.SetFooterFunc(func() {
+		pdf.SetXY(margin, pageHeight-margin+4)
+		rep.font("", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(contentWidth/2, 4, rep.tr(footer), "", 0, "L", false, 0, "")
+		pdf.CellFormat(contentWidth/2, 4, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+
+	if len(inspections) != 1 {
+		rep.contents(title, inspections)
+	}
+	for _, inspection := range inspections {
+		footer = "Worksheet " + inspection.Worksheet.Number
+		rep.inspection(inspection)
+		if err := pdf.Error(); err != nil {
+			return err
+		}
+	}
+	return pdf.Output(w)
+}
+
+func (rep *Report) font(style string, size float64) {
+	if rep.Font != "" {
+		rep.pdf.SetFont("report", style, size)
+	} else {
+		rep.pdf.SetFont("Helvetica", style, size)
+	}
+}
+
+// contents lists the inspections of a batch.
+func (rep *Report) contents(title string, inspections []*Inspection) {
+	pdf := rep.pdf
+	pdf.AddPage()
+	rep.font("B", 16)
+	pdf.CellFormat(contentWidth, 10, rep.tr(title), "", 1, "L", false, 0, "")
+	rep.font("", 10)
+	pdf.CellFormat(contentWidth, 6, rep.tr(fmt.Sprintf("%d worksheets, generated %s", len(inspections), time.Now().Format("2006-01-02 15:04"))), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	widths := []float64{35, 65, 30, 30, 20}
+	rep.font("B", 10)
+	pdf.SetFillColor(230, 230, 230)
+	for i, heading := range []string{"Number", "Name", "Zone", "Team", "Photos"} {
+		pdf.CellFormat(widths[i], 7, heading, "1", 0, "L", true, 0, "")
+	}
+	pdf.Ln(-1)
+	rep.font("", 9)
+	for _, inspection := range inspections {
+		if pdf.GetY()+6 > pageHeight-margin {
+			pdf.AddPage()
+		}
+		ws := inspection.Worksheet
+		for i, text := range []string{ws.Number, ws.Name, ws.ZoneName, ws.TeamName, strconv.Itoa(len(inspection.Photos))} {
+			pdf.CellFormat(widths[i], 6, rep.fit(text, widths[i]-2), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+// inspection writes the pages of one worksheet.
+func (rep *Report) inspection(inspection *Inspection) {
+	pdf := rep.pdf
+	ws := inspection.Worksheet
+	pdf.AddPage()
+
+	rep.font("B", 16)
+	pdf.CellFormat(contentWidth-40, 10, "Proof of Inspection", "", 1, "L", false, 0, "")
+	if len(inspection.QR) > 0 {
+		name := "qr-" + strconv.Itoa(ws.ID)
+		pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(inspection.QR))
+		pdf.ImageOptions(name, pageWidth-margin-35, margin, 35, 35, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+	}
+
+	within, outside, missing := 0, 0, 0
+	for _, p := range inspection.Photos {
+		switch p.Photo.Geofence {
+		case models.GeofenceWithin:
+			within++
+		case models.GeofenceOutside:
+			outside++
+		case models.GeofenceMissing:
+			missing++
+		}
+	}
+	board := ""
+	if ws.BoardID != 0 {
+		board = ws.BoardCode + " " + ws.BoardName
+	}
+	expected := "-"
+	if inspection.Expected != nil {
+		expected = fmt.Sprintf("%.6f, %.6f", inspection.Expected.Lat, inspection.Expected.Lng)
+	}
+	details := [][2]string{
+		{"Worksheet", ws.Number},
+		{"Name", ws.Name},
+		{"Zone", ws.ZoneName},
+		{"Team", ws.TeamName},
+		{"Board", board},
+		{"Created", ws.Created.Format("2006-01-02 15:04")},
+		{"Location", expected},
+		{"Photos", fmt.Sprintf("%d (%d within, %d outside, %d without GPS)", len(inspection.Photos), within, outside, missing)},
+	}
+	for _, row := range details {
+		rep.font("B", 10)
+		pdf.CellFormat(30, 6, row[0], "", 0, "L", false, 0, "")
+		rep.font("", 10)
+		pdf.CellFormat(contentWidth-70, 6, rep.fit(row[1], contentWidth-72), "", 1, "L", false, 0, "")
+	}
+
+	y := math.Max(pdf.GetY(), margin+40) + 4
+	rep.photoMap(inspection, margin, y, contentWidth, mapHeight)
+	y += mapHeight + 6
+
+	for i, p := range inspection.Photos {
+		column := i % 2
+		if column == 0 && y+photoCellHeight > pageHeight-margin {
+			pdf.AddPage()
+			y = margin
+		}
+		rep.photo(p, margin+float64(column)*(photoWidth+6), y)
+		if column == 1 {
+			y += photoCellHeight
+		}
+	}
+}
+
+// photoMap draws where the photos were taken, numbered by running number,
+// around the expected location and its geofence.
+func (rep *Report) photoMap(inspection *Inspection, x, y, w, h float64) {
+	pdf := rep.pdf
+	locations := []*models.Location{}
+	if inspection.Expected != nil {
+		locations = append(locations, inspection.Expected)
+	}
+	for _, p := range inspection.Photos {
+		if p.Photo.GPS != nil {
+			locations = append(locations, p.Photo.GPS)
+		}
+	}
+
+	pdf.SetDrawColor(160, 160, 160)
+	pdf.SetFillColor(242, 239, 233)
+	pdf.Rect(x, y, w, h, "FD")
+	if len(locations) == 0 {
+		rep.font("", 10)
+		pdf.SetXY(x, y+h/2-3)
+		pdf.CellFormat(w, 6, "No photo locations", "", 0, "C", false, 0, "")
+		return
+	}
+
+	maxZoom := 18
+	if rep.Tiles != nil {
+		maxZoom = rep.Tiles.MaxZoom()
+	}
+	view := staticmap.Fit(locations, int(w*pixelsPerMM), int(h*pixelsPerMM), maxZoom)
+	if background := view.Render(rep.Tiles); background != nil {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, background); err == nil {
+			name := "map-" + strconv.Itoa(inspection.Worksheet.ID)
+			pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "PNG"}, buf)
+			pdf.ImageOptions(name, x, y, w, h, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+		}
+	}
+	at := func(l *models.Location) (float64, float64) {
+		px, py := view.Pixel(l)
+		return x + px/pixelsPerMM, y + py/pixelsPerMM
+	}
+
+	pdf.ClipRect(x, y, w, h, false)
+	if e := inspection.Expected; e != nil {
+		ex, ey := at(e)
+		pdf.SetDrawColor(200, 40, 40)
+		pdf.SetLineWidth(0.4)
+		if rep.Radius > 0 {
+			pdf.SetAlpha(0.15, "Normal")
+			pdf.SetFillColor(200, 40, 40)
+			pdf.Circle(ex, ey, rep.Radius/view.MetresPerPixel(e.Lat)/pixelsPerMM, "FD")
+			pdf.SetAlpha(1, "Normal")
+		}
+		pdf.Line(ex-2, ey-2, ex+2, ey+2)
+		pdf.Line(ex-2, ey+2, ex+2, ey-2)
+	}
+
+	rep.font("B", 6)
+	pdf.SetLineWidth(0.2)
+	for _, p := range inspection.Photos {
+		if p.Photo.GPS == nil {
+			continue
+		}
+		px, py := at(p.Photo.GPS)
+		if p.Photo.Geofence == models.GeofenceOutside {
+			pdf.SetFillColor(220, 120, 20)
+		} else {
+			pdf.SetFillColor(40, 90, 200)
+		}
+		pdf.SetDrawColor(255, 255, 255)
+		pdf.Circle(px, py, 2.2, "FD")
+		pdf.SetTextColor(255, 255, 255)
+		pdf.SetXY(px-2.2, py-2.2)
+		pdf.CellFormat(4.4, 4.4, strconv.Itoa(p.Photo.RunningNumber), "", 0, "C", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	}
+	pdf.ClipEnd()
+
+	if rep.Tiles != nil {
+		if attribution := rep.Tiles.Metadata["attribution"]; attribution != "" && !strings.Contains(attribution, "<") {
+			rep.font("", 6)
+			pdf.SetXY(x, y+h-4)
+			pdf.CellFormat(w-1, 4, rep.tr(attribution), "", 0, "R", false, 0, "")
+		}
+	}
+	pdf.SetDrawColor(0, 0, 0)
+}
+
+// photo draws a photo with its running number, capture time, GPS position
+// and caption.
+func (rep *Report) photo(p *models.TakenPhoto, x, y float64) {
+	pdf := rep.pdf
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.Rect(x, y, photoWidth, photoHeight, "D")
+
+	path, err := rep.Store.Thumbnail(p.Photo, 640)
+	if err == nil {
+		options := gofpdf.ImageOptions{ImageType: "JPG"}
+		info := pdf.RegisterImageOptions(path, options)
+		if info != nil && pdf.Error() == nil {
+			iw, ih := info.Width(), info.Height()
+			scale := math.Min(photoWidth/iw, photoHeight/ih)
+			iw, ih = iw*scale, ih*scale
+			pdf.ImageOptions(path, x+(photoWidth-iw)/2, y+(photoHeight-ih)/2, iw, ih, false, options, 0, "")
+		}
+	} else {
+		rep.font("", 9)
+		pdf.SetXY(x, y+photoHeight/2-3)
+		pdf.CellFormat(photoWidth, 6, rep.fit(p.Photo.FileName, photoWidth-4), "", 0, "C", false, 0, "")
+	}
+
+	gps := "No GPS"
+	if p.Photo.GPS != nil {
+		gps = fmt.Sprintf("GPS %.6f, %.6f", p.Photo.GPS.Lat, p.Photo.GPS.Lng)
+		if p.Photo.Geofence != "" {
+			gps += ", " + p.Photo.Geofence
+			if d := p.Photo.DistanceText(); d != "" {
+				gps += " " + d
+			}
+		}
+	}
+
+	pdf.SetXY(x, y+photoHeight+1)
+	rep.font("B", 9)
+	pdf.CellFormat(photoWidth, 4.5, fmt.Sprintf("No. %d  %s", p.Photo.RunningNumber, p.Taken.In(models.LocalZone).Format("2006-01-02 15:04:05")), "", 2, "L", false, 0, "")
+	rep.font("", 8)
+	pdf.CellFormat(photoWidth, 4, gps, "", 2, "L", false, 0, "")
+	if p.Photo.Caption != "" {
+		pdf.CellFormat(photoWidth, 4, rep.fit(p.Photo.Caption, photoWidth), "", 2, "L", false, 0, "")
+	}
+}
+
+// fit translates text for the font and shortens it to fit width.
+func (rep *Report) fit(text string, width float64) string {
+	text = rep.tr(text)
+	if rep.pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	// Translated text is one byte a character, UTF-8 text is not.
+	cut := func(s string) string { return s[:len(s)-1] }
+	if rep.Font != "" {
+		cut = func(s string) string { r := []rune(s); return string(r[:len(r)-1]) }
+	}
+	for text != "" && rep.pdf.GetStringWidth(text+"...") > width {
+		text = cut(text)
+	}
+	return text + "..."
+}
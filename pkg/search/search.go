@@ -0,0 +1,232 @@
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Document is a searchable entity. Fields are weighted by Boost when the
+// document is scored, so a match in a worksheet number ranks above a match
+// in a photo caption. Path is the page a result links to.
+type Document struct {
+	Type        string
+	ID          int
+	WorksheetID int
+	Title       string
+	Path        string
+	Fields      []Field
+}
+
+type Field struct {
+	Name  string
+	Text  string
+	Boost float64
+}
+
+type Result struct {
+	Document
+	Score     float64
+	Highlight string
+}
+
+type Results []*Result
+
+// Index is an in-process inverted index used when the database cannot run
+// full-text queries itself.
+type Index struct {
+	mu       sync.RWMutex
+	docs     []*Document
+	postings map[string][]posting
+	built    time.Time
+}
+
+type posting struct {
+	doc   int
+	field int
+	count int
+}
+
+func NewIndex() *Index {
+	return &Index{postings: map[string][]posting{}}
+}
+
+// Rebuild replaces the content of the index with docs.
+func (idx *Index) Rebuild(docs []*Document) {
+	postings := map[string][]posting{}
+	for d, doc := range docs {
+		for f, field := range doc.Fields {
+			counts := map[string]int{}
+			for _, token := range Tokenize(field.Text) {
+				counts[token]++
+			}
+			for token, count := range counts {
+				postings[token] = append(postings[token], posting{d, f, count})
+			}
+		}
+	}
+
+	idx.mu.Lock()
+	idx.docs = docs
+	idx.postings = postings
+	idx.built = time.Now()
+	idx.mu.Unlock()
+}
+
+// Stale reports whether the index is older than maxAge.
+func (idx *Index) Stale(maxAge time.Duration) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.built.IsZero() || time.Since(idx.built) > maxAge
+}
+
+// Search returns up to limit documents matching any term of q, best first.
+// The last term of the query also matches as a prefix so results appear
+// while the user is still typing.
+func (idx *Index) Search(q string, limit int) Results {
+	terms := Tokenize(q)
+	if len(terms) == 0 {
+		return Results{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	scores := map[int]float64{}
+	total := float64(len(idx.docs))
+	for i, term := range terms {
+		tokens := []string{term}
+		if i == len(terms)-1 {
+			tokens = idx.prefixed(term)
+		}
+		for _, token := range tokens {
+			list := idx.postings[token]
+			idf := math.Log(1 + total/float64(len(list)))
+			for _, p := range list {
+				boost := idx.docs[p.doc].Fields[p.field].Boost
+				if boost == 0 {
+					boost = 1
+				}
+				scores[p.doc] += (1 + math.Log(float64(p.count))) * idf * boost
+			}
+		}
+	}
+
+	results := Results{}
+	for d, score := range scores {
+		doc := idx.docs[d]
+		results = append(results, &Result{
+			Document:  *doc,
+			Score:     score,
+			Highlight: HighlightFields(doc.Fields, q),
+		})
+	}
+	results.Sort()
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func (idx *Index) prefixed(term string) []string {
+	tokens := []string{}
+	for token := range idx.postings {
+		if strings.HasPrefix(token, term) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Sort orders results by score, then by type and ID so that equal scores
+// come back in a stable order.
+func (results Results) Sort() {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Type != b.Type {
+			return a.Type > b.Type
+		}
+		return a.ID > b.ID
+	})
+}
+
+// Tokenize splits text into lower case words of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+}
+
+// Highlight returns text HTML escaped with every word that starts with a
+// term of q wrapped in <mark>.
+func Highlight(text, q string) string {
+	terms := Tokenize(q)
+
+	var b strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		if matches(strings.ToLower(w), terms) {
+			b.WriteString("<mark>" + html.EscapeString(w) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(w))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+	return b.String()
+}
+
+// HighlightFields highlights the non-empty fields that match q and joins
+// them, falling back to the first non-empty field.
+func HighlightFields(fields []Field, q string) string {
+	terms := Tokenize(q)
+	parts := []string{}
+	first := ""
+	for _, field := range fields {
+		if field.Text == "" {
+			continue
+		}
+		if first == "" {
+			first = html.EscapeString(field.Text)
+		}
+		for _, token := range Tokenize(field.Text) {
+			if matches(token, terms) {
+				parts = append(parts, Highlight(field.Text, q))
+				break
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return first
+	}
+	return strings.Join(parts, " &middot; ")
+}
+
+func matches(token string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(token, term) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+// Package staticmap draws web mercator map images from MBTiles raster tiles
+// for documents that cannot load a slippy map, such as PDF reports.
+package staticmap
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/tiles"
+)
+
+const tileSize = 256
+
+// Background is the colour of a map where there are no tiles.
+var Background = color.RGBA{242, 239, 233, 255}
+
+// View is a web mercator view of W by H pixels at a zoom level, placed by
+// the world pixel of its top left corner.
+type View struct {
+	Zoom   int
+	X0, Y0 float64
+	W, H   int
+}
+
+// worldPixel returns the position of a location in world pixels at zoom.
+func worldPixel(l *models.Location, zoom int) (x, y float64) {
+	scale := tileSize * math.Exp2(float64(zoom))
+	lat := math.Max(-85.05112878, math.Min(85.05112878, l.Lat)) * math.Pi / 180
+	x = (l.Lng + 180) / 360 * scale
+	y = (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * scale
+	return x, y
+}
+
+// Fit returns the view of w by h pixels at the highest zoom up to maxZoom
+// that shows all locations with a margin, centred on them.
+func Fit(locations []*models.Location, w, h, maxZoom int) View {
+	const margin = 24
+	zoom := maxZoom
+	for ; zoom > 0; zoom-- {
+		minX, minY, maxX, maxY := bounds(locations, zoom)
+		if maxX-minX <= float64(w-2*margin) && maxY-minY <= float64(h-2*margin) {
+			break
+		}
+	}
+	minX, minY, maxX, maxY := bounds(locations, zoom)
+	return View{
+		Zoom: zoom,
+		X0:   (minX+maxX)/2 - float64(w)/2,
+		Y0:   (minY+maxY)/2 - float64(h)/2,
+		W:    w,
+		H:    h,
+	}
+}
+
+func bounds(locations []*models.Location, zoom int) (minX, minY, maxX, maxY float64) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, l := range locations {
+		x, y := worldPixel(l, zoom)
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	return minX, minY, maxX, maxY
+}
+
+// Pixel returns the position of a location in the view.
+func (v View) Pixel(l *models.Location) (x, y float64) {
+	x, y = worldPixel(l, v.Zoom)
+	return x - v.X0, y - v.Y0
+}
+
+// MetresPerPixel returns the scale of the view at a latitude.
+func (v View) MetresPerPixel(lat float64) float64 {
+	return 156543.03392 * math.Cos(lat*math.Pi/180) / math.Exp2(float64(v.Zoom))
+}
+
+// Render draws the tiles under the view, or returns nil if the tiles are
+// not raster images or none cover the view.
+func (v View) Render(t *tiles.MBTiles) *image.RGBA {
+	if t == nil || (t.Format() != "png" && t.Format() != "jpg" && t.Format() != "jpeg") {
+		return nil
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, v.W, v.H))
+	draw.Draw(img, img.Bounds(), &image.Uniform{Background}, image.Point{}, draw.Src)
+
+	n := 1 << uint(v.Zoom)
+	found := false
+	for ty := int(math.Floor(v.Y0 / tileSize)); float64(ty*tileSize) < v.Y0+float64(v.H); ty++ {
+		for tx := int(math.Floor(v.X0 / tileSize)); float64(tx*tileSize) < v.X0+float64(v.W); tx++ {
+			if ty < 0 || ty >= n {
+				continue
+			}
+			data, err := t.Tile(v.Zoom, ((tx%n)+n)%n, ty)
+			if err != nil || data == nil {
+				continue
+			}
+			tile, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			at := image.Pt(tx*tileSize-int(math.Floor(v.X0)), ty*tileSize-int(math.Floor(v.Y0)))
+			draw.Draw(img, tile.Bounds().Add(at), tile, tile.Bounds().Min, draw.Src)
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return img
+}
+
+// Dot draws a filled circle of radius r ringed in white at x, y, like the
+// markers of the page maps.
+func Dot(img draw.Image, x, y, r float64, fill color.Color) {
+	b := img.Bounds()
+	for py := int(math.Floor(y - r - 1)); py <= int(math.Ceil(y+r+1)); py++ {
+		for px := int(math.Floor(x - r - 1)); px <= int(math.Ceil(x+r+1)); px++ {
+			if !image.Pt(px, py).In(b) {
+				continue
+			}
+			d := math.Hypot(float64(px)+0.5-x, float64(py)+0.5-y)
+			switch {
+			case d <= r-1.5:
+				img.Set(px, py, fill)
+			case d <= r:
+				img.Set(px, py, color.White)
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"archive/zip"
+	"io"
+	"mime/multipart"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// Ways to assign running numbers to the files of a batch.
+const (
+	NumberByCaptureTime = "capture"
+	NumberByFileName    = "filename"
+)
+
+// DefaultNumberPattern takes the last run of digits in a file name, so
+// IMG_0012.jpg becomes No. 12.
+var DefaultNumberPattern = regexp.MustCompile(`(\d+)\D*$`)
+
+// BatchFile is one file of a batch upload. Open may be called more than
+// once.
+type BatchFile struct {
+	Name  string
+	Open  func() (io.ReadCloser, error)
+	Taken time.Time
+}
+
+type BatchResult struct {
+	FileName  string
+	Photo     *models.Photo
+	Duplicate bool
+	Err       error
+}
+
+type BatchResults []*BatchResult
+
+// Counts returns how many files were saved, were duplicates and failed.
+func (results BatchResults) Counts() (saved, duplicates, failed int) {
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+		case result.Duplicate:
+			duplicates++
+		default:
+			saved++
+		}
+	}
+	return
+}
+
+// Limits of the ZIP archives of a batch, against archives that expand far
+// beyond their size. Entries count against MaxZipEntries over the whole
+// batch and against MaxZipSize, their uncompressed size, per archive.
+var (
+	MaxZipEntries       = 1000
+	MaxZipSize    int64 = 2 << 30
+)
+
+// MultipartFiles lists the uploaded files, expanding ZIP archives into
+// their entries. Call closeArchives once the files have been read.
+func MultipartFiles(headers []*multipart.FileHeader) (files []*BatchFile, failures BatchResults, closeArchives func()) {
+	archives := []io.Closer{}
+	closeArchives = func() {
+		for _, f := range archives {
+			f.Close()
+		}
+	}
+
+	entries := 0
+	for _, header := range headers {
+		header := header
+		name := CleanName(header.Filename)
+		if name == "" {
+			continue
+		}
+
+		if strings.ToLower(path.Ext(name)) != ".zip" {
+			files = append(files, &BatchFile{
+				Name: name,
+				Open: func() (io.ReadCloser, error) { return header.Open() },
+			})
+			continue
+		}
+
+		f, err := header.Open()
+		if err != nil {
+			failures = append(failures, &BatchResult{FileName: name, Err: err})
+			continue
+		}
+		archives = append(archives, f)
+		zipped, err := ZipFiles(f, header.Size)
+		if err == nil && entries+len(zipped) > MaxZipEntries {
+			err = rejected("the ZIP archives hold more than %d files", MaxZipEntries)
+		}
+		if err != nil {
+			failures = append(failures, &BatchResult{FileName: name, Err: err})
+			continue
+		}
+		entries += len(zipped)
+		files = append(files, zipped...)
+	}
+	return files, failures, closeArchives
+}
+
+// ZipFiles lists the files in a ZIP archive, skipping directories and the
+// hidden files archivers add. Archives of more than MaxZipEntries files or
+// MaxZipSize bytes uncompressed are rejected.
+func ZipFiles(r io.ReaderAt, size int64) ([]*BatchFile, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*BatchFile{}
+	var total uint64
+	for _, zf := range zr.File {
+		zf := zf
+		name := CleanName(zf.Name)
+		if zf.FileInfo().IsDir() || name == "" || strings.HasPrefix(name, ".") || strings.HasPrefix(zf.Name, "__MACOSX/") {
+			continue
+		}
+		// archive/zip fails reads past the size an entry declares, so
+		// the declared sizes can be trusted.
+		total += zf.UncompressedSize64
+		if total > uint64(MaxZipSize) {
+			return nil, rejected("ZIP archive is larger than %d bytes uncompressed", MaxZipSize)
+		}
+		if len(files) == MaxZipEntries {
+			return nil, rejected("ZIP archive holds more than %d files", MaxZipEntries)
+		}
+		files = append(files, &BatchFile{
+			Name: name,
+			Open: func() (io.ReadCloser, error) { return zf.Open() },
+		})
+	}
+	return files, nil
+}
+
+// SaveBatch saves files as photos of a worksheet. With NumberByCaptureTime
+// the files are numbered after the worksheet's last photo in the order they
+// were taken. With NumberByFileName the number comes from the first
+// submatch of pattern, or the whole match, and files without one are
+// numbered as with NumberByCaptureTime. A duplicate does not use a number.
+func (s *Store) SaveBatch(db *models.Database, template *models.Photo, files []*BatchFile, numbering string, pattern *regexp.Regexp) BatchResults {
+	for _, file := range files {
+		file.Taken = captureTime(file)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.Taken.IsZero() != b.Taken.IsZero() {
+			return !a.Taken.IsZero()
+		}
+		if !a.Taken.Equal(b.Taken) {
+			return a.Taken.Before(b.Taken)
+		}
+		return a.Name < b.Name
+	})
+
+	if pattern == nil {
+		pattern = DefaultNumberPattern
+	}
+
+	results := BatchResults{}
+	for _, file := range files {
+		result := &BatchResult{FileName: file.Name}
+		results = append(results, result)
+
+		photo := *template
+		photo.FileName = file.Name
+
+		// A running number or UUID sent with the upload only makes sense
+		// for a single file.
+		number := 0
+		if len(files) == 1 {
+			number = template.RunningNumber
+		} else {
+			photo.UUID = ""
+		}
+		if number == 0 && numbering == NumberByFileName {
+			number = fileNumber(pattern, file.Name)
+		}
+		// Without one, InsertPhoto numbers it after the last photo.
+		photo.RunningNumber = number
+
+		src, err := file.Open()
+		if err != nil {
+			result.Err = err
+			continue
+		}
+		result.Photo, result.Duplicate, result.Err = s.SavePhoto(db, &photo, src)
+		src.Close()
+	}
+	return results
+}
+
+func captureTime(file *BatchFile) time.Time {
+	src, err := file.Open()
+	if err != nil {
+		return time.Time{}
+	}
+	defer src.Close()
+
+	x, err := exif.Decode(src)
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := x.DateTime()
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func fileNumber(pattern *regexp.Regexp, name string) int {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	m := pattern.FindStringSubmatch(name)
+	if m == nil {
+		return 0
+	}
+	s := m[0]
+	if len(m) > 1 {
+		s = m[1]
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+	"gitlab.com/code-mobi/board-checker/pkg/qr"
+)
+
+// Store keeps uploaded files under Dir, one directory per worksheet, and
+// records them in the photos table.
+type Store struct {
+	Dir    string
+	Limits Limits
+
+	// GeofenceRadius is how far in metres from the expected location of
+	// its worksheet a photo may be taken.
+	GeofenceRadius float64
+
+	// ScanQR reads worksheet QR codes from every image saved. Images
+	// saved without a worksheet are always read, to find one.
+	ScanQR bool
+
+	// QR tells which worksheet a QR code names.
+	QR qr.Reader
+}
+
+func (s *Store) WorksheetDir(worksheetID int) string {
+	return filepath.Join(s.Dir, strconv.Itoa(worksheetID))
+}
+
+// WorkDir is the directory of a store holding files that are not photos
+// yet, such as uploads in progress. It lives under Dir so finished files
+// are renamed into place, and is never served.
+const WorkDir = ".work"
+
+func (s *Store) TempDir() string {
+	return filepath.Join(s.Dir, WorkDir, "temp")
+}
+
+// SavePhoto writes the content of src to the worksheet directory of photo
+// and inserts the photo. It returns the stored photo and false, or, when
+// the worksheet already has a photo with the same client UUID or the same
+// content, that photo and true without writing anything. Content the
+// limits of the store do not allow is rejected with a *ValidationError.
+// A photo without a worksheet goes to the worksheet its QR code names, or
+// stays in the inbox.
+func (s *Store) SavePhoto(db *models.Database, photo *models.Photo, src io.Reader) (*models.Photo, bool, error) {
+	if photo.UUID != "" {
+		existing, err := db.GetPhotoByUUID(photo.UUID)
+		if err != nil || existing != nil {
+			return existing, existing != nil, err
+		}
+	}
+
+	if err := os.MkdirAll(s.TempDir(), os.ModePerm); err != nil {
+		return nil, false, err
+	}
+	tmp, err := ioutil.TempFile(s.TempDir(), "upload-")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if s.Limits.MaxBytes > 0 {
+		// Read one byte more than allowed to tell a file at the limit
+		// from a larger one.
+		src = io.LimitReader(src, s.Limits.MaxBytes+1)
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, false, err
+	}
+	if s.Limits.MaxBytes > 0 && n > s.Limits.MaxBytes {
+		return nil, false, rejected("file is larger than the limit of %d bytes", s.Limits.MaxBytes)
+	}
+	photo.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	existing, err := db.GetPhotoByHash(photo.WorksheetID, photo.Hash)
+	if err != nil || existing != nil {
+		return existing, existing != nil, err
+	}
+	if err := db.CheckAcceptsPhotos(photo.WorksheetID); err != nil {
+		return nil, false, err
+	}
+
+	c, err := s.Limits.validate(tmp.Name(), photo.FileName)
+	if err != nil {
+		return nil, false, err
+	}
+	photo.FileName = c.FileName
+	photo.Exif = c.Exif
+	photo.GPS = c.GPS
+
+	if strings.HasPrefix(c.ContentType, "image/") && (s.ScanQR || photo.WorksheetID == models.InboxWorksheetID) {
+		photo.QRWorksheetID, err = s.qrWorksheet(db, tmp.Name())
+		if err != nil {
+			return nil, false, err
+		}
+		if photo.WorksheetID == models.InboxWorksheetID && photo.QRWorksheetID != 0 {
+			// Photos for an approved or deleted worksheet stay in the
+			// inbox.
+			err := db.CheckAcceptsPhotos(photo.QRWorksheetID)
+			if err == nil {
+				photo.WorksheetID = photo.QRWorksheetID
+				photo.RunningNumber = 0
+				if photo.Slot, err = movedSlot(db, photo.WorksheetID, photo.Slot); err != nil {
+					return nil, false, err
+				}
+				existing, err := db.GetPhotoByHash(photo.WorksheetID, photo.Hash)
+				if err != nil || existing != nil {
+					return existing, existing != nil, err
+				}
+			} else if err != models.ErrWorksheetApproved && err != models.ErrNoWorksheet {
+				return nil, false, err
+			}
+		}
+	}
+
+	expected, err := db.ExpectedLocation(photo.WorksheetID)
+	if err != nil {
+		return nil, false, err
+	}
+	photo.CheckGeofence(expected, s.GeofenceRadius)
+
+	dir := s.WorksheetDir(photo.WorksheetID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, false, err
+	}
+	photo.FileName, err = uniqueName(dir, photo.FileName)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, photo.FileName)); err != nil {
+		return nil, false, err
+	}
+
+	err = db.InsertPhoto(photo)
+	if err == models.ErrDuplicatePhoto && photo.UUID != "" {
+		// A concurrent retry with the same UUID won the race.
+		os.Remove(filepath.Join(dir, photo.FileName))
+		existing, err := db.GetPhotoByUUID(photo.UUID)
+		return existing, existing != nil, err
+	} else if err != nil {
+		os.Remove(filepath.Join(dir, photo.FileName))
+		return nil, false, err
+	}
+
+	stored, err := db.GetPhoto(photo.ID)
+	return stored, false, err
+}
+
+// qrWorksheet returns the existing worksheet named by a QR code in the
+// image at path, or 0.
+func (s *Store) qrWorksheet(db *models.Database, path string) (int, error) {
+	text, err := qr.DecodeFile(path)
+	if err != nil {
+		return 0, nil
+	}
+	id, ok := s.QR.WorksheetID(text)
+	if !ok {
+		return 0, nil
+	}
+	worksheet, err := db.GetWorksheet(id)
+	if err != nil || worksheet == nil {
+		return 0, err
+	}
+	return worksheet.ID, nil
+}
+
+// MovePhoto moves a photo and its file to another worksheet, numbering it
+// after the last photo there, and checks it against the geofence of its
+// new worksheet. It returns models.ErrWorksheetApproved when either
+// worksheet is approved.
+func (s *Store) MovePhoto(db *models.Database, photo *models.Photo, worksheetID int) (*models.Photo, error) {
+	if err := db.CheckAcceptsPhotos(photo.WorksheetID); err != nil {
+		return nil, err
+	}
+	if err := db.CheckAcceptsPhotos(worksheetID); err != nil {
+		return nil, err
+	}
+	slot, err := movedSlot(db, worksheetID, photo.Slot)
+	if err != nil {
+		return nil, err
+	}
+	dir := s.WorksheetDir(worksheetID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	name, err := uniqueName(dir, photo.FileName)
+	if err != nil {
+		return nil, err
+	}
+	from := filepath.Join(s.WorksheetDir(photo.WorksheetID), photo.FileName)
+	if err := os.Rename(from, filepath.Join(dir, name)); err != nil {
+		os.Remove(filepath.Join(dir, name))
+		return nil, err
+	}
+	if err := db.MovePhoto(photo.ID, worksheetID, name, slot); err != nil {
+		os.Rename(filepath.Join(dir, name), from)
+		return nil, err
+	}
+	for _, size := range ThumbnailSizes {
+		os.Remove(filepath.Join(s.ThumbnailDir(photo.WorksheetID, size), photo.FileName+".jpg"))
+	}
+	if err := db.RecheckGeofence(worksheetID, s.GeofenceRadius); err != nil {
+		return nil, err
+	}
+	return db.GetPhoto(photo.ID)
+}
+
+// CleanName strips any directory from a client supplied file name.
+func CleanName(name string) string {
+	name = filepath.Base(strings.Replace(name, "\\", "/", -1))
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// movedSlot returns the checklist slot of a photo moved to a worksheet:
+// slot when that worksheet's checklist has it, or none.
+func movedSlot(db *models.Database, worksheetID int, slot string) (string, error) {
+	err := db.CheckSlot(worksheetID, slot)
+	if err == models.ErrUnknownSlot {
+		return "", nil
+	}
+	return slot, err
+}
+
+// uniqueName returns name, or name with a numeric suffix when a file of
+// that name already exists in dir, and reserves it by creating the file.
+func uniqueName(dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = base + "-" + strconv.Itoa(i) + ext
+		}
+		f, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		f.Close()
+		return candidate, nil
+	}
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// ThumbnailSizes are the longest sides in pixels thumbnails are made at.
+var ThumbnailSizes = []int{160, 320, 640, 1280}
+
+// ThumbnailDir holds cached thumbnails. It is kept apart from the worksheet
+// directories, which are downloaded as a whole.
+func (s *Store) ThumbnailDir(worksheetID, size int) string {
+	return filepath.Join(s.Dir, "thumbs", strconv.Itoa(worksheetID), strconv.Itoa(size))
+}
+
+// Thumbnail returns the path of a JPEG of the photo scaled to fit size
+// pixels, upright according to its EXIF orientation. It is made on first
+// use and whenever the photo file is newer.
+func (s *Store) Thumbnail(photo *models.Photo, size int) (string, error) {
+	src := filepath.Join(s.WorksheetDir(photo.WorksheetID), photo.FileName)
+	dst := filepath.Join(s.ThumbnailDir(photo.WorksheetID, size), photo.FileName+".jpg")
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && !dstInfo.ModTime().Before(srcInfo.ModTime()) {
+		return dst, nil
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+
+	orientation := 1
+	if _, err := f.Seek(0, 0); err == nil {
+		if x, err := exif.Decode(f); err == nil {
+			if tag, err := x.Get(exif.Orientation); err == nil {
+				orientation, _ = tag.Int(0)
+			}
+		}
+	}
+	thumb := orient(scale(img, size), orientation)
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "thumb-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := jpeg.Encode(tmp, thumb, &jpeg.Options{Quality: 85}); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(tmp.Name(), dst)
+}
+
+// scale shrinks img so its longest side is at most size, averaging the
+// source pixels that fall into each thumbnail pixel.
+func scale(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w >= h && w > size {
+		tw, th = size, h*size/w
+	} else if h > w && h > size {
+		tw, th = w*size/h, size
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := b.Min.Y+ty*h/th, b.Min.Y+(ty+1)*h/th
+		if y1 == y0 {
+			y1++
+		}
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := b.Min.X+tx*w/tw, b.Min.X+(tx+1)*w/tw
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, ca := img.At(x, y).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			thumb.SetRGBA(tx, ty, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return thumb
+}
+
+// orient turns img upright for the EXIF orientations of a rotated camera.
+// Mirrored orientations are left as they are.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	b := img.Bounds()
+	var out *image.RGBA
+	switch orientation {
+	case 3:
+		out = image.NewRGBA(b)
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				out.Set(b.Dx()-1-x, b.Dy()-1-y, img.At(x, y))
+			}
+		}
+	case 6:
+		out = image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				out.Set(b.Dy()-1-y, x, img.At(x, y))
+			}
+		}
+	case 8:
+		out = image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				out.Set(y, b.Dx()-1-x, img.At(x, y))
+			}
+		}
+	default:
+		out = img
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"gitlab.com/code-mobi/board-checker/pkg/models"
+)
+
+// Limits decide which uploads are accepted. A zero MaxBytes or MaxPixels
+// means no limit.
+type Limits struct {
+	MaxBytes  int64
+	MaxPixels int
+
+	// AllowVideo accepts MP4 files besides JPEG and PNG images.
+	AllowVideo bool
+
+	// Sanitize re-encodes images so that nothing but the pixels is kept
+	// from the upload. The EXIF data is stored with the photo.
+	Sanitize bool
+}
+
+// ValidationError explains why an upload was rejected.
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
+
+func rejected(format string, a ...interface{}) error {
+	return &ValidationError{fmt.Sprintf(format, a...)}
+}
+
+// extensions lists the accepted content types with the extensions the
+// stored file may have; the first is used when the name has none of them.
+var extensions = map[string][]string{
+	"image/jpeg": {".jpg", ".jpeg"},
+	"image/png":  {".png"},
+	"video/mp4":  {".mp4"},
+}
+
+// checked is an upload that passed validation.
+type checked struct {
+	ContentType string
+	FileName    string
+	Exif        []byte
+	GPS         *models.Location
+}
+
+// validate checks the file at path against the limits, re-encoding it in
+// place when sanitising, and returns name with an extension matching the
+// content.
+func (l Limits) validate(path, name string) (*checked, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return nil, rejected("file is empty")
+		}
+		return nil, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	if i := strings.Index(contentType, ";"); i > -1 {
+		contentType = contentType[:i]
+	}
+
+	allowed := contentType == "image/jpeg" || contentType == "image/png" || (l.AllowVideo && contentType == "video/mp4")
+	if !allowed {
+		if l.AllowVideo {
+			return nil, rejected("file type %s is not allowed, only JPEG, PNG and MP4 are", contentType)
+		}
+		return nil, rejected("file type %s is not allowed, only JPEG and PNG are", contentType)
+	}
+
+	c := &checked{
+		ContentType: contentType,
+		FileName:    withExtension(name, extensions[contentType]),
+	}
+	if contentType == "video/mp4" {
+		return c, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, rejected("file is not a valid %s image", strings.ToUpper(strings.TrimPrefix(contentType, "image/")))
+	}
+	if l.MaxPixels > 0 && config.Width*config.Height > l.MaxPixels {
+		return nil, rejected("image is %dx%d pixels, more than the limit of %d pixels", config.Width, config.Height, l.MaxPixels)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, rejected("file is not a valid %s image: %s", strings.ToUpper(format), err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if x, err := exif.Decode(f); err == nil {
+		c.Exif = x.Raw
+		c.GPS = models.ExifLocation(x.Raw)
+	}
+
+	if l.Sanitize {
+		f.Close()
+		if err := reencode(path, img, contentType); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func reencode(path string, img image.Image, contentType string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "sanitize-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if contentType == "image/png" {
+		err = png.Encode(tmp, img)
+	} else {
+		err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: 92})
+	}
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func withExtension(name string, exts []string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range exts {
+		if ext == e {
+			return name
+		}
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + exts[0]
+}
@@ -0,0 +1,137 @@
+// Package tiles serves map tiles from an MBTiles file, so maps work without
+// access to an online tile provider.
+package tiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrUnsupported is returned by Open in builds without the mbtiles tag,
+// which leave out the SQLite driver and so need no cgo.
+var ErrUnsupported = errors.New("tiles: MBTiles need a build with -tags mbtiles")
+
+// MBTiles is an open MBTiles file: an SQLite database holding tiles in TMS
+// order and a metadata table.
+type MBTiles struct {
+	db *sql.DB
+
+	// Metadata holds the name/value pairs of the metadata table, such as
+	// name, format, minzoom, maxzoom and attribution.
+	Metadata map[string]string
+
+	// ModTime is when the file was last changed, used to validate cached
+	// tiles.
+	ModTime time.Time
+}
+
+// Open opens an MBTiles file read-only.
+func Open(path string) (*MBTiles, error) {
+	if driverName == "" {
+		return nil, ErrUnsupported
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driverName, "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &MBTiles{db: db, Metadata: map[string]string{}, ModTime: info.ModTime()}
+	rows, err := db.Query(`SELECT name, value FROM metadata`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			db.Close()
+			return nil, err
+		}
+		t.Metadata[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *MBTiles) Close() error {
+	return t.db.Close()
+}
+
+// Format returns the tile format: png, jpg, webp or pbf. MBTiles without
+// one are png.
+func (t *MBTiles) Format() string {
+	if format := t.Metadata["format"]; format != "" {
+		return format
+	}
+	return "png"
+}
+
+// ContentType returns the media type of the tiles.
+func (t *MBTiles) ContentType() string {
+	switch t.Format() {
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "webp":
+		return "image/webp"
+	case "pbf":
+		return "application/x-protobuf"
+	}
+	return "image/png"
+}
+
+// MinZoom and MaxZoom return the zoom range of the tiles, defaulting to
+// 0 and 18.
+func (t *MBTiles) MinZoom() int { return t.zoom("minzoom", 0) }
+func (t *MBTiles) MaxZoom() int { return t.zoom("maxzoom", 18) }
+
+func (t *MBTiles) zoom(name string, def int) int {
+	z, err := strconv.Atoi(t.Metadata[name])
+	if err != nil {
+		return def
+	}
+	return z
+}
+
+// Tile returns the tile at z/x/y, numbered like web maps with y growing
+// southwards, or nil if the file has no such tile. Gzipped vector tiles
+// are returned uncompressed.
+func (t *MBTiles) Tile(z, x, y int) ([]byte, error) {
+	if z < 0 || z > 30 || x < 0 || y < 0 || x >= 1<<uint(z) || y >= 1<<uint(z) {
+		return nil, nil
+	}
+
+	var data []byte
+	err := t.db.QueryRow(`SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`,
+		z, x, 1<<uint(z)-1-y).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return data, nil
+}
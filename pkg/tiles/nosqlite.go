@@ -0,0 +1,7 @@
+//go:build !mbtiles
+// +build !mbtiles
+
+package tiles
+
+// Without the mbtiles tag there is no SQLite driver and Open fails.
+const driverName = ""
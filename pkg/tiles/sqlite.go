@@ -0,0 +1,9 @@
+//go:build mbtiles
+// +build mbtiles
+
+package tiles
+
+// The SQLite driver needs cgo, so it is only built in with the mbtiles tag.
+import _ "github.com/mattn/go-sqlite3"
+
+const driverName = "sqlite3"
@@ -0,0 +1,329 @@
+// Package tus keeps the state of resumable uploads made with the tus 1.0
+// protocol (https://tus.io/protocols/resumable-upload.html). Each upload
+// is a data file and a JSON info file in the store directory.
+package tus
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Version    = "1.0.0"
+	Extensions = "creation,expiration,termination"
+)
+
+var (
+	ErrNotFound        = errors.New("tus: upload not found")
+	ErrOffsetMismatch  = errors.New("tus: Upload-Offset does not match the upload")
+	ErrTooLarge        = errors.New("tus: upload is larger than Upload-Length")
+	ErrInvalidMetadata = errors.New("tus: invalid Upload-Metadata")
+)
+
+var rxID = regexp.MustCompile("^[0-9a-f]{32}$")
+
+type Upload struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"-"`
+	Metadata map[string]string `json:"metadata"`
+	Created  time.Time         `json:"created"`
+	Expires  time.Time         `json:"expires"`
+	PhotoID  int               `json:"photoID,omitempty"`
+
+	// UserID is the user who created the upload, the only one who may
+	// resume or delete it.
+	UserID int `json:"userID"`
+}
+
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+type Store struct {
+	Dir string
+	TTL time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+// uploadLock is the lock of an upload and how many hold it or wait on it.
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+func NewStore(dir string, ttl time.Duration) *Store {
+	return &Store{Dir: dir, TTL: ttl, locks: map[string]*uploadLock{}}
+}
+
+// Lock serialises requests on one upload. Call the returned function to
+// unlock it. The lock is dropped once no one holds it or waits on it, and
+// not before, so that every request on an upload shares the same lock.
+func (s *Store) Lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &uploadLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Store) Create(userID int, length int64, metadata map[string]string) (*Upload, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	u := &Upload{
+		ID:       hex.EncodeToString(b),
+		Length:   length,
+		Metadata: metadata,
+		Created:  now,
+		Expires:  now.Add(s.TTL),
+		UserID:   userID,
+	}
+
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.dataPath(u.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	return u, s.save(u)
+}
+
+// Get returns the upload with its current offset. Expired uploads are not
+// found even if they have not been removed yet.
+func (s *Store) Get(id string) (*Upload, error) {
+	if !rxID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+
+	b, err := ioutil.ReadFile(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	u := &Upload{}
+	if err := json.Unmarshal(b, u); err != nil {
+		return nil, err
+	}
+	if time.Now().After(u.Expires) {
+		return nil, ErrNotFound
+	}
+
+	if u.PhotoID != 0 {
+		u.Offset = u.Length
+		return u, nil
+	}
+
+	info, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		return nil, err
+	}
+	u.Offset = info.Size()
+	return u, nil
+}
+
+// Append writes r at offset and extends the expiry of the upload. The
+// caller must hold the lock of the upload.
+func (s *Store) Append(id string, offset int64, r io.Reader) (*Upload, error) {
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != u.Offset || u.PhotoID != 0 {
+		return u, ErrOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Read one byte more than is left to detect an oversized body, which
+	// is discarded as a whole.
+	start := u.Offset
+	n, err := io.Copy(f, io.LimitReader(r, u.Length-u.Offset+1))
+	u.Offset += n
+	if u.Offset > u.Length {
+		u.Offset = start
+		if err := f.Truncate(start); err != nil {
+			return nil, err
+		}
+		return u, ErrTooLarge
+	}
+	if err != nil {
+		// Keep what arrived so the client can resume from there.
+		return u, err
+	}
+
+	u.Expires = time.Now().UTC().Add(s.TTL)
+	return u, s.save(u)
+}
+
+// Open returns the data of an upload for reading.
+func (s *Store) Open(id string) (*os.File, error) {
+	if !rxID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	return os.Open(s.dataPath(id))
+}
+
+// Finish records the photo an upload became and removes its data. The
+// info is kept until the upload expires so HEAD requests still answer.
+func (s *Store) Finish(id string, photoID int) error {
+	u, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	u.PhotoID = photoID
+	if err := s.save(u); err != nil {
+		return err
+	}
+	return os.Remove(s.dataPath(id))
+}
+
+func (s *Store) Delete(id string) error {
+	if !rxID.MatchString(id) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	os.Remove(s.dataPath(id))
+	return nil
+}
+
+// Expire removes uploads past their expiry, and the files of those it
+// can't read, such as a data file without its info, once they are older
+// than the TTL. It returns how many uploads it removed.
+func (s *Store) Expire() (int, error) {
+	ids := map[string]bool{}
+	for _, pattern := range []string{"*.info", "*.bin"} {
+		files, err := filepath.Glob(filepath.Join(s.Dir, pattern))
+		if err != nil {
+			return 0, err
+		}
+		for _, file := range files {
+			ids[strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))] = true
+		}
+	}
+
+	n := 0
+	for id := range ids {
+		if rxID.MatchString(id) && s.expire(id) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) expire(id string) bool {
+	unlock := s.Lock(id)
+	defer unlock()
+
+	_, err := s.Get(id)
+	if err == nil {
+		return false
+	}
+	// A new upload has a data file for a moment before its info.
+	_, statErr := os.Stat(s.infoPath(id))
+	if (err != ErrNotFound || statErr != nil) && time.Since(s.modified(id)) < s.TTL {
+		return false
+	}
+
+	os.Remove(s.infoPath(id))
+	os.Remove(s.dataPath(id))
+	return true
+}
+
+// modified returns when the files of an upload last changed.
+func (s *Store) modified(id string) time.Time {
+	var t time.Time
+	for _, path := range []string{s.infoPath(id), s.dataPath(id)} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(t) {
+			t = info.ModTime()
+		}
+	}
+	return t
+}
+
+func (s *Store) save(u *Upload) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(u.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(u.ID))
+}
+
+func (s *Store) infoPath(id string) string {
+	return filepath.Join(s.Dir, id+".info")
+}
+
+func (s *Store) dataPath(id string) string {
+	return filepath.Join(s.Dir, id+".bin")
+}
+
+// ParseMetadata decodes an Upload-Metadata header: comma separated pairs
+// of a key and a base64 encoded value.
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, " ", 2)
+		value := ""
+		if len(parts) == 2 {
+			b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, ErrInvalidMetadata
+			}
+			value = string(b)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
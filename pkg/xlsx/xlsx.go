@@ -0,0 +1,312 @@
+// Package xlsx streams single sheet Excel workbooks. Rows are written to
+// the sheet as they come, so exports of any length use little memory;
+// thumbnails are only remembered by row and added once the sheet is done.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// Column is the title and width in characters of a column.
+type Column struct {
+	Title string
+	Width float64
+}
+
+// Thumbnail returns the path of a JPEG to show in the last column of a
+// row. It is called when the workbook is closed; an error leaves the
+// thumbnail out.
+type Thumbnail func() (string, error)
+
+// Thumbnails are scaled to fit a box of this many pixels.
+const (
+	thumbnailWidth  = 120
+	thumbnailHeight = 90
+	emuPerPixel     = 9525
+)
+
+// Cell styles of styles.xml.
+const (
+	styleDate    = 1
+	styleHeader  = 2
+	stylePercent = 3
+)
+
+// Percent is a fraction shown as a percentage.
+type Percent float64
+
+// Writer writes the rows of a sheet.
+type Writer struct {
+	z          *zip.Writer
+	sheet      *bufio.Writer
+	columns    []Column
+	thumbnails bool
+	rows       int
+	images     []placedImage
+	err        error
+}
+
+type placedImage struct {
+	row       int
+	thumbnail Thumbnail
+}
+
+// NewWriter starts a workbook with a sheet named name, headed by the
+// column titles. With thumbnails a last column holds the thumbnail of
+// each row.
+func NewWriter(w io.Writer, name string, columns []Column, thumbnails bool) (*Writer, error) {
+	if thumbnails {
+		columns = append(columns, Column{"Thumbnail", float64(thumbnailWidth+10) / 7})
+	}
+	xw := &Writer{z: zip.NewWriter(w), columns: columns, thumbnails: thumbnails}
+
+	for name, content := range staticParts {
+		if err := xw.writePart(name, content); err != nil {
+			return nil, err
+		}
+	}
+	workbook := fmt.Sprintf(workbookXML, xmlEscape(sheetName(name)))
+	if err := xw.writePart("xl/workbook.xml", workbook); err != nil {
+		return nil, err
+	}
+
+	f, err := xw.z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw.sheet = bufio.NewWriter(f)
+	xw.sheet.WriteString(header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	xw.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	xw.sheet.WriteString(`<sheetFormatPr defaultRowHeight="15"/><cols>`)
+	for i, c := range columns {
+		fmt.Fprintf(xw.sheet, `<col min="%d" max="%d" width="%.1f" customWidth="1"/>`, i+1, i+1, c.Width)
+	}
+	xw.sheet.WriteString(`</cols><sheetData>`)
+
+	titles := make([]interface{}, len(columns))
+	for i, c := range columns {
+		titles[i] = c.Title
+	}
+	xw.row(titles, styleHeader, false)
+	return xw, xw.err
+}
+
+// Row writes a row of strings, numbers, Percents and times. A nil value
+// leaves its cell empty. thumbnail may be nil.
+func (w *Writer) Row(thumbnail Thumbnail, values ...interface{}) error {
+	tall := w.thumbnails && thumbnail != nil
+	w.row(values, 0, tall)
+	if tall {
+		w.images = append(w.images, placedImage{w.rows, thumbnail})
+	}
+	return w.err
+}
+
+func (w *Writer) row(values []interface{}, style int, tall bool) {
+	if w.err != nil {
+		return
+	}
+	w.rows++
+	if tall {
+		fmt.Fprintf(w.sheet, `<row r="%d" ht="%d" customHeight="1">`, w.rows, (thumbnailHeight+8)*3/4)
+	} else {
+		fmt.Fprintf(w.sheet, `<row r="%d">`, w.rows)
+	}
+	for i, v := range values {
+		ref := columnName(i) + strconv.Itoa(w.rows)
+		s := ""
+		if style != 0 {
+			s = ` s="` + strconv.Itoa(style) + `"`
+		}
+		switch v := v.(type) {
+		case nil:
+		case string:
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, ref, s, xmlEscape(v))
+		case int:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%d</v></c>`, ref, s, v)
+		case float64:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%s</v></c>`, ref, s, strconv.FormatFloat(v, 'f', -1, 64))
+		case Percent:
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, stylePercent, strconv.FormatFloat(float64(v), 'f', -1, 64))
+		case time.Time:
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDate, strconv.FormatFloat(serial(v), 'f', 6, 64))
+		default:
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"%s><is><t>%s</t></is></c>`, ref, s, xmlEscape(fmt.Sprint(v)))
+		}
+	}
+	_, w.err = w.sheet.WriteString(`</row>`)
+}
+
+// Close ends the sheet, adds the thumbnails and finishes the workbook.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	last := columnName(len(w.columns)-1) + strconv.Itoa(w.rows)
+	fmt.Fprintf(w.sheet, `</sheetData><autoFilter ref="A1:%s"/>`, last)
+	if len(w.images) > 0 {
+		w.sheet.WriteString(`<drawing r:id="rId1"/>`)
+	}
+	w.sheet.WriteString(`</worksheet>`)
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+
+	types := header + contentTypesXML
+	if len(w.images) > 0 {
+		if err := w.writeDrawing(); err != nil {
+			return err
+		}
+		types += `<Override PartName="/xl/drawings/drawing1.xml" ContentType="application/vnd.openxmlformats-officedocument.drawing+xml"/>`
+	}
+	if err := w.writePart("[Content_Types].xml", types+`</Types>`); err != nil {
+		return err
+	}
+	return w.z.Close()
+}
+
+// writeDrawing writes the thumbnails and the drawing placing them in the
+// last column.
+func (w *Writer) writeDrawing() error {
+	type placed struct {
+		row, n        int
+		width, height int
+	}
+	pictures := []placed{}
+	for _, image := range w.images {
+		path, err := image.thumbnail()
+		if err != nil {
+			continue
+		}
+		width, height, err := w.copyImage(path, len(pictures)+1)
+		if err != nil {
+			continue
+		}
+		pictures = append(pictures, placed{image.row, len(pictures) + 1, width, height})
+	}
+
+	if err := w.writePart("xl/worksheets/_rels/sheet1.xml.rels", header+`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing" Target="../drawings/drawing1.xml"/>`+
+		`</Relationships>`); err != nil {
+		return err
+	}
+
+	f, err := w.z.Create("xl/drawings/drawing1.xml")
+	if err != nil {
+		return err
+	}
+	drawing := bufio.NewWriter(f)
+	drawing.WriteString(header + `<xdr:wsDr xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	col := len(w.columns) - 1
+	for _, p := range pictures {
+		fmt.Fprintf(drawing, `<xdr:oneCellAnchor><xdr:from><xdr:col>%d</xdr:col><xdr:colOff>%d</xdr:colOff><xdr:row>%d</xdr:row><xdr:rowOff>%d</xdr:rowOff></xdr:from><xdr:ext cx="%d" cy="%d"/>`,
+			col, 4*emuPerPixel, p.row-1, 4*emuPerPixel, p.width*emuPerPixel, p.height*emuPerPixel)
+		fmt.Fprintf(drawing, `<xdr:pic><xdr:nvPicPr><xdr:cNvPr id="%d" name="Thumbnail %d"/><xdr:cNvPicPr><a:picLocks noChangeAspect="1"/></xdr:cNvPicPr></xdr:nvPicPr>`, p.n+1, p.n)
+		fmt.Fprintf(drawing, `<xdr:blipFill><a:blip r:embed="rId%d"/><a:stretch><a:fillRect/></a:stretch></xdr:blipFill>`, p.n)
+		fmt.Fprintf(drawing, `<xdr:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></xdr:spPr></xdr:pic><xdr:clientData/></xdr:oneCellAnchor>`,
+			p.width*emuPerPixel, p.height*emuPerPixel)
+	}
+	drawing.WriteString(`</xdr:wsDr>`)
+	if err := drawing.Flush(); err != nil {
+		return err
+	}
+
+	f, err = w.z.Create("xl/drawings/_rels/drawing1.xml.rels")
+	if err != nil {
+		return err
+	}
+	rels := bufio.NewWriter(f)
+	rels.WriteString(header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for _, p := range pictures {
+		fmt.Fprintf(rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="../media/image%d.jpeg"/>`, p.n, p.n)
+	}
+	rels.WriteString(`</Relationships>`)
+	return rels.Flush()
+}
+
+// copyImage adds the JPEG at path as image n, returning its size scaled to
+// fit the thumbnail box.
+func (w *Writer) copyImage(path string, n int) (width, height int, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil || format != "jpeg" || config.Width == 0 || config.Height == 0 {
+		return 0, 0, fmt.Errorf("%s is not a JPEG", path)
+	}
+	f, err := w.z.Create("xl/media/image" + strconv.Itoa(n) + ".jpeg")
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := f.Write(b); err != nil {
+		return 0, 0, err
+	}
+
+	width, height = thumbnailWidth, config.Height*thumbnailWidth/config.Width
+	if height > thumbnailHeight {
+		width, height = config.Width*thumbnailHeight/config.Height, thumbnailHeight
+	}
+	return width, height, nil
+}
+
+func (w *Writer) writePart(name, content string) error {
+	f, err := w.z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	return err
+}
+
+// columnName returns the letters of the zero based column i.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// serial returns t as an Excel date serial, the days since 1899-12-30.
+func serial(t time.Time) float64 {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Sub(epoch).Hours() / 24
+}
+
+// sheetName drops the characters Excel does not allow in sheet names and
+// cuts them to 31 characters.
+func sheetName(name string) string {
+	runes := []rune{}
+	for _, r := range name {
+		switch r {
+		case '\\', '/', '?', '*', '[', ']', ':':
+			continue
+		}
+		runes = append(runes, r)
+	}
+	if len(runes) > 31 {
+		runes = runes[:31]
+	}
+	if len(runes) == 0 {
+		return "Sheet1"
+	}
+	return string(runes)
+}
+
+func xmlEscape(s string) string {
+	buf := new(bytes.Buffer)
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}